@@ -0,0 +1,139 @@
+// Renders /openapi.json for /docs. It is served from this origin with the page, so the page works
+// offline and under the strict Content-Security-Policy it is sent with.
+(function () {
+  "use strict";
+
+  var METHODS = ["get", "post", "put", "patch", "delete"];
+
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) node.className = className;
+    if (text !== undefined) node.textContent = text;
+    return node;
+  }
+
+  function resolve(spec, schema) {
+    var seen = 0;
+    while (schema && schema.$ref && seen++ < 32) {
+      var path = schema.$ref.replace(/^#\//, "").split("/");
+      schema = path.reduce(function (node, key) { return node && node[key]; }, spec);
+    }
+    return schema || {};
+  }
+
+  // example builds a value shaped like schema, nested refs are cut off after a few levels
+  function example(spec, schema, depth) {
+    schema = resolve(spec, schema);
+    if (depth > 6) return "…";
+    if (schema.example !== undefined) return schema.example;
+    if (schema.enum) return schema.enum[0];
+    switch (schema.type) {
+      case "object":
+        var out = {};
+        Object.keys(schema.properties || {}).forEach(function (key) {
+          out[key] = example(spec, schema.properties[key], depth + 1);
+        });
+        if (schema.additionalProperties && !schema.properties) out["<key>"] = example(spec, schema.additionalProperties, depth + 1);
+        return out;
+      case "array":
+        return [example(spec, schema.items, depth + 1)];
+      case "integer":
+      case "number":
+        return 0;
+      case "boolean":
+        return false;
+      case "string":
+        return schema.format ? "<" + schema.format + ">" : "string";
+    }
+    return schema.nullable ? null : {};
+  }
+
+  function schemaBlock(spec, content) {
+    var block = el("div");
+    Object.keys(content || {}).forEach(function (type) {
+      block.appendChild(el("div", "content-type", type));
+      var value = example(spec, content[type].schema, 0);
+      block.appendChild(el("pre", "", typeof value === "string" ? value : JSON.stringify(value, null, 2)));
+    });
+    return block;
+  }
+
+  function operation(spec, path, method, op) {
+    var details = el("details", "operation " + method);
+    details.dataset.search = (path + " " + (op.summary || "")).toLowerCase();
+
+    var summary = el("summary");
+    summary.appendChild(el("span", "method", method.toUpperCase()));
+    summary.appendChild(el("code", "path", path));
+    summary.appendChild(el("span", "summary", op.summary || ""));
+    if (op.security && op.security.length) summary.appendChild(el("span", "auth", "bearer"));
+    details.appendChild(summary);
+
+    if (op.parameters && op.parameters.length) {
+      details.appendChild(el("h4", "", "Parameters"));
+      var table = el("table");
+      op.parameters.forEach(function (p) {
+        var row = el("tr");
+        row.appendChild(el("td", "", p.name + (p.required ? " *" : "")));
+        row.appendChild(el("td", "", p.in));
+        row.appendChild(el("td", "", resolve(spec, p.schema).type || ""));
+        row.appendChild(el("td", "", p.description || ""));
+        table.appendChild(row);
+      });
+      details.appendChild(table);
+    }
+
+    if (op.requestBody) {
+      details.appendChild(el("h4", "", "Request body"));
+      details.appendChild(schemaBlock(spec, op.requestBody.content));
+    }
+
+    details.appendChild(el("h4", "", "Responses"));
+    Object.keys(op.responses || {}).sort().forEach(function (status) {
+      var response = op.responses[status];
+      details.appendChild(el("div", "status s" + status.charAt(0), status + " " + (response.description || "")));
+      if (response.content) details.appendChild(schemaBlock(spec, response.content));
+    });
+    return details;
+  }
+
+  function render(spec) {
+    document.getElementById("version").textContent = "OpenAPI " + spec.openapi + ", version " + (spec.info || {}).version;
+
+    var byTag = {};
+    Object.keys(spec.paths).sort().forEach(function (path) {
+      METHODS.forEach(function (method) {
+        var op = spec.paths[path][method];
+        if (!op) return;
+        var tag = (op.tags && op.tags[0]) || "default";
+        (byTag[tag] = byTag[tag] || []).push(operation(spec, path, method, op));
+      });
+    });
+
+    var main = document.getElementById("operations");
+    main.textContent = "";
+    Object.keys(byTag).sort().forEach(function (tag) {
+      var section = el("section");
+      section.appendChild(el("h2", "", tag));
+      byTag[tag].forEach(function (op) { section.appendChild(op); });
+      main.appendChild(section);
+    });
+
+    document.getElementById("filter").addEventListener("input", function (event) {
+      var q = event.target.value.toLowerCase();
+      main.querySelectorAll(".operation").forEach(function (op) {
+        op.hidden = q !== "" && op.dataset.search.indexOf(q) < 0;
+      });
+    });
+  }
+
+  fetch("/openapi.json")
+    .then(function (res) {
+      if (!res.ok) throw new Error("GET /openapi.json: " + res.status);
+      return res.json();
+    })
+    .then(render)
+    .catch(function (err) {
+      document.getElementById("operations").textContent = err.message;
+    });
+})();
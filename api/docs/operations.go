@@ -0,0 +1,326 @@
+package docs
+
+import (
+	"net/http"
+	"time"
+
+	"segokuning/api/handlers"
+	"segokuning/db/entity"
+)
+
+// Responses that handlers build with fiber.Map are described here.
+type (
+	MessageResponse struct {
+		Message string `json:"message"`
+	}
+
+	AuthData struct {
+		Name        string  `json:"name"`
+		Phone       *string `json:"phone"`
+		Email       *string `json:"email"`
+		AccessToken string  `json:"accessToken"`
+	}
+
+	AuthResponse struct {
+		Message string   `json:"message"`
+		Data    AuthData `json:"data"`
+	}
+
+	AccountData struct {
+		Name  string  `json:"name"`
+		Phone *string `json:"phone"`
+		Email *string `json:"email"`
+		Image string  `json:"image,omitempty"`
+	}
+
+	AccountResponse struct {
+		Message string      `json:"message"`
+		Data    AccountData `json:"data"`
+	}
+
+	VerificationCodeData struct {
+		CredentialType string    `json:"credentialType"`
+		ExpiresAt      time.Time `json:"expiresAt"`
+	}
+
+	VerificationCodeResponse struct {
+		Message string               `json:"message"`
+		Data    VerificationCodeData `json:"data"`
+	}
+
+	VerifiedData struct {
+		CredentialType  string `json:"credentialType"`
+		CredentialValue string `json:"credentialValue"`
+	}
+
+	VerifiedResponse struct {
+		Message string       `json:"message"`
+		Data    VerifiedData `json:"data"`
+	}
+
+	ImageData struct {
+		ImageUrl string `json:"imageUrl"`
+	}
+
+	ImageResponse struct {
+		Message string    `json:"message"`
+		Data    ImageData `json:"data"`
+	}
+)
+
+// Operations documents every route registered by routes.RouteRegister.
+// TestSpecCoversRoutes fails when the two drift apart.
+var Operations = []Operation{
+	{
+		Method: http.MethodGet, Path: "/ping", Tag: "health",
+		Summary:     "Liveness probe",
+		ContentType: "text/plain",
+	},
+	{
+		Method: http.MethodGet, Path: "/healthz", Tag: "health",
+		Summary:  "Liveness probe, the process is up",
+		Response: handlers.HealthResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/readyz", Tag: "health",
+		Summary:  "Readiness probe, answers 503 with the same body when the database or storage is unreachable",
+		Response: handlers.HealthResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/openapi.json", Tag: "docs",
+		Summary: "This OpenAPI document",
+	},
+	{
+		Method: http.MethodGet, Path: "/docs", Tag: "docs",
+		Summary:     "API documentation page",
+		ContentType: "text/html",
+	},
+	{
+		Method: http.MethodGet, Path: "/docs/docs.js", Tag: "docs",
+		Summary:     "Script of the documentation page",
+		ContentType: "text/javascript",
+	},
+	{
+		Method: http.MethodGet, Path: "/docs/docs.css", Tag: "docs",
+		Summary:     "Stylesheet of the documentation page",
+		ContentType: "text/css",
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/image", Tag: "image", Auth: true,
+		Summary:  "Upload a jpeg image between 10KB and 2MB",
+		Upload:   "file",
+		Response: ImageResponse{}, Envelope: EnvelopeNone,
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/register", Tag: "user",
+		Summary: "Register with an email or phone credential",
+		Body:    handlers.RegisterRequest{},
+		Status:  http.StatusCreated, Response: AuthResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusConflict, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/login", Tag: "user",
+		Summary:  "Login with an email or phone credential",
+		Body:     handlers.AuthRequest{},
+		Response: AuthResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPatch, Path: "/v1/user", Tag: "user", Auth: true,
+		Summary:  "Update name and profile image",
+		Body:     handlers.UpdateAccountRequest{},
+		Response: AccountResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/link/email", Tag: "user", Auth: true,
+		Summary:  "Link an email to the account",
+		Body:     handlers.UpdateEmailRequest{},
+		Response: AccountResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/link/phone", Tag: "user", Auth: true,
+		Summary:  "Link a phone number to the account",
+		Body:     handlers.UpdatePhoneRequest{},
+		Response: AccountResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/verify/request", Tag: "user", Auth: true,
+		Summary:  "Send a verification code to the linked email or phone",
+		Body:     handlers.RequestVerificationRequest{},
+		Response: VerificationCodeResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/verify", Tag: "user", Auth: true,
+		Summary:  "Verify the linked email or phone with a code",
+		Body:     handlers.VerifyRequest{},
+		Response: VerifiedResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/password", Tag: "user", Auth: true,
+		Summary:  "Change the password and sign out other sessions",
+		Body:     handlers.ChangePasswordRequest{},
+		Response: AuthResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/password/forgot", Tag: "user",
+		Summary:  "Send a password reset token to a verified email or phone",
+		Body:     handlers.ForgotPasswordRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/password/reset", Tag: "user",
+		Summary:  "Set a new password with a reset token and sign out every session",
+		Body:     handlers.ResetPasswordRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodDelete, Path: "/v1/user/me", Tag: "user", Auth: true,
+		Summary:  "Delete the account and everything it created",
+		Body:     handlers.DeleteAccountRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/me/deactivate", Tag: "user", Auth: true,
+		Summary:  "Hide the account until the next login, it is deleted after the retention window",
+		Body:     handlers.DeactivateAccountRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/user/me/activity", Tag: "user", Auth: true,
+		Summary:  "List the account's logins, failed logins and account and friendship changes, newest first",
+		Query:    handlers.QueryActivity{},
+		Response: []entity.AuditEntry{}, Envelope: EnvelopeSuccessMeta,
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/user/me/export", Tag: "user", Auth: true,
+		Summary:     "Download a zip of everything the account created",
+		ContentType: "application/zip",
+		Errors:      []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/post", Tag: "post", Auth: true,
+		Summary:  "Create a post",
+		Body:     handlers.AddPostRequest{},
+		Response: entity.Post{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/post", Tag: "post", Auth: true,
+		Summary:  "List posts from the user and their friends",
+		Query:    handlers.QueryGetPosts{},
+		Response: handlers.GetPostsResponse{}, Envelope: EnvelopeSuccess,
+		Conditional: true,
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/comment", Tag: "comment", Auth: true,
+		Summary:  "Comment on a friend's post",
+		Body:     handlers.AddCommentRequest{},
+		Response: entity.CommentPerPost{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/friend", Tag: "friend", Auth: true,
+		Summary:  "List users and friends",
+		Query:    handlers.QueryGetFriends{},
+		Response: []handlers.FriendData{}, Envelope: EnvelopeSuccessMeta,
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/friend", Tag: "friend", Auth: true,
+		Summary:  "Add a friend",
+		Body:     handlers.FriendRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodDelete, Path: "/v1/friend", Tag: "friend", Auth: true,
+		Summary:  "Remove a friend",
+		Body:     handlers.FriendRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/report", Tag: "report", Auth: true,
+		Summary:  "Report a post, a comment or a user to the moderators",
+		Body:     handlers.AddReportRequest{},
+		Response: handlers.ReportResponse{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/admin/users", Tag: "admin", Auth: true,
+		Summary:  "Search users, for moderators and admins",
+		Query:    handlers.QueryAdminUsers{},
+		Response: []entity.AdminUser{}, Envelope: EnvelopeSuccessMeta,
+		Errors: []int{http.StatusForbidden},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/admin/audit", Tag: "admin", Auth: true,
+		Summary:  "Search the audit log, newest first, for admins",
+		Query:    handlers.QueryAuditLog{},
+		Response: []entity.AuditEntry{}, Envelope: EnvelopeSuccessMeta,
+		Errors: []int{http.StatusForbidden},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/admin/users/:userId/suspend", Tag: "admin", Auth: true,
+		Summary:  "Suspend a user and sign them out, for moderators and admins",
+		Body:     handlers.SuspendRequest{},
+		Response: entity.AdminUser{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/admin/users/:userId/unsuspend", Tag: "admin", Auth: true,
+		Summary:  "Lift a suspension, for moderators and admins",
+		Response: entity.AdminUser{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPut, Path: "/v1/admin/users/:userId/role", Tag: "admin", Auth: true,
+		Summary:  "Change the role of a user and sign them out, for admins",
+		Body:     handlers.SetRoleRequest{},
+		Response: entity.AdminUser{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/admin/posts/:postId", Tag: "admin", Auth: true,
+		Summary:  "Read any post, for moderators and admins",
+		Response: handlers.ElemData{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodDelete, Path: "/v1/admin/posts/:postId", Tag: "admin", Auth: true,
+		Summary:  "Delete a post, for moderators and admins",
+		Body:     handlers.ModerationRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodDelete, Path: "/v1/admin/posts/:postId/comments/:commentId", Tag: "admin", Auth: true,
+		Summary:  "Delete a comment, for moderators and admins",
+		Body:     handlers.ModerationRequest{},
+		Response: MessageResponse{}, Envelope: EnvelopeNone,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/admin/reports", Tag: "admin", Auth: true,
+		Summary:  "List reports, the open ones oldest first, for moderators and admins",
+		Query:    handlers.QueryReports{},
+		Response: []entity.Report{}, Envelope: EnvelopeSuccessMeta,
+		Errors: []int{http.StatusForbidden},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/admin/reports/:reportId/resolve", Tag: "admin", Auth: true,
+		Summary:  "Dismiss a report, hide the content or suspend its author, for moderators and admins",
+		Body:     handlers.ResolveReportRequest{},
+		Response: entity.Report{}, Envelope: EnvelopeSuccess,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+}
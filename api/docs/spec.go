@@ -0,0 +1,363 @@
+package docs
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/db/entity"
+)
+
+// Spec is the generated OpenAPI document served at /openapi.json.
+// Regenerate it with `go test ./api/docs -update` after changing a route or payload.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Page is the documentation UI served at /docs. It renders Spec with Script and Style, served
+// from this origin so the page needs nothing from a CDN.
+//
+//go:embed index.html
+var Page []byte
+
+//go:embed assets/docs.js
+var Script []byte
+
+//go:embed assets/docs.css
+var Style []byte
+
+// PageCSP is the Content-Security-Policy /docs is sent with, everything it loads is same-origin.
+const PageCSP = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self' data:; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+type Envelope int
+
+const (
+	// EnvelopeNone means the handler writes Response as is.
+	EnvelopeNone Envelope = iota
+	// EnvelopeSuccess wraps Response as in responses.Success.
+	EnvelopeSuccess
+	// EnvelopeSuccessMeta wraps Response as in responses.SuccessMeta.
+	EnvelopeSuccessMeta
+)
+
+// Operation describes a single route for the OpenAPI document.
+type Operation struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	Auth    bool
+
+	Body   interface{}
+	Query  interface{}
+	Upload string // multipart form field holding an uploaded file
+
+	Status      int
+	ContentType string
+	Response    interface{}
+	Envelope    Envelope
+	Errors      []int
+	Conditional bool // sends an ETag and answers a matching If-None-Match with 304
+}
+
+type object = map[string]interface{}
+
+type builder struct {
+	schemas object
+}
+
+// Build generates the OpenAPI document from Operations.
+func Build() ([]byte, error) {
+	b := builder{schemas: object{}}
+
+	paths := object{}
+	for _, op := range Operations {
+		path := openAPIPath(op.Path)
+		item, ok := paths[path].(object)
+		if !ok {
+			item = object{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = b.operation(op)
+	}
+
+	b.schemas["responses.ErrorBody"] = b.schema(reflect.TypeOf(responses.ErrorBody{}))
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "segokuning",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": b.schemas,
+			"securitySchemes": object{
+				"bearerAuth": object{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func (b *builder) operation(op Operation) object {
+	o := object{
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+		"operationId": strings.ToLower(op.Method) + strings.NewReplacer("/", "_", ":", "").Replace(op.Path),
+	}
+
+	if op.Auth {
+		o["security"] = []object{{"bearerAuth": []string{}}}
+	}
+
+	params := pathParameters(op.Path)
+	if op.Query != nil {
+		params = append(params, b.queryParameters(reflect.TypeOf(op.Query))...)
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	switch {
+	case op.Body != nil:
+		o["requestBody"] = object{
+			"required": true,
+			"content": object{
+				"application/json": object{"schema": b.schema(reflect.TypeOf(op.Body))},
+			},
+		}
+	case op.Upload != "":
+		o["requestBody"] = object{
+			"required": true,
+			"content": object{
+				"multipart/form-data": object{"schema": object{
+					"type":     "object",
+					"required": []string{op.Upload},
+					"properties": object{
+						op.Upload: object{"type": "string", "format": "binary"},
+					},
+				}},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	resps := object{strconv.Itoa(status): b.response(op)}
+	if op.Conditional {
+		resps[strconv.Itoa(http.StatusNotModified)] = object{"description": "Not Modified, the ETag in If-None-Match is current"}
+	}
+
+	errs := append([]int{http.StatusBadRequest, http.StatusInternalServerError}, op.Errors...)
+	if op.Auth {
+		errs = append(errs, http.StatusUnauthorized)
+	}
+	for _, code := range errs {
+		resps[strconv.Itoa(code)] = object{
+			"description": http.StatusText(code),
+			"content": object{
+				"application/json": object{"schema": ref("responses.ErrorBody")},
+			},
+		}
+	}
+	o["responses"] = resps
+
+	return o
+}
+
+func (b *builder) response(op Operation) object {
+	resp := object{"description": "Success"}
+
+	switch {
+	case op.ContentType != "":
+		resp["content"] = object{op.ContentType: object{"schema": object{"type": "string"}}}
+		return resp
+	case op.Response == nil:
+		resp["content"] = object{"application/json": object{"schema": object{"type": "object"}}}
+		return resp
+	}
+
+	data := b.schema(reflect.TypeOf(op.Response))
+	var schema object
+	switch op.Envelope {
+	case EnvelopeSuccess:
+		schema = envelope(data, nil)
+	case EnvelopeSuccessMeta:
+		schema = envelope(data, b.schema(reflect.TypeOf(entity.Meta{})))
+	default:
+		schema = data
+	}
+
+	resp["content"] = object{"application/json": object{"schema": schema}}
+	return resp
+}
+
+func envelope(data, meta object) object {
+	props := object{
+		"status": object{"type": "string", "example": "Success"},
+		"data":   data,
+	}
+	required := []string{"status", "data"}
+	if meta != nil {
+		props["meta"] = meta
+		required = append(required, "meta")
+	}
+	return object{"type": "object", "required": required, "properties": props}
+}
+
+func (b *builder) queryParameters(t reflect.Type) []object {
+	params := []object{}
+	for _, f := range fields(t, "query") {
+		params = append(params, object{
+			"name":   f.name,
+			"in":     "query",
+			"schema": b.schema(f.typ),
+		})
+	}
+	return params
+}
+
+// schema returns the schema for t, registering named structs as components.
+func (b *builder) schema(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return object{"allOf": []object{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map, reflect.Interface:
+		return object{"type": "object"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return object{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := b.schemas[name]; !ok {
+			// reserve the name first so recursive types terminate
+			b.schemas[name] = object{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return ref(name)
+	}
+	return object{}
+}
+
+func (b *builder) structSchema(t reflect.Type) object {
+	props := object{}
+	required := []string{}
+	for _, f := range fields(t, "json") {
+		props[f.name] = b.schema(f.typ)
+		if !f.omitempty {
+			required = append(required, f.name)
+		}
+	}
+	s := object{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+type field struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+}
+
+// fields lists the exported fields of t under the given tag, flattening embedded structs
+// the same way encoding/json does.
+func fields(t reflect.Type, tag string) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			out = append(out, fields(f.Type, tag)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, field{name: name, typ: f.Type, omitempty: strings.Contains(opts, "omitempty")})
+	}
+	return out
+}
+
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPIPath turns the fiber parameters of path, /users/:userId, into OpenAPI ones, /users/{userId}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func pathParameters(path string) []object {
+	var params []object
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, object{
+				"name":     segment[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   object{"type": "string"},
+			})
+		}
+	}
+	return params
+}
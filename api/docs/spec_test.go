@@ -0,0 +1,76 @@
+package docs_test
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"os"
+	"sort"
+	"testing"
+
+	"segokuning/api/docs"
+	"segokuning/api/handlers"
+	"segokuning/api/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from the current operations")
+
+func TestSpecUpToDate(t *testing.T) {
+	spec, err := docs.Build()
+	if err != nil {
+		t.Fatalf("build spec: %v", err)
+	}
+
+	if *update {
+		if err := os.WriteFile("openapi.json", spec, 0o644); err != nil {
+			t.Fatalf("write spec: %v", err)
+		}
+		return
+	}
+
+	if !bytes.Equal(spec, docs.Spec) {
+		t.Fatal("openapi.json is stale, run `go test ./api/docs -update` and commit the result")
+	}
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	app := fiber.New()
+	routes.RouteRegister(app, handlers.Dependencies{})
+
+	registered := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		// fiber registers a HEAD route for every GET
+		if r.Method == http.MethodHead {
+			continue
+		}
+		registered[r.Method+" "+r.Path] = true
+	}
+
+	documented := map[string]bool{}
+	for _, op := range docs.Operations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	var missing, stale []string
+	for route := range registered {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			stale = append(stale, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+
+	for _, route := range missing {
+		t.Errorf("route %s is not documented in docs.Operations", route)
+	}
+	for _, route := range stale {
+		t.Errorf("docs.Operations documents %s which is not registered", route)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"segokuning/api/responses"
+	"segokuning/internal/logging"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Account struct {
+	Database AccountStore
+	Storage  ObjectStore
+}
+
+type QueryActivity struct {
+	Limit  int `query:"limit"`
+	Offset int `query:"offset"`
+}
+
+func (q QueryActivity) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Limit, validation.Min(1), validation.Max(100)),
+		validation.Field(&q.Offset, validation.Min(0)),
+	)
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (a DeleteAccountRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Password, validation.Required),
+	)
+}
+
+func (a *Account) Delete(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req DeleteAccountRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.Database.Delete(ctx.UserContext(), userIDClaim, req.Password); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account deleted successfully",
+	})
+}
+
+type DeactivateAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (a DeactivateAccountRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Password, validation.Required),
+	)
+}
+
+// Deactivate hides the account until its owner logs in again, the token used here stops working.
+func (a *Account) Deactivate(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req DeactivateAccountRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.Database.Deactivate(ctx.UserContext(), userIDClaim, req.Password); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account deactivated successfully",
+	})
+}
+
+// Activity lists the user's logins, failed logins, account changes and friendship changes, newest first.
+func (a *Account) Activity(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req QueryActivity
+	if err := ctx.QueryParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+
+	result, err := a.Database.Activity(ctx.UserContext(), userIDClaim, req.Limit, req.Offset)
+	if err != nil {
+		return err
+	}
+
+	return responses.SuccessMeta(ctx, result.Data, result.Meta)
+}
+
+// Export answers with a zip of export.json and the profile image, when the user uploaded it. The
+// archive is streamed as it is written, the image is never held in memory whole.
+func (a *Account) Export(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+
+	export, err := a.Database.Export(ctx.UserContext(), userIDClaim)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the writer runs once the handler returned and ctx is reused, it only keeps what it needs
+	userCtx := ctx.UserContext()
+	logger := logging.FromContext(userCtx)
+
+	ctx.Set(fiber.HeaderContentType, "application/zip")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="segokuning-export-%s.zip"`, userIDClaim))
+	ctx.Status(fiber.StatusOK).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// the status is sent already, a failure cuts the archive short and the client sees it broken
+		if err := a.writeExport(userCtx, w, data, export.ImageKey); err != nil {
+			logger.Warn("failed stream export", "error", err)
+		}
+	})
+	return nil
+}
+
+func (a *Account) writeExport(ctx context.Context, w *bufio.Writer, data []byte, imageKey string) error {
+	archive := zip.NewWriter(w)
+
+	f, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	// images the user only linked to aren't ours to hand out, export.json keeps their URL
+	if imageKey != "" {
+		if err := a.addObject(ctx, archive, imageKey, "images/profile"+path.Ext(imageKey)); err != nil {
+			logging.FromContext(ctx).Warn("failed export profile image", "key", imageKey, "error", err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (a *Account) addObject(ctx context.Context, archive *zip.Writer, key, name string) error {
+	body, err := a.Storage.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
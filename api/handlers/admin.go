@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	Admin struct {
+		Database AdminStore
+	}
+
+	QueryAdminUsers struct {
+		Search    string `query:"search"`
+		Role      string `query:"role"`
+		Suspended bool   `query:"suspended"`
+		Limit     int    `query:"limit"`
+		Offset    int    `query:"offset"`
+	}
+
+	// QueryAuditLog takes since and until as RFC 3339 times.
+	QueryAuditLog struct {
+		ActorID    string `query:"actorId"`
+		Action     string `query:"action"`
+		TargetType string `query:"targetType"`
+		TargetID   string `query:"targetId"`
+		Since      string `query:"since"`
+		Until      string `query:"until"`
+		Limit      int    `query:"limit"`
+		Offset     int    `query:"offset"`
+	}
+
+	SuspendRequest struct {
+		Reason string `json:"reason"`
+		// Until is when the suspension ends, none lasts until the user is unsuspended
+		Until *time.Time `json:"until"`
+	}
+
+	SetRoleRequest struct {
+		Role string `json:"role"`
+	}
+
+	ModerationRequest struct {
+		Reason string `json:"reason"`
+	}
+)
+
+func (q QueryAdminUsers) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Role, validation.In(entity.RoleUser, entity.RoleModerator, entity.RoleAdmin)),
+		validation.Field(&q.Limit, validation.Min(1), validation.Max(100)),
+		validation.Field(&q.Offset, validation.Min(0)),
+	)
+}
+
+func (q QueryAuditLog) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.ActorID, is.Int),
+		validation.Field(&q.Since, validation.Date(time.RFC3339)),
+		validation.Field(&q.Until, validation.Date(time.RFC3339)),
+		validation.Field(&q.Limit, validation.Min(1), validation.Max(100)),
+		validation.Field(&q.Offset, validation.Min(0)),
+	)
+}
+
+// entity converts the validated query, an empty time bounds nothing.
+func (q QueryAuditLog) entity() entity.QueryAuditLog {
+	query := entity.QueryAuditLog{
+		ActorID:    q.ActorID,
+		Action:     q.Action,
+		TargetType: q.TargetType,
+		TargetID:   q.TargetID,
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+	}
+	if since, err := time.Parse(time.RFC3339, q.Since); err == nil {
+		query.Since = &since
+	}
+	if until, err := time.Parse(time.RFC3339, q.Until); err == nil {
+		query.Until = &until
+	}
+	return query
+}
+
+func (r SuspendRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Reason, validation.Required, validation.Length(3, 500)),
+		validation.Field(&r.Until, validation.By(func(value interface{}) error {
+			if until, _ := value.(*time.Time); until != nil && !until.After(time.Now()) {
+				return errors.New("must be in the future")
+			}
+			return nil
+		})),
+	)
+}
+
+func (r SetRoleRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Role, validation.Required, validation.In(entity.RoleUser, entity.RoleModerator, entity.RoleAdmin)),
+	)
+}
+
+func (r ModerationRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Reason, validation.Required, validation.Length(3, 500)),
+	)
+}
+
+// actor is the moderator or admin making the request, as the audit log records them.
+func actor(ctx *fiber.Ctx) entity.Actor {
+	role, _ := ctx.Locals("role").(string)
+	return entity.Actor{
+		UserID:    ctx.Locals("user_id").(string),
+		Role:      role,
+		IP:        ctx.IP(),
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+	}
+}
+
+// userParam returns the :userId path parameter, one that isn't a number matches no user.
+func userParam(ctx *fiber.Ctx) (string, error) {
+	userID := ctx.Params("userId")
+	if _, err := strconv.Atoi(userID); err != nil {
+		return "", functions.ErrUserNotFound
+	}
+	return userID, nil
+}
+
+func postParam(ctx *fiber.Ctx) (int, error) {
+	postID, err := strconv.Atoi(ctx.Params("postId"))
+	if err != nil {
+		return 0, functions.ErrPostNotFound
+	}
+	return postID, nil
+}
+
+func (a *Admin) ListUsers(ctx *fiber.Ctx) error {
+	var req QueryAdminUsers
+	if err := ctx.QueryParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+
+	result, err := a.Database.ListUsers(ctx.UserContext(), actor(ctx), entity.QueryAdminUsers{
+		Search:    req.Search,
+		Role:      req.Role,
+		Suspended: req.Suspended,
+		Limit:     req.Limit,
+		Offset:    req.Offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	return responses.SuccessMeta(ctx, result.Data, result.Meta)
+}
+
+// AuditLog searches the audit log, newest first.
+func (a *Admin) AuditLog(ctx *fiber.Ctx) error {
+	var req QueryAuditLog
+	if err := ctx.QueryParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+
+	result, err := a.Database.AuditLog(ctx.UserContext(), actor(ctx), req.entity())
+	if err != nil {
+		return err
+	}
+
+	return responses.SuccessMeta(ctx, result.Data, result.Meta)
+}
+
+func (a *Admin) Suspend(ctx *fiber.Ctx) error {
+	userID, err := userParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req SuspendRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	usr, err := a.Database.Suspend(ctx.UserContext(), actor(ctx), userID, req.Until, req.Reason)
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, usr)
+}
+
+func (a *Admin) Unsuspend(ctx *fiber.Ctx) error {
+	userID, err := userParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	usr, err := a.Database.Unsuspend(ctx.UserContext(), actor(ctx), userID)
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, usr)
+}
+
+func (a *Admin) SetRole(ctx *fiber.Ctx) error {
+	userID, err := userParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req SetRoleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	usr, err := a.Database.SetRole(ctx.UserContext(), actor(ctx), userID, req.Role)
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, usr)
+}
+
+// GetPost answers with any post, friends-only or not.
+func (a *Admin) GetPost(ctx *fiber.Ctx) error {
+	postID, err := postParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	post, err := a.Database.GetPost(ctx.UserContext(), actor(ctx), postID)
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, convertEntityPostsToResponse([]entity.Post{post})[0])
+}
+
+func (a *Admin) DeletePost(ctx *fiber.Ctx) error {
+	postID, err := postParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req ModerationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.Database.DeletePost(ctx.UserContext(), actor(ctx), postID, req.Reason); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post deleted successfully",
+	})
+}
+
+func (a *Admin) DeleteComment(ctx *fiber.Ctx) error {
+	postID, err := postParam(ctx)
+	if err != nil {
+		return err
+	}
+	commentID, err := strconv.ParseInt(ctx.Params("commentId"), 10, 64)
+	if err != nil {
+		return functions.ErrCommentNotFound
+	}
+
+	var req ModerationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.Database.DeleteComment(ctx.UserContext(), actor(ctx), postID, commentID, req.Reason); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Comment deleted successfully",
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"segokuning/api/responses"
 	"segokuning/db/entity"
 	"segokuning/db/functions"
+	"segokuning/internal/metrics"
 	"strconv"
 	"time"
 
@@ -13,8 +14,8 @@ import (
 
 type (
 	Comment struct {
-		PostDatabase   *functions.Post
-		FriendDatabase *functions.Friend
+		Database       CommentStore
+		FriendDatabase FriendStore
 	}
 
 	AddCommentRequest struct {
@@ -34,40 +35,41 @@ func (acr AddCommentRequest) Validate() error {
 func (c *Comment) AddComment(ctx *fiber.Ctx) error {
 	var acr AddCommentRequest
 	if err := ctx.BodyParser(&acr); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	if err := acr.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	userIDClaim := ctx.Locals("user_id").(string)
 	userID, err := strconv.Atoi(userIDClaim)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
+	// a postId that isn't a number can't match any post
 	postID, err := strconv.Atoi(acr.PostID)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return functions.ErrPostNotFound
 	}
 
 	// If post is not found return 404
-	post, err := c.PostDatabase.GetByID(ctx.Context(), postID)
+	post, err := c.Database.GetByID(ctx.UserContext(), postID)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 	if post.Id == 0 {
-		return responses.ErrorNotFound(ctx, "Post not found")
+		return functions.ErrPostNotFound
 	}
 
 	// if post is found but not comes from the user's friend return 400
-	isFriend, err := c.FriendDatabase.IsFriend(ctx.Context(), post.UserID, userID)
+	isFriend, err := c.FriendDatabase.IsFriend(ctx.UserContext(), post.UserID, userID)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 	if !isFriend {
-		return responses.ErrorBadRequest(ctx, "You can only comment on your friend's post")
+		return functions.ErrNotFriendsPost
 	}
 
 	comment := entity.CommentPerPost{
@@ -78,10 +80,11 @@ func (c *Comment) AddComment(ctx *fiber.Ctx) error {
 		},
 	}
 
-	comment, err = c.PostDatabase.AddComment(ctx.Context(), postID, comment)
+	comment, err = c.Database.AddComment(ctx.UserContext(), postID, comment)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	metrics.Comments.Inc()
 
 	return responses.Success(ctx, comment)
 }
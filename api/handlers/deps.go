@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"segokuning/configs"
+	"segokuning/internal/notify"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -9,4 +10,10 @@ import (
 type Dependencies struct {
 	Cfg    configs.Config
 	DbPool *pgxpool.Pool
+	// ReadPool is the read replica, nil when there is none
+	ReadPool *pgxpool.Pool
+
+	// Stores are built with NewStores, tests fill them with db/fakes
+	Stores   Stores
+	Notifier notify.Sender
 }
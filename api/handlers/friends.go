@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"errors"
 	"strconv"
 	"time"
 
 	"segokuning/api/responses"
 	"segokuning/db/entity"
 	"segokuning/db/functions"
+	"segokuning/internal/metrics"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/gofiber/fiber/v2"
@@ -15,7 +15,7 @@ import (
 
 type (
 	Friend struct {
-		Database *functions.Friend
+		Database FriendStore
 	}
 
 	FriendRequest struct {
@@ -92,12 +92,12 @@ func (f *Friend) GetFriends(ctx *fiber.Ctx) error {
 	// Parse query parameters
 	queryParams := new(QueryGetFriends)
 	if err := ctx.QueryParser(queryParams); err != nil {
-		return err
+		return responses.BadRequest(err)
 	}
 
 	err = queryParams.Validate()
 	if err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	// Set default values if not provided
@@ -115,7 +115,7 @@ func (f *Friend) GetFriends(ctx *fiber.Ctx) error {
 	}
 
 	// Call the Get method to fetch friends data
-	friendsResult, err = f.Database.Get(ctx.Context(), entity.QueryGetFriends{
+	friendsResult, err = f.Database.Get(ctx.UserContext(), entity.QueryGetFriends{
 		UserID:      userID,
 		Limit:       queryParams.Limit,
 		Offset:      queryParams.Offset,
@@ -151,46 +151,38 @@ func (f *Friend) AddFriend(ctx *fiber.Ctx) error {
 
 	// Parse request body
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	// Validate request
 	if req.FriendID == "" {
-		return responses.ErrorBadRequest(ctx, "userId is required")
+		return validation.Errors{"userId": validation.ErrRequired}
 	}
 
 	// Get user ID from context
 	userIDClaim := ctx.Locals("user_id").(string)
 	userID, err = strconv.Atoi(userIDClaim)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
-	// Convert friend ID to integer
+	// Convert friend ID to integer, a non numeric ID can't match any user
 	friendID, err = strconv.Atoi(req.FriendID)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return functions.ErrFriendNotFound
 	}
 
 	// Check if user is trying to add self as friend
 	if userID == friendID {
-		return responses.ErrorBadRequest(ctx, "Cannot add self as friend")
+		return functions.ErrNoAddSelf
 	}
 
 	// Add friend
-	err = f.Database.AddFriend(ctx.Context(), userID, friendID)
+	err = f.Database.AddFriend(ctx.UserContext(), userID, friendID)
 	if err != nil {
-		if errors.Is(err, errors.New("NO_ADD_SELF")) {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if errors.Is(err, errors.New("FRIENDSHIP_EXISTS")) {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if errors.Is(err, errors.New("FRIEND_NOT_FOUND")) {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	metrics.Friendships.WithLabelValues("added").Inc()
 
 	return responses.Success(ctx, map[string]interface{}{
 		"message": "Successfully added friend",
@@ -208,41 +200,33 @@ func (f *Friend) DeleteFriend(ctx *fiber.Ctx) error {
 
 	// Parse request body
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	// Validate request
 	if req.FriendID == "" {
-		return responses.ErrorBadRequest(ctx, "userId is required")
+		return validation.Errors{"userId": validation.ErrRequired}
 	}
 
 	// Get user ID from context
 	userIDClaim := ctx.Locals("user_id").(string)
 	userID, err = strconv.Atoi(userIDClaim)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
-	// Convert friend ID to integer
+	// Convert friend ID to integer, a non numeric ID can't match any user
 	friendID, err = strconv.Atoi(req.FriendID)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return functions.ErrFriendNotFound
 	}
 
 	// Delete friend
-	err = f.Database.DeleteFriend(ctx.Context(), userID, friendID)
+	err = f.Database.DeleteFriend(ctx.UserContext(), userID, friendID)
 	if err != nil {
-		if errors.Is(err, errors.New("NO_ADD_SELF")) {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if errors.Is(err, errors.New("FRIENDSHIP_EXISTS")) {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if errors.Is(err, errors.New("FRIEND_NOT_FOUND")) {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	metrics.Friendships.WithLabelValues("removed").Inc()
 
 	return responses.Success(ctx, map[string]interface{}{
 		"message": "Successfully deleted friend",
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"segokuning/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	Health struct {
+		DbPool   Pinger
+		ReadPool Pinger // nil skips the replica check
+		Storage  Pinger // nil skips the storage check
+		Timeout  time.Duration
+	}
+
+	HealthResponse struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}
+)
+
+// Liveness only tells the process is up and serving.
+func (h *Health) Liveness(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(HealthResponse{Status: "ok"})
+}
+
+// Readiness checks the dependencies a request needs, each bounded by Timeout.
+func (h *Health) Readiness(ctx *fiber.Ctx) error {
+	checks := map[string]func(context.Context) error{}
+	if h.DbPool != nil {
+		checks["database"] = h.DbPool.Ping
+	}
+	if h.ReadPool != nil {
+		checks["replica"] = h.ReadPool.Ping
+	}
+	if h.Storage != nil {
+		checks["storage"] = h.Storage.Ping
+	}
+
+	response := HealthResponse{Status: "ok", Checks: map[string]string{}}
+	status := fiber.StatusOK
+
+	for name, check := range checks {
+		c, cancel := context.WithTimeout(ctx.UserContext(), h.Timeout)
+		err := check(c)
+		cancel()
+
+		if err != nil {
+			logging.FromContext(ctx.UserContext()).Warn("readiness check failed", "check", name, "error", err)
+			response.Checks[name] = "unavailable"
+			response.Status = "unavailable"
+			status = fiber.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+
+	return ctx.Status(status).JSON(response)
+}
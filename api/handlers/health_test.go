@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"segokuning/api/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type pinger func(ctx context.Context) error
+
+func (p pinger) Ping(ctx context.Context) error { return p(ctx) }
+
+var (
+	up   = pinger(func(ctx context.Context) error { return nil })
+	down = pinger(func(ctx context.Context) error { return errors.New("connection refused") })
+	// hung answers only once the readiness timeout gives up on it
+	hung = pinger(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+)
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		health     handlers.Health
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{"all up", handlers.Health{DbPool: up, ReadPool: up, Storage: up}, http.StatusOK,
+			map[string]string{"database": "ok", "replica": "ok", "storage": "ok"}},
+		{"database down", handlers.Health{DbPool: down, Storage: up}, http.StatusServiceUnavailable,
+			map[string]string{"database": "unavailable", "storage": "ok"}},
+		{"replica times out", handlers.Health{DbPool: up, ReadPool: hung}, http.StatusServiceUnavailable,
+			map[string]string{"database": "ok", "replica": "unavailable"}},
+		{"storage times out", handlers.Health{DbPool: up, Storage: hung}, http.StatusServiceUnavailable,
+			map[string]string{"database": "ok", "storage": "unavailable"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.health.Timeout = 20 * time.Millisecond
+			app := fiber.New()
+			app.Get("/readyz", tt.health.Readiness)
+
+			start := time.Now()
+			res, err := app.Test(httptest.NewRequest(http.MethodGet, "/readyz", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("readiness took %v, the timeout is %v", elapsed, tt.health.Timeout)
+			}
+
+			var body handlers.HealthResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %+v", res.StatusCode, tt.wantStatus, body)
+			}
+			for name, want := range tt.wantChecks {
+				if body.Checks[name] != want {
+					t.Errorf("check %s = %q, want %q", name, body.Checks[name], want)
+				}
+			}
+			if len(body.Checks) != len(tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", body.Checks, tt.wantChecks)
+			}
+		})
+	}
+}
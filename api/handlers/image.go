@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
 	"segokuning/api/responses"
-	"segokuning/internal/utils"
+	"segokuning/internal/metrics"
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gofiber/fiber/v2"
@@ -13,50 +14,70 @@ import (
 )
 
 type ImageUploader struct {
-	Uploader *utils.ImageUploader
+	Uploader ObjectStore
+	Uploads  UploadStore
 }
 
+const (
+	CodeInvalidFileSize     = "INVALID_FILE_SIZE"
+	CodeUnsupportedMimetype = "UNSUPPORTED_MIMETYPE"
+)
+
 func (i *ImageUploader) Upload(c *fiber.Ctx) error {
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		return responses.ErrorBadRequest(c, "failed get file from form")
+		return responses.ErrorBadRequest(responses.CodeBadRequest, "failed get file from form")
+	}
+
+	observe := func(outcome string) {
+		metrics.Uploads.WithLabelValues(outcome).Inc()
+		metrics.UploadSize.WithLabelValues(outcome).Observe(float64(fileHeader.Size))
 	}
 
 	// check if file size is greater between 10kb and 2mb
 	if fileHeader.Size > 2_000_000 || fileHeader.Size < 10_000 {
-		return c.
-			Status(http.StatusBadRequest).
-			JSON("file size is too large or too small")
+		observe(metrics.UploadInvalidSize)
+		return responses.ErrorBadRequest(CodeInvalidFileSize, "file size is too large or too small")
 	}
 
 	file, err := fileHeader.Open()
 	if err != nil {
-		return c.
-			Status(http.StatusInternalServerError).
-			JSON("failed open image")
+		observe(metrics.UploadError)
+		return fmt.Errorf("failed open image: %w", err)
 	}
 
 	defer file.Close()
 
 	mtype, err := mimetype.DetectReader(file)
 	if err != nil {
-		return c.
-			Status(http.StatusInternalServerError).
-			JSON(fmt.Sprintf("failed get file mimetype: %v", err.Error()))
+		observe(metrics.UploadError)
+		return fmt.Errorf("failed get file mimetype: %w", err)
 	}
 
 	if !(mtype.Is("image/jpeg") || mtype.Is("image/jpg")) {
-		return c.
-			Status(http.StatusBadRequest).
-			JSON("unsupported mimetype")
+		observe(metrics.UploadInvalidType)
+		return responses.ErrorBadRequest(CodeUnsupportedMimetype, "unsupported mimetype")
+	}
+
+	// detecting the mimetype read the head of the file, upload it from the start
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		observe(metrics.UploadError)
+		return fmt.Errorf("failed rewind image: %w", err)
 	}
 
 	filename := fmt.Sprintf("%s.%s", uuid.NewString(), filepath.Ext(fileHeader.Filename))
 
 	path, err := i.Uploader.Upload(c.UserContext(), file, filename)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(err.Error())
+		observe(metrics.UploadError)
+		return fmt.Errorf("failed upload image: %w", err)
+	}
+	// an object without an owner is neither exported nor removed with an account
+	if err := i.Uploads.Add(c.UserContext(), c.Locals("user_id").(string), filename); err != nil {
+		observe(metrics.UploadError)
+		return fmt.Errorf("failed record upload: %w", err)
 	}
+	observe(metrics.UploadSuccess)
 
 	return c.Status(http.StatusOK).JSON(map[string]interface{}{
 		"message": "File uploaded sucessfully",
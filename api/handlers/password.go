@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"segokuning/api/responses"
+	"segokuning/db/functions"
+	"segokuning/internal/logging"
+	"segokuning/internal/notify"
+	"segokuning/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (u *User) ChangePassword(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req ChangePasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	result, err := u.Database.ChangePassword(ctx.UserContext(), userIDClaim, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// every other session is signed out, this one carries on with a fresh token
+	accessToken, err := utils.GenerateAccessToken(u.Cfg, result.CredentialValue, result.Id, result.Role, result.TokenVersion)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password changed successfully",
+		"data": fiber.Map{
+			"name":        result.Name,
+			"phone":       result.Phone,
+			"email":       result.Email,
+			"accessToken": accessToken,
+		},
+	})
+}
+
+func (u *User) ForgotPassword(ctx *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	reset, err := u.PasswordReset.Issue(ctx.UserContext(), string(req.CredentialType), req.CredentialValue)
+	switch {
+	case errors.Is(err, functions.ErrUserNotFound):
+		// answered the same as a sent token so accounts can't be enumerated
+	case err != nil:
+		return err
+	default:
+		// sent after answering, waiting on the notifier would tell a registered credential by
+		// how long the answer takes
+		sendCtx := context.WithoutCancel(ctx.UserContext())
+		msg := notify.Message{
+			Channel: reset.CredentialType,
+			To:      reset.CredentialValue,
+			Subject: "Reset your segokuning password",
+			Body:    fmt.Sprintf("Use this token to reset your password: %s", reset.Token),
+		}
+		go func() {
+			if err := u.Notifier.Send(sendCtx, msg); err != nil {
+				logging.FromContext(sendCtx).Warn("failed send password reset token", "error", err)
+			}
+		}()
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If the credential is registered and verified, a reset token has been sent",
+	})
+}
+
+func (u *User) ResetPassword(ctx *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := u.PasswordReset.Reset(ctx.UserContext(), req.Token, req.NewPassword); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset successfully, login with the new password",
+	})
+}
@@ -3,7 +3,7 @@ package handlers
 import (
 	"segokuning/api/responses"
 	"segokuning/db/entity"
-	"segokuning/db/functions"
+	"segokuning/internal/metrics"
 	"strconv"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -12,7 +12,7 @@ import (
 
 type (
 	Post struct {
-		Database *functions.Post
+		Database PostStore
 	}
 
 	AddPostRequest struct {
@@ -45,9 +45,12 @@ type (
 		CreatedAt string `json:"createdAt"`
 	}
 	CommentPerPost struct {
+		CommentId int64   `json:"commentId"`
 		Comment   string  `json:"comment"`
 		Creator   Creator `json:"creator"`
 		CreatedAt string  `json:"createdAt"`
+		// Hidden is only ever set for moderators, feeds leave hidden comments out
+		Hidden bool `json:"hidden,omitempty"`
 	}
 
 	ElemData struct {
@@ -55,6 +58,7 @@ type (
 		Post     PostData         `json:"post"`
 		Comments []CommentPerPost `json:"comments"`
 		Creator  CreatorPost      `json:"creator"`
+		Hidden   bool             `json:"hidden,omitempty"`
 	}
 
 	Meta struct {
@@ -81,8 +85,8 @@ func (ap AddPostRequest) Validate() error {
 
 func (qgp QueryGetPosts) Validate() error {
 	return validation.ValidateStruct(&qgp,
-		// Limit is optional, default 5
-		validation.Field(&qgp.Limit, validation.Min(1)),
+		// Limit is optional, default 5, at most 100 so a page can't pull a whole feed into the cache
+		validation.Field(&qgp.Limit, validation.Min(1), validation.Max(100)),
 		// Offset is optional, default 0
 		validation.Field(&qgp.Offset, validation.Min(0)),
 	)
@@ -98,15 +102,17 @@ func (qgp QueryGetPosts) ToEntity(userID int) entity.QueryGetPosts {
 	}
 }
 
-func (p *Post) convertEntityPostsToResponse(posts []entity.Post) []ElemData {
+func convertEntityPostsToResponse(posts []entity.Post) []ElemData {
 	var elemData []ElemData
 	for _, post := range posts {
 		var comments []CommentPerPost
 		for _, comment := range post.Comments {
 			comments = append(comments, CommentPerPost{
+				CommentId: comment.Id,
 				Comment:   comment.Comment,
 				Creator:   Creator{UserId: strconv.Itoa(comment.Creator.UserId), Name: comment.Creator.Name, ImageUrl: comment.Creator.ImageUrl, FriendCount: comment.Creator.FriendCount},
 				CreatedAt: comment.CreatedAt.String(),
+				Hidden:    comment.Hidden,
 			})
 		}
 
@@ -127,6 +133,7 @@ func (p *Post) convertEntityPostsToResponse(posts []entity.Post) []ElemData {
 				},
 				CreatedAt: post.CreatedAt.String(),
 			},
+			Hidden: post.Hidden,
 		})
 	}
 
@@ -142,17 +149,17 @@ func (p *Post) AddPost(ctx *fiber.Ctx) error {
 	)
 
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	userIDClaim := ctx.Locals("user_id").(string)
 	userID, err = strconv.Atoi(userIDClaim)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	post := entity.Post{
@@ -161,10 +168,11 @@ func (p *Post) AddPost(ctx *fiber.Ctx) error {
 		UserID:     userID,
 	}
 
-	post, err = p.Database.Add(ctx.Context(), post)
+	post, err = p.Database.Add(ctx.UserContext(), post)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	metrics.Posts.Inc()
 
 	return responses.Success(ctx, post)
 }
@@ -177,11 +185,11 @@ func (p *Post) GetPosts(ctx *fiber.Ctx) error {
 	)
 
 	if err := ctx.QueryParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	if req.Limit == 0 {
@@ -191,23 +199,23 @@ func (p *Post) GetPosts(ctx *fiber.Ctx) error {
 	userIDClaim := ctx.Locals("user_id").(string)
 	userID, err := strconv.Atoi(userIDClaim)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	filter := req.ToEntity(userID)
-	posts, err := p.Database.Get(ctx.Context(), filter)
+	posts, err := p.Database.Get(ctx.UserContext(), filter)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
-	count, err := p.Database.Count(ctx.Context(), filter)
+	count, err := p.Database.Count(ctx.UserContext(), filter)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	response := GetPostsResponse{
 		Message: "Success",
-		Data:    p.convertEntityPostsToResponse(posts),
+		Data:    convertEntityPostsToResponse(posts),
 		Meta: Meta{
 			Limit:  req.Limit,
 			Offset: req.Offset,
@@ -215,5 +223,7 @@ func (p *Post) GetPosts(ctx *fiber.Ctx) error {
 		},
 	}
 
+	// clients keep the feed but revalidate it with the ETag every time
+	ctx.Set(fiber.HeaderCacheControl, "private, no-cache")
 	return responses.Success(ctx, response)
 }
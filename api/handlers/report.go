@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	Report struct {
+		Database ReportStore
+	}
+
+	AddReportRequest struct {
+		TargetType string `json:"targetType"`
+		TargetID   string `json:"targetId"`
+		Reason     string `json:"reason"`
+		Text       string `json:"text"`
+	}
+
+	// ReportResponse is a report as its reporter sees it, without who else reported the target.
+	ReportResponse struct {
+		Id         int64   `json:"id"`
+		TargetType string  `json:"targetType"`
+		TargetID   int64   `json:"targetId"`
+		Reason     string  `json:"reason"`
+		Text       *string `json:"text"`
+		Status     string  `json:"status"`
+		CreatedAt  string  `json:"createdAt"`
+	}
+
+	QueryReports struct {
+		Status     string `query:"status"`
+		TargetType string `query:"targetType"`
+		Limit      int    `query:"limit"`
+		Offset     int    `query:"offset"`
+	}
+
+	ResolveReportRequest struct {
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+		// Until ends a suspension, none lasts until the user is unsuspended
+		Until *time.Time `json:"until"`
+	}
+)
+
+var reportTargets = []interface{}{entity.ReportTargetPost, entity.ReportTargetComment, entity.ReportTargetUser}
+
+func (r AddReportRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.TargetType, validation.Required, validation.In(reportTargets...)),
+		validation.Field(&r.TargetID, validation.Required),
+		validation.Field(&r.Reason, validation.Required, validation.In(
+			entity.ReportReasonSpam,
+			entity.ReportReasonHarassment,
+			entity.ReportReasonHate,
+			entity.ReportReasonNudity,
+			entity.ReportReasonViolence,
+			entity.ReportReasonOther,
+		)),
+		validation.Field(&r.Text, validation.Length(0, 500)),
+	)
+}
+
+func (q QueryReports) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Status, validation.In(entity.ReportOpen, entity.ReportDismissed, entity.ReportActioned)),
+		validation.Field(&q.TargetType, validation.In(reportTargets...)),
+		validation.Field(&q.Limit, validation.Min(1), validation.Max(100)),
+		validation.Field(&q.Offset, validation.Min(0)),
+	)
+}
+
+func (r ResolveReportRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Action, validation.Required, validation.In(entity.ResolveDismiss, entity.ResolveHide, entity.ResolveSuspend)),
+		validation.Field(&r.Reason, validation.Required, validation.Length(3, 500)),
+		validation.Field(&r.Until, validation.By(func(value interface{}) error {
+			if until, _ := value.(*time.Time); until != nil && !until.After(time.Now()) {
+				return errors.New("must be in the future")
+			}
+			return nil
+		})),
+	)
+}
+
+// targetNotFound is what a report on a target id that isn't a number answers.
+var targetNotFound = map[string]error{
+	entity.ReportTargetPost:    functions.ErrPostNotFound,
+	entity.ReportTargetComment: functions.ErrCommentNotFound,
+	entity.ReportTargetUser:    functions.ErrUserNotFound,
+}
+
+// AddReport files a report on a post, a comment or a user for moderators to review.
+func (r *Report) AddReport(ctx *fiber.Ctx) error {
+	var req AddReportRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	reporterID, err := strconv.ParseInt(ctx.Locals("user_id").(string), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	targetID, err := strconv.ParseInt(req.TargetID, 10, 64)
+	if err != nil {
+		return targetNotFound[req.TargetType]
+	}
+
+	report := entity.Report{
+		ReporterID: reporterID,
+		TargetType: req.TargetType,
+		TargetID:   targetID,
+		Reason:     req.Reason,
+	}
+	if req.Text != "" {
+		report.Text = &req.Text
+	}
+
+	report, err = r.Database.Add(ctx.UserContext(), report)
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, ReportResponse{
+		Id:         report.Id,
+		TargetType: report.TargetType,
+		TargetID:   report.TargetID,
+		Reason:     report.Reason,
+		Text:       report.Text,
+		Status:     report.Status,
+		CreatedAt:  report.CreatedAt.String(),
+	})
+}
+
+// Queue lists reports for moderators, the open ones oldest first by default.
+func (r *Report) Queue(ctx *fiber.Ctx) error {
+	var req QueryReports
+	if err := ctx.QueryParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+
+	result, err := r.Database.Queue(ctx.UserContext(), entity.QueryReports{
+		Status:     req.Status,
+		TargetType: req.TargetType,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	return responses.SuccessMeta(ctx, result.Data, result.Meta)
+}
+
+// Resolve dismisses a report, hides the content or suspends its author, closing every open
+// report on the same target.
+func (r *Report) Resolve(ctx *fiber.Ctx) error {
+	reportID, err := strconv.ParseInt(ctx.Params("reportId"), 10, 64)
+	if err != nil {
+		return functions.ErrReportNotFound
+	}
+
+	var req ResolveReportRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	report, err := r.Database.Resolve(ctx.UserContext(), actor(ctx), reportID, entity.Resolution{
+		Action: req.Action,
+		Reason: req.Reason,
+		Until:  req.Until,
+	})
+	if err != nil {
+		return err
+	}
+
+	return responses.Success(ctx, report)
+}
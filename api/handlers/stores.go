@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+	"segokuning/internal/cache"
+	"segokuning/internal/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The stores are what handlers need from db/functions. The functions types implement them
+// against postgres, db/fakes implements them in memory for tests.
+type (
+	UserStore interface {
+		Register(ctx context.Context, usr entity.User) (entity.User, error)
+		Login(ctx context.Context, usr entity.User) (entity.User, error)
+		Session(ctx context.Context, userID string) (entity.Session, error)
+		ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) (entity.User, error)
+		UpdateEmail(ctx context.Context, userID string, email string) (entity.User, error)
+		UpdatePhone(ctx context.Context, userID string, phone string) (entity.User, error)
+		UpdateAccount(ctx context.Context, userID, name, imageURL string) (entity.User, error)
+	}
+
+	VerificationStore interface {
+		Issue(ctx context.Context, userID string, credentialType string) (entity.Verification, error)
+		Verify(ctx context.Context, userID string, credentialType string, code string) (entity.Verification, error)
+	}
+
+	PasswordResetStore interface {
+		Issue(ctx context.Context, credentialType, credentialValue string) (entity.PasswordReset, error)
+		Reset(ctx context.Context, token, newPassword string) error
+	}
+
+	PostStore interface {
+		Add(ctx context.Context, post entity.Post) (entity.Post, error)
+		Get(ctx context.Context, query entity.QueryGetPosts) ([]entity.Post, error)
+		Count(ctx context.Context, query entity.QueryGetPosts) (int, error)
+	}
+
+	// CommentStore looks up the post a comment goes to, a missing post has a zero Id.
+	CommentStore interface {
+		GetByID(ctx context.Context, postID int) (entity.Post, error)
+		AddComment(ctx context.Context, postID int, comment entity.CommentPerPost) (entity.CommentPerPost, error)
+	}
+
+	FriendStore interface {
+		IsFriend(ctx context.Context, userID, friendID int) (bool, error)
+		Get(ctx context.Context, q entity.QueryGetFriends) (entity.FriendData, error)
+		AddFriend(ctx context.Context, userID, friendID int) error
+		DeleteFriend(ctx context.Context, userID, friendID int) error
+	}
+
+	AccountStore interface {
+		Export(ctx context.Context, userID string) (entity.AccountExport, error)
+		Delete(ctx context.Context, userID, password string) error
+		Deactivate(ctx context.Context, userID, password string) error
+		Activity(ctx context.Context, userID string, limit, offset int) (entity.AuditLogData, error)
+	}
+
+	// AdminStore is what moderators and admins do, every call is audited as actor.
+	AdminStore interface {
+		ListUsers(ctx context.Context, actor entity.Actor, q entity.QueryAdminUsers) (entity.AdminUserData, error)
+		AuditLog(ctx context.Context, actor entity.Actor, q entity.QueryAuditLog) (entity.AuditLogData, error)
+		Suspend(ctx context.Context, actor entity.Actor, userID string, until *time.Time, reason string) (entity.AdminUser, error)
+		Unsuspend(ctx context.Context, actor entity.Actor, userID string) (entity.AdminUser, error)
+		SetRole(ctx context.Context, actor entity.Actor, userID, role string) (entity.AdminUser, error)
+		GetPost(ctx context.Context, actor entity.Actor, postID int) (entity.Post, error)
+		DeletePost(ctx context.Context, actor entity.Actor, postID int, reason string) error
+		DeleteComment(ctx context.Context, actor entity.Actor, postID int, commentID int64, reason string) error
+	}
+
+	// ReportStore files reports from users and keeps the moderation queue, resolving a report
+	// is audited as actor.
+	ReportStore interface {
+		Add(ctx context.Context, report entity.Report) (entity.Report, error)
+		Queue(ctx context.Context, q entity.QueryReports) (entity.ReportData, error)
+		Resolve(ctx context.Context, actor entity.Actor, reportID int64, res entity.Resolution) (entity.Report, error)
+	}
+
+	// UploadStore records who uploaded each object, erasing or exporting an account only touches
+	// its own.
+	UploadStore interface {
+		Add(ctx context.Context, userID, key string) error
+	}
+
+	// ObjectStore holds uploaded images, utils.ImageUploader implements it against S3.
+	ObjectStore interface {
+		Upload(ctx context.Context, file io.Reader, filename string) (string, error)
+		Download(ctx context.Context, key string) (io.ReadCloser, error)
+		Ping(ctx context.Context) error
+	}
+
+	// Pinger is a dependency the readiness probe checks.
+	Pinger interface {
+		Ping(ctx context.Context) error
+	}
+)
+
+type Stores struct {
+	Users         UserStore
+	Verification  VerificationStore
+	PasswordReset PasswordResetStore
+	Posts         PostStore
+	Comments      CommentStore
+	Friends       FriendStore
+	Accounts      AccountStore
+	Admin         AdminStore
+	Reports       ReportStore
+	Uploads       UploadStore
+	Objects       ObjectStore
+}
+
+// NewStores backs every store with postgres and S3. Feeds and friend lists read from readPool
+// when it isn't nil, feeds are cached in c when it isn't nil.
+func NewStores(dbPool, readPool *pgxpool.Pool, c cache.Cache, config configs.Config) Stores {
+	return Stores{
+		Users:         functions.NewUser(dbPool, config).WithCache(c),
+		Verification:  functions.NewVerification(dbPool, config),
+		PasswordReset: functions.NewPasswordReset(dbPool, config),
+		Posts:         functions.NewPost(dbPool, config).WithReplica(readPool).WithCache(c),
+		Comments:      functions.NewPost(dbPool, config).WithCache(c),
+		Friends:       functions.NewFriend(dbPool, config).WithReplica(readPool).WithCache(c),
+		Accounts:      functions.NewAccount(dbPool, config).WithCache(c),
+		Admin:         functions.NewAdmin(dbPool, config).WithCache(c),
+		Reports:       functions.NewReport(dbPool, config).WithCache(c),
+		Uploads:       functions.NewUpload(dbPool, config),
+		Objects:       utils.NewImageUploader(config),
+	}
+}
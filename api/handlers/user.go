@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"errors"
-	"net/http"
+	"fmt"
 	"regexp"
 	"segokuning/api/responses"
+	"segokuning/configs"
 	"segokuning/db/entity"
-	"segokuning/db/functions"
+	"segokuning/internal/metrics"
+	"segokuning/internal/notify"
+	"segokuning/internal/password"
 	"segokuning/internal/utils"
 
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -15,7 +18,11 @@ import (
 )
 
 type User struct {
-	Database *functions.User
+	Cfg           configs.Config
+	Database      UserStore
+	Verification  VerificationStore
+	PasswordReset PasswordResetStore
+	Notifier      notify.Sender
 }
 
 type CredentialType string
@@ -39,6 +46,21 @@ type RegisterRequest struct {
 	Password        string         `json:"password"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ForgotPasswordRequest struct {
+	CredentialType  CredentialType `json:"credentialType"`
+	CredentialValue string         `json:"credentialValue"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
 type UpdateEmailRequest struct {
 	Email string `json:"email"`
 }
@@ -56,7 +78,8 @@ func (a AuthRequest) Validate() error {
 	return validation.ValidateStruct(&a,
 		validation.Field(&a.CredentialType, validation.Required, validation.In(Phone, Email)),
 		validation.Field(&a.CredentialValue, validation.Required),
-		validation.Field(&a.Password, validation.Required, validation.Length(5, 15)),
+		// passwords set under an older policy must still login, only the bcrypt bound applies
+		validation.Field(&a.Password, validation.Required, validation.Length(0, password.MaxLength)),
 		validation.Field(&a.CredentialValue, validation.By(func(value interface{}) error {
 			strValue := value.(string)
 			if a.CredentialType == "email" {
@@ -78,7 +101,7 @@ func (a RegisterRequest) Validate() error {
 		validation.Field(&a.CredentialType, validation.Required, validation.In(Phone, Email)),
 		validation.Field(&a.CredentialValue, validation.Required),
 		validation.Field(&a.Name, validation.Required, validation.Length(5, 15)),
-		validation.Field(&a.Password, validation.Required, validation.Length(5, 15)),
+		validation.Field(&a.Password, passwordRules...),
 		validation.Field(&a.CredentialValue, validation.By(func(value interface{}) error {
 			strValue := value.(string)
 			if a.CredentialType == "email" {
@@ -95,6 +118,44 @@ func (a RegisterRequest) Validate() error {
 	)
 }
 
+// passwordRules apply to every new password, registration or otherwise.
+var passwordRules = []validation.Rule{
+	validation.Required,
+	validation.Length(password.MinLength, password.MaxLength),
+	validation.By(func(value interface{}) error {
+		strValue := value.(string)
+		// bcrypt reads at most 72 bytes, multibyte characters can pass the length rule above
+		if len(strValue) > password.MaxLength {
+			return validation.NewError("validation_password_too_long", fmt.Sprintf("must be at most %d bytes", password.MaxLength))
+		}
+		if password.IsCommon(strValue) {
+			return validation.NewError("validation_password_common", "must not be a commonly used password")
+		}
+		return nil
+	}),
+}
+
+func (a ChangePasswordRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.CurrentPassword, validation.Required),
+		validation.Field(&a.NewPassword, passwordRules...),
+	)
+}
+
+func (a ForgotPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.CredentialType, validation.Required, validation.In(Phone, Email)),
+		validation.Field(&a.CredentialValue, validation.Required),
+	)
+}
+
+func (a ResetPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Token, validation.Required),
+		validation.Field(&a.NewPassword, passwordRules...),
+	)
+}
+
 func (a UpdateEmailRequest) Validate() error {
 	return validation.ValidateStruct(&a,
 		validation.Field(&a.Email, validation.Required, validation.By(func(value interface{}) error {
@@ -148,11 +209,11 @@ func (u *User) Register(ctx *fiber.Ctx) error {
 	var req RegisterRequest
 	var userValue *string
 	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.SendStatus(http.StatusBadRequest)
+		return responses.BadRequest(err)
 	}
 
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	usr := entity.User{
@@ -164,16 +225,14 @@ func (u *User) Register(ctx *fiber.Ctx) error {
 
 	result, err := u.Database.Register(ctx.UserContext(), usr)
 	if err != nil {
-		if err.Error() == "EXISTING_USERNAME" {
-			return responses.ErrorConflict(ctx, err.Error())
-		}
-
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	metrics.Registrations.Inc()
+	u.sendVerification(ctx, result.Id, usr.CredentialType)
 
-	accessToken, err := utils.GenerateAccessToken(result.CredentialValue, result.Id)
+	accessToken, err := utils.GenerateAccessToken(u.Cfg, result.CredentialValue, result.Id, result.Role, result.TokenVersion)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	if req.CredentialType == "phone" {
@@ -196,12 +255,12 @@ func (u *User) Login(ctx *fiber.Ctx) error {
 	// Parse request body
 	var req AuthRequest
 	if err := ctx.BodyParser(&req); err != nil {
-		return err
+		return responses.BadRequest(err)
 	}
 
 	// Validate request body
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	usr := entity.User{
@@ -213,21 +272,13 @@ func (u *User) Login(ctx *fiber.Ctx) error {
 	// login user
 	result, err := u.Database.Login(ctx.UserContext(), usr)
 	if err != nil {
-		if err.Error() == "USER_NOT_FOUND" {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-
-		if err.Error() == "INVALID_PASSWORD" {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	// generate access token
-	accessToken, err := utils.GenerateAccessToken(result.CredentialValue, result.Id)
+	accessToken, err := utils.GenerateAccessToken(u.Cfg, result.CredentialValue, result.Id, result.Role, result.TokenVersion)
 	if err != nil {
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -246,12 +297,12 @@ func (u *User) UpdateEmail(ctx *fiber.Ctx) error {
 	// Parse request body
 	var req UpdateEmailRequest
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	// Validate request body
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	var user entity.User
@@ -259,17 +310,9 @@ func (u *User) UpdateEmail(ctx *fiber.Ctx) error {
 
 	// Update user email
 	if user, err = u.Database.UpdateEmail(ctx.UserContext(), userIDClaim, req.Email); err != nil {
-		if err.Error() == "EMAIL_EXISTS" {
-			return responses.ErrorConflict(ctx, err.Error())
-		}
-		if err.Error() == "EMAIL_ALREADY_SET" {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if err.Error() == "USER_NOT_FOUND" {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	u.sendVerification(ctx, userIDClaim, notify.ChannelEmail)
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Email updated successfully",
@@ -286,12 +329,12 @@ func (u *User) UpdatePhone(ctx *fiber.Ctx) error {
 	// Parse request body
 	var req UpdatePhoneRequest
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	// Validate request body
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	var user entity.User
@@ -299,17 +342,9 @@ func (u *User) UpdatePhone(ctx *fiber.Ctx) error {
 
 	// Update user phone
 	if user, err = u.Database.UpdatePhone(ctx.UserContext(), userIDClaim, req.Phone); err != nil {
-		if err.Error() == "PHONE_EXISTS" {
-			return responses.ErrorConflict(ctx, err.Error())
-		}
-		if err.Error() == "PHONE_ALREADY_SET" {
-			return responses.ErrorBadRequest(ctx, err.Error())
-		}
-		if err.Error() == "USER_NOT_FOUND" {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
+	u.sendVerification(ctx, userIDClaim, notify.ChannelPhone)
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Phone updated successfully",
@@ -326,12 +361,12 @@ func (u *User) UpdateAccount(ctx *fiber.Ctx) error {
 	// Parse request body
 	var req UpdateAccountRequest
 	if err := ctx.BodyParser(&req); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return responses.BadRequest(err)
 	}
 
 	// Validate request body
 	if err := req.Validate(); err != nil {
-		return responses.ErrorBadRequest(ctx, err.Error())
+		return err
 	}
 
 	var user entity.User
@@ -340,10 +375,7 @@ func (u *User) UpdateAccount(ctx *fiber.Ctx) error {
 	// Update user account
 	user, err = u.Database.UpdateAccount(ctx.UserContext(), userIDClaim, req.Name, req.ImageURL)
 	if err != nil {
-		if err.Error() == "USER_NOT_FOUND" {
-			return responses.ErrorNotFound(ctx, err.Error())
-		}
-		return responses.ErrorInternalServerError(ctx, err.Error())
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"segokuning/api/responses"
+	"segokuning/internal/logging"
+	"segokuning/internal/notify"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v2"
+)
+
+type RequestVerificationRequest struct {
+	CredentialType CredentialType `json:"credentialType"`
+}
+
+type VerifyRequest struct {
+	CredentialType CredentialType `json:"credentialType"`
+	Code           string         `json:"code"`
+}
+
+func (a RequestVerificationRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.CredentialType, validation.Required, validation.In(Phone, Email)),
+	)
+}
+
+func (a VerifyRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.CredentialType, validation.Required, validation.In(Phone, Email)),
+		validation.Field(&a.Code, validation.Required, validation.Length(6, 6)),
+	)
+}
+
+func (u *User) RequestVerification(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req RequestVerificationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	verification, err := u.Verification.Issue(ctx.UserContext(), userIDClaim, string(req.CredentialType))
+	if err != nil {
+		return err
+	}
+
+	if err := u.Notifier.Send(ctx.UserContext(), verificationMessage(verification.CredentialType, verification.CredentialValue, verification.Code)); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Verification code sent",
+		"data": fiber.Map{
+			"credentialType": verification.CredentialType,
+			"expiresAt":      verification.ExpiresAt,
+		},
+	})
+}
+
+func (u *User) Verify(ctx *fiber.Ctx) error {
+	userIDClaim := ctx.Locals("user_id").(string)
+	var req VerifyRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return responses.BadRequest(err)
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	verification, err := u.Verification.Verify(ctx.UserContext(), userIDClaim, string(req.CredentialType), req.Code)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Credential verified successfully",
+		"data": fiber.Map{
+			"credentialType":  verification.CredentialType,
+			"credentialValue": verification.CredentialValue,
+		},
+	})
+}
+
+// sendVerification sends a code for a credential that was just linked. The credential is already
+// saved, so a failure here is only logged and the user can ask for a new code.
+func (u *User) sendVerification(ctx *fiber.Ctx, userID, credentialType string) {
+	log := logging.FromContext(ctx.UserContext())
+
+	verification, err := u.Verification.Issue(ctx.UserContext(), userID, credentialType)
+	if err != nil {
+		log.Warn("failed issue verification code", "credential_type", credentialType, "error", err)
+		return
+	}
+
+	err = u.Notifier.Send(ctx.UserContext(), verificationMessage(verification.CredentialType, verification.CredentialValue, verification.Code))
+	if err != nil {
+		log.Warn("failed send verification code", "credential_type", credentialType, "error", err)
+	}
+}
+
+func verificationMessage(channel, to, code string) notify.Message {
+	return notify.Message{
+		Channel: channel,
+		To:      to,
+		Subject: "Your segokuning verification code",
+		Body:    fmt.Sprintf("Your verification code is %s", code),
+	}
+}
@@ -1,16 +1,27 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"segokuning/api/responses"
 	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	jwtware "github.com/gofiber/jwt/v2"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func JWTAuth() fiber.Handler {
-	config, _ := configs.LoadConfig()
+// Sessions reports the token version a user's access tokens must carry and the status of their
+// account. Tokens signed before a password change carry an older version.
+type Sessions interface {
+	Session(ctx context.Context, userID string) (entity.Session, error)
+}
 
+func JWTAuth(config configs.Config, sessions Sessions) fiber.Handler {
 	return jwtware.New(jwtware.Config{
 		SigningKey: []byte(config.JWTSecret),
 		Filter: func(c *fiber.Ctx) bool {
@@ -23,19 +34,18 @@ func JWTAuth() fiber.Handler {
 			return c.Next()
 		},
 		SuccessHandler: func(c *fiber.Ctx) error {
-			token := c.Locals("user").(*jwt.Token)
-			claims := token.Claims.(jwt.MapClaims)
-
-			userID := claims["user_id"].(string)
+			userID, err := authenticate(c, sessions)
+			if err != nil {
+				return err
+			}
 			c.Locals("user_id", userID)
+			c.Locals("role", role(c))
 			return c.Next()
 		},
 	})
 }
 
-func OptionalJWTAuth() fiber.Handler {
-	config, _ := configs.LoadConfig()
-
+func OptionalJWTAuth(config configs.Config, sessions Sessions) fiber.Handler {
 	return jwtware.New(jwtware.Config{
 		SigningKey: []byte(config.JWTSecret),
 		Filter: func(c *fiber.Ctx) bool {
@@ -45,12 +55,81 @@ func OptionalJWTAuth() fiber.Handler {
 			return c.Next()
 		},
 		SuccessHandler: func(c *fiber.Ctx) error {
-			token := c.Locals("user").(*jwt.Token)
-			claims := token.Claims.(jwt.MapClaims)
-
-			userID := claims["user_id"].(string)
+			userID, err := authenticate(c, sessions)
+			if errors.Is(err, fiber.ErrUnauthorized) {
+				return c.Next()
+			}
+			if err != nil {
+				return err
+			}
 			c.Locals("user_id", userID)
+			c.Locals("role", role(c))
 			return c.Next()
 		},
 	})
 }
+
+// RequireRole refuses users without one of roles, it runs after JWTAuth. The role comes from the
+// token, changing a role bumps the token version so tokens with the old one are refused.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		held, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if held == r {
+				return c.Next()
+			}
+		}
+		return responses.ErrorForbidden("this action needs the " + strings.Join(roles, " or ") + " role")
+	}
+}
+
+// role returns the role claim of an authenticated token, tokens signed before roles existed are users.
+func role(c *fiber.Ctx) string {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	if r, ok := claims["role"].(string); ok && r != "" {
+		return r
+	}
+	return entity.RoleUser
+}
+
+// authenticate returns the user of a token jwtware has already checked the signature of,
+// refusing it when the user's sessions were revoked after it was signed or the account isn't active.
+func authenticate(c *fiber.Ctx, sessions Sessions) (string, error) {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return "", fiber.ErrUnauthorized
+	}
+	if sessions == nil {
+		return userID, nil
+	}
+
+	// tokens signed before versions existed have none and count as version 0
+	version, _ := claims["ver"].(float64)
+
+	session, err := sessions.Session(c.UserContext(), userID)
+	// versions only grow, a token newer than a cached session was signed after it was cached
+	if cache, ok := sessions.(*SessionCache); ok && err == nil && int(version) > session.TokenVersion {
+		session, err = cache.Refresh(c.UserContext(), userID)
+	}
+	if errors.Is(err, functions.ErrUserNotFound) {
+		return "", fiber.ErrUnauthorized
+	}
+	if err != nil {
+		return "", err
+	}
+	if int(version) != session.TokenVersion {
+		return "", fiber.ErrUnauthorized
+	}
+
+	switch {
+	case session.Suspended(time.Now()):
+		return "", &functions.SuspendedError{Until: session.SuspendedUntil}
+	case session.Status == entity.StatusDeactivated:
+		return "", fiber.ErrUnauthorized
+	}
+
+	return userID, nil
+}
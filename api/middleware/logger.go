@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/db/functions"
+	"segokuning/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestID reuses the caller's X-Request-ID or generates one, and echoes it back.
+func RequestID() fiber.Handler {
+	return requestid.New()
+}
+
+// Origin carries the caller's IP and user agent in the user context, the account events the
+// request leads to are audited with them.
+func Origin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(functions.WithOrigin(c.UserContext(), c.IP(), c.Get(fiber.HeaderUserAgent)))
+		return c.Next()
+	}
+}
+
+// Logger writes one structured line per request. It must run after RequestID and Tracing.
+func Logger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		requestID, _ := c.Locals("requestid").(string)
+		reqLogger := slog.Default().With(slog.String("request_id", requestID))
+		c.SetUserContext(logging.WithContext(c.UserContext(), reqLogger))
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("route", c.Route().Path),
+			slog.String("path", c.Path()),
+			slog.Duration("duration", time.Since(start)),
+		}
+
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.HasTraceID() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+
+		// user_id is set by JWTAuth further down the chain
+		if userID, ok := c.Locals("user_id").(string); ok {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+
+		if err != nil {
+			resolved := responses.Resolve(err)
+			status = resolved.Status
+			attrs = append(attrs, slog.String("code", resolved.Code), slog.String("error", err.Error()))
+		}
+
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs = append(attrs, slog.Int("status", status))
+
+		reqLogger.LogAttrs(c.UserContext(), level, "request", attrs...)
+
+		return err
+	}
+}
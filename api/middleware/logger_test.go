@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"segokuning/api/middleware"
+	"segokuning/api/responses"
+	"segokuning/db/functions"
+	"segokuning/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line is not JSON: %s", scanner.Bytes())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggerFields(t *testing.T) {
+	buf := captureLogs(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+	app.Use(middleware.RequestID(), middleware.Logger())
+	// stands in for JWTAuth, which sets user_id further down the chain
+	app.Get("/v1/post/:id", func(c *fiber.Ctx) error {
+		c.Locals("user_id", "42")
+		logging.FromContext(c.UserContext()).Info("handling")
+		if c.Params("id") == "missing" {
+			return functions.ErrPostNotFound
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/post/missing", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "req-123")
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get(fiber.HeaderXRequestID); got != "req-123" {
+		t.Fatalf("X-Request-ID echoed = %q, want req-123", got)
+	}
+
+	lines := logLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("%d log lines, want 2: %v", len(lines), lines)
+	}
+	handling, request := lines[0], lines[1]
+
+	if handling["request_id"] != "req-123" {
+		t.Errorf("handler log request_id = %v, want req-123", handling["request_id"])
+	}
+	for field, want := range map[string]interface{}{
+		"msg":        "request",
+		"level":      "WARN",
+		"request_id": "req-123",
+		"user_id":    "42",
+		"route":      "/v1/post/:id",
+		"path":       "/v1/post/missing",
+		"status":     float64(http.StatusNotFound),
+		"code":       "POST_NOT_FOUND",
+	} {
+		if request[field] != want {
+			t.Errorf("request log %s = %v, want %v", field, request[field], want)
+		}
+	}
+}
+
+func TestLoggerGeneratesRequestID(t *testing.T) {
+	buf := captureLogs(t)
+
+	app := fiber.New()
+	app.Use(middleware.RequestID(), middleware.Logger())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	lines := logLines(t, buf)
+	if len(lines) != 1 {
+		t.Fatalf("%d log lines, want 1", len(lines))
+	}
+	id := res.Header.Get(fiber.HeaderXRequestID)
+	if id == "" || lines[0]["request_id"] != id {
+		t.Fatalf("request_id = %v, X-Request-ID = %q", lines[0]["request_id"], id)
+	}
+	if _, ok := lines[0]["user_id"]; ok {
+		t.Errorf("anonymous request logged a user_id: %v", lines[0])
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics records request count and latency by route template.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+
+		// errors are rendered by the app ErrorHandler after this returns,
+		// resolve them here to know the status that will be sent
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = responses.Resolve(err).Status
+		}
+
+		labels := []string{c.Method(), c.Route().Path, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
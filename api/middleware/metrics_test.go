@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"segokuning/api/middleware"
+	"segokuning/api/responses"
+	"segokuning/db/functions"
+	"segokuning/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsRouteTemplate(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+	app.Use(middleware.Metrics())
+	app.Get("/v1/metrics-test/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return functions.ErrPostNotFound
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	count := func(route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, status))
+	}
+	before, beforeMissing := count("/v1/metrics-test/:id", "204"), count("/v1/metrics-test/:id", "404")
+
+	for _, path := range []string{"/v1/metrics-test/1", "/v1/metrics-test/2", "/v1/metrics-test/missing"} {
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if got := count("/v1/metrics-test/:id", "204") - before; got != 2 {
+		t.Errorf("%v requests counted under the route template, want 2", got)
+	}
+	// the error handler renders the status after the middleware returns
+	if got := count("/v1/metrics-test/:id", "404") - beforeMissing; got != 1 {
+		t.Errorf("%v not found requests counted, want 1", got)
+	}
+	if got := count("/v1/metrics-test/1", "204"); got != 0 {
+		t.Errorf("%v requests counted under the raw path, want 0", got)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"segokuning/configs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimit allows limit.Max requests per limit.Window for every key, answering 429 past that.
+// Each call keeps its own counters so budgets don't leak between endpoints.
+func RateLimit(limit configs.RateLimit, key func(*fiber.Ctx) string) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return limit.Max <= 0
+		},
+		Max:          limit.Max,
+		Expiration:   limit.Window,
+		KeyGenerator: key,
+		LimitReached: func(c *fiber.Ctx) error {
+			return fiber.ErrTooManyRequests
+		},
+	})
+}
+
+// TrustProxy makes c.IP() the client address config.ProxyHeader carries, taken only from
+// connections coming from config.TrustedProxies. Without a header c.IP() is the peer address,
+// the load balancer's when there is one.
+func TrustProxy(app fiber.Config, config configs.Config) fiber.Config {
+	if config.ProxyHeader == "" {
+		return app
+	}
+	app.ProxyHeader = config.ProxyHeader
+	app.EnableTrustedProxyCheck = true
+	app.TrustedProxies = config.TrustedProxies
+	// a list such as X-Forwarded-For resolves to its first valid address
+	app.EnableIPValidation = true
+	return app
+}
+
+// ByIP keys a limit on the client address, see TrustProxy. The address is copied, the limiter
+// keeps the key past the request whose buffer c.IP() points into.
+func ByIP(c *fiber.Ctx) string {
+	return strings.Clone(c.IP())
+}
+
+// ByUser keys a limit on the authenticated user, it must run after JWTAuth.
+func ByUser(c *fiber.Ctx) string {
+	userID, _ := c.Locals("user_id").(string)
+	return userID
+}
+
+// ByCredential keys a limit on the credential a login or registration targets,
+// so one account can't be brute forced from many addresses.
+func ByCredential(c *fiber.Ctx) string {
+	var body struct {
+		CredentialType  string `json:"credentialType"`
+		CredentialValue string `json:"credentialValue"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil || body.CredentialValue == "" {
+		// unparsable bodies are rejected by the handler, share one bucket per address
+		return "ip:" + c.IP()
+	}
+	return body.CredentialType + ":" + strings.ToLower(body.CredentialValue)
+}
@@ -0,0 +1,74 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"segokuning/api/middleware"
+	"segokuning/configs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestByIPBehindProxy(t *testing.T) {
+	limit := configs.RateLimit{Max: 1, Window: time.Minute}
+
+	tests := []struct {
+		name    string
+		proxy   configs.Config
+		wantIPs []string // what the handler sees for the two clients
+		wantOK  int      // requests let through out of four, two per client
+	}{
+		// app.Test connects from 0.0.0.0, the load balancer in these cases
+		{"no proxy header", configs.Config{}, []string{"0.0.0.0", "0.0.0.0"}, 1},
+		{"trusted proxy", configs.Config{ProxyHeader: "X-Real-IP", TrustedProxies: []string{"0.0.0.0"}},
+			[]string{"203.0.113.7", "198.51.100.2"}, 2},
+		{"untrusted proxy", configs.Config{ProxyHeader: "X-Real-IP", TrustedProxies: []string{"10.0.0.0/8"}},
+			[]string{"0.0.0.0", "0.0.0.0"}, 1},
+		{"forwarded list", configs.Config{ProxyHeader: "X-Forwarded-For", TrustedProxies: []string{"0.0.0.0/32"}},
+			[]string{"203.0.113.7", "198.51.100.2"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(middleware.TrustProxy(fiber.Config{}, tt.proxy))
+			var seen []string
+			app.Post("/login", middleware.RateLimit(limit, middleware.ByIP), func(c *fiber.Ctx) error {
+				// c.IP() points into the request buffer, reused once the handler returns
+				seen = append(seen, strings.Clone(c.IP()))
+				return c.SendStatus(http.StatusNoContent)
+			})
+
+			ok := 0
+			for _, client := range []string{"203.0.113.7", "198.51.100.2", "203.0.113.7", "198.51.100.2"} {
+				req := httptest.NewRequest(http.MethodPost, "/login", nil)
+				header := client
+				if tt.proxy.ProxyHeader == "X-Forwarded-For" {
+					header = client + ", 10.1.2.3"
+				}
+				req.Header.Set("X-Real-IP", header)
+				req.Header.Set("X-Forwarded-For", header)
+				res, err := app.Test(req, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+				if res.StatusCode == http.StatusNoContent {
+					ok++
+				}
+			}
+
+			if ok != tt.wantOK {
+				t.Fatalf("%d requests let through, want %d", ok, tt.wantOK)
+			}
+			for i, want := range tt.wantIPs[:ok] {
+				if seen[i] != want {
+					t.Errorf("client %d seen as %s, want %s", i, seen[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"segokuning/db/entity"
+)
+
+// sessionCacheSweep is how many sessions the cache holds before it drops the expired ones.
+const sessionCacheSweep = 10000
+
+// SessionCache keeps the sessions JWTAuth looks up for ttl, so a user's requests don't each hit
+// the database. A revoked session or a suspension is seen within ttl, a token newer than the
+// cached session refreshes it right away.
+type SessionCache struct {
+	sessions Sessions
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedSession
+}
+
+type cachedSession struct {
+	session   entity.Session
+	expiresAt time.Time
+}
+
+// NewSessionCache caches the lookups of sessions, a ttl of zero or less doesn't cache at all.
+func NewSessionCache(sessions Sessions, ttl time.Duration) Sessions {
+	if sessions == nil || ttl <= 0 {
+		return sessions
+	}
+	return &SessionCache{
+		sessions: sessions,
+		ttl:      ttl,
+		entries:  map[string]cachedSession{},
+	}
+}
+
+func (s *SessionCache) Session(ctx context.Context, userID string) (entity.Session, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[userID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.session, nil
+	}
+
+	return s.Refresh(ctx, userID)
+}
+
+// Refresh looks the session of userID up again, errors aren't cached so an unknown user stays
+// unknown and a failed lookup is retried.
+func (s *SessionCache) Refresh(ctx context.Context, userID string) (entity.Session, error) {
+	session, err := s.sessions.Session(ctx, userID)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) >= sessionCacheSweep {
+		for id, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, id)
+			}
+		}
+	}
+	s.entries[userID] = cachedSession{session: session, expiresAt: now.Add(s.ttl)}
+	return session, nil
+}
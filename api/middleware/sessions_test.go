@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"segokuning/api/middleware"
+	"segokuning/api/responses"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var config = configs.Config{JWTSecret: "middleware-test-secret"}
+
+// sessions is one user's session, counting how often it is looked up.
+type sessions struct {
+	mu      sync.Mutex
+	session entity.Session
+	lookups int
+}
+
+func (s *sessions) Session(ctx context.Context, userID string) (entity.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	return s.session, nil
+}
+
+func (s *sessions) set(session entity.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+}
+
+func get(t *testing.T, app *fiber.App, version int) (int, string) {
+	t.Helper()
+
+	token, err := utils.GenerateAccessToken(config, "budi@example.com", "1", entity.RoleUser, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var body responses.ErrorBody
+	_ = json.NewDecoder(res.Body).Decode(&body)
+	return res.StatusCode, body.Code
+}
+
+func newApp(s middleware.Sessions) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+	app.Get("/", middleware.JWTAuth(config, s), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+	return app
+}
+
+func TestSessionCache(t *testing.T) {
+	store := &sessions{session: entity.Session{Status: entity.StatusActive}}
+	app := newApp(middleware.NewSessionCache(store, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if status, _ := get(t, app, 0); status != http.StatusNoContent {
+			t.Fatalf("status = %d, want %d", status, http.StatusNoContent)
+		}
+	}
+	if store.lookups != 1 {
+		t.Fatalf("%d lookups for three requests, want 1", store.lookups)
+	}
+
+	// a password change hands out a newer token, it works right away
+	store.set(entity.Session{TokenVersion: 1, Status: entity.StatusActive})
+	if status, _ := get(t, app, 1); status != http.StatusNoContent {
+		t.Fatalf("newer token status = %d, want %d", status, http.StatusNoContent)
+	}
+	if status, _ := get(t, app, 0); status != http.StatusUnauthorized {
+		t.Fatalf("older token status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if store.lookups != 2 {
+		t.Fatalf("%d lookups, want 2", store.lookups)
+	}
+}
+
+func TestJWTAuthStatus(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name       string
+		session    entity.Session
+		wantStatus int
+		wantCode   string
+	}{
+		{"active", entity.Session{Status: entity.StatusActive}, http.StatusNoContent, ""},
+		{"suspended", entity.Session{Status: entity.StatusSuspended}, http.StatusForbidden, "ACCOUNT_SUSPENDED"},
+		{"suspended until", entity.Session{Status: entity.StatusSuspended, SuspendedUntil: &future}, http.StatusForbidden, "ACCOUNT_SUSPENDED"},
+		{"suspension over", entity.Session{Status: entity.StatusSuspended, SuspendedUntil: &past}, http.StatusNoContent, ""},
+		{"deactivated", entity.Session{Status: entity.StatusDeactivated}, http.StatusUnauthorized, "UNAUTHORIZED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(&sessions{session: tt.session})
+			status, code := get(t, app, 0)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Fatalf("got %d %q, want %d %q", status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"segokuning/api/middleware"
+	"segokuning/api/responses"
+	"segokuning/configs"
+	"segokuning/internal/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs the propagators tracing.Setup does and a provider recording every span,
+// both restored when the test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	if _, err := tracing.Setup(context.Background(), configs.Config{TracingExporter: tracing.ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestTracingContinuesTraceparent(t *testing.T) {
+	recorder := recordSpans(t)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	var (
+		handlerSpan trace.SpanContext
+		outgoing    = http.Header{}
+	)
+	app := fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+	app.Use(middleware.Tracing())
+	app.Get("/v1/post/:id", func(c *fiber.Ctx) error {
+		handlerSpan = trace.SpanContextFromContext(c.UserContext())
+		// what a call to another service made with the request context would carry
+		otel.GetTextMapPropagator().Inject(c.UserContext(), propagation.HeaderCarrier(outgoing))
+		return fiber.ErrBadGateway
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/post/7", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(spans))
+	}
+	span := spans[0]
+
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace id = %s, want the caller's %s", got, traceID)
+	}
+	if got := span.Parent().SpanID().String(); got != spanID || !span.Parent().IsRemote() {
+		t.Errorf("parent = %s remote %v, want the caller's span %s", got, span.Parent().IsRemote(), spanID)
+	}
+	if span.SpanKind() != trace.SpanKindServer || span.Name() != "GET /v1/post/:id" {
+		t.Errorf("span = %s %q, want a server span named after the route", span.SpanKind(), span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want an error for a 502", span.Status())
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["http.route"].AsString() != "/v1/post/:id" || attrs["http.response.status_code"].AsInt64() != http.StatusBadGateway {
+		t.Errorf("attributes = %v", span.Attributes())
+	}
+
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("handler context carries span %s, want the request span %s", handlerSpan.SpanID(), span.SpanContext().SpanID())
+	}
+	want := "00-" + traceID + "-" + span.SpanContext().SpanID().String() + "-01"
+	if got := outgoing.Get("traceparent"); got != want {
+		t.Errorf("outgoing traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestTracingStartsTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	app := fiber.New()
+	app.Use(middleware.Tracing())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || !spans[0].SpanContext().HasTraceID() || spans[0].Parent().IsValid() {
+		t.Fatalf("spans = %v, want one root span", spans)
+	}
+}
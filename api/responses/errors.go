@@ -1,45 +1,212 @@
 package responses
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"errors"
+	"net/http"
+	"sort"
 
-func ErrorBadRequest(c *fiber.Ctx, m string) error {
-	return c.Status(400).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
-	})
+	"segokuning/db/functions"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Stable error codes for failures that don't originate from db/functions.
+const (
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeNotFound         = "NOT_FOUND"
+	CodeConflict         = "CONFLICT"
+	CodeInternal         = "INTERNAL_ERROR"
+)
+
+// Error is an HTTP-aware error returned by handlers and rendered by ErrorHandler.
+// Err holds the underlying cause and is never sent to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
 }
 
-func ErrorConflict(c *fiber.Ctx, m string) error {
-	return c.Status(409).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
-	})
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
 }
 
-func ErrorNotFound(c *fiber.Ctx, m string) error {
-	return c.Status(404).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
-	})
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
-func ErrorInternalServerError(c *fiber.Ctx, m string) error {
-	return c.Status(500).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
-	})
+// ErrorBody is the single error envelope sent by every endpoint.
+type ErrorBody struct {
+	Status  string      `json:"status"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
-func ErrorForbidden(c *fiber.Ctx, m string) error {
-	return c.Status(403).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
-	})
+// FieldError describes a single invalid field from ozzo-validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest wraps a request body or query that could not be parsed.
+func BadRequest(err error) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: err.Error(), Err: err}
+}
+
+func ErrorBadRequest(code, m string) *Error {
+	return NewError(http.StatusBadRequest, code, m)
+}
+
+func ErrorNotFound(code, m string) *Error {
+	return NewError(http.StatusNotFound, code, m)
+}
+
+func ErrorUnauthorized(m string) *Error {
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, m)
+}
+
+func ErrorForbidden(m string) *Error {
+	return NewError(http.StatusForbidden, CodeForbidden, m)
+}
+
+// domainStatus maps db/functions sentinels to the HTTP status they are served with. One left out
+// is served as an internal error, every sentinel of functions.Errors must be here.
+var domainStatus = map[*functions.Error]int{
+	functions.ErrExistingUsername:      http.StatusConflict,
+	functions.ErrUserNotFound:          http.StatusNotFound,
+	functions.ErrInvalidCredentials:    http.StatusUnauthorized,
+	functions.ErrAccountLocked:         http.StatusTooManyRequests,
+	functions.ErrEmailExists:           http.StatusConflict,
+	functions.ErrEmailAlreadySet:       http.StatusBadRequest,
+	functions.ErrPhoneExists:           http.StatusConflict,
+	functions.ErrPhoneAlreadySet:       http.StatusBadRequest,
+	functions.ErrWrongPassword:         http.StatusBadRequest,
+	functions.ErrAccountSuspended:      http.StatusForbidden,
+	functions.ErrInvalidRole:           http.StatusBadRequest,
+	functions.ErrCannotModerateSelf:    http.StatusBadRequest,
+	functions.ErrInsufficientRole:      http.StatusForbidden,
+	functions.ErrInvalidResetToken:     http.StatusBadRequest,
+	functions.ErrInvalidCredentialType: http.StatusBadRequest,
+	functions.ErrCredentialNotSet:      http.StatusBadRequest,
+	functions.ErrAlreadyVerified:       http.StatusConflict,
+	functions.ErrCredentialNotVerified: http.StatusForbidden,
+	functions.ErrInvalidCode:           http.StatusBadRequest,
+	functions.ErrCodeExpired:           http.StatusBadRequest,
+	functions.ErrTooManyAttempts:       http.StatusTooManyRequests,
+	functions.ErrNoAddSelf:             http.StatusBadRequest,
+	functions.ErrFriendNotFound:        http.StatusNotFound,
+	functions.ErrFriendshipExists:      http.StatusBadRequest,
+	functions.ErrFriendshipNotExists:   http.StatusBadRequest,
+	functions.ErrPostNotFound:          http.StatusNotFound,
+	functions.ErrNotFriendsPost:        http.StatusBadRequest,
+	functions.ErrCommentNotFound:       http.StatusNotFound,
+	functions.ErrInvalidReportTarget:   http.StatusBadRequest,
+	functions.ErrCannotReportSelf:      http.StatusBadRequest,
+	functions.ErrAlreadyReported:       http.StatusConflict,
+	functions.ErrReportNotFound:        http.StatusNotFound,
+	functions.ErrReportResolved:        http.StatusConflict,
+	functions.ErrInvalidResolution:     http.StatusBadRequest,
+}
+
+// fiberCodes names the fiber errors that middlewares and the router return.
+var fiberCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      "METHOD_NOT_ALLOWED",
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: "PAYLOAD_TOO_LARGE",
+	http.StatusUnprocessableEntity:   CodeBadRequest,
+	http.StatusTooManyRequests:       "TOO_MANY_REQUESTS",
+}
+
+// Resolve converts any error returned by a handler into the error served to the client.
+func Resolve(err error) *Error {
+	var (
+		apiErr    *Error
+		domainErr *functions.Error
+		fiberErr  *fiber.Error
+		valErrs   validation.Errors
+	)
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &valErrs):
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Code:    CodeValidationFailed,
+			Message: "request validation failed",
+			Details: fieldErrors(valErrs),
+			Err:     err,
+		}
+	case errors.As(err, &domainErr):
+		status, ok := domainStatus[domainErr]
+		if !ok {
+			break
+		}
+		e := &Error{Status: status, Code: domainErr.Code, Message: domainErr.Message, Err: err}
+		var detailed interface{ Details() interface{} }
+		if errors.As(err, &detailed) {
+			e.Details = detailed.Details()
+		}
+		return e
+	case errors.As(err, &fiberErr):
+		code, ok := fiberCodes[fiberErr.Code]
+		if !ok {
+			if fiberErr.Code < http.StatusInternalServerError {
+				code = CodeBadRequest
+			} else {
+				code = CodeInternal
+			}
+		}
+		return &Error{Status: fiberErr.Code, Code: code, Message: fiberErr.Message, Err: err}
+	}
+
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Message: "internal server error",
+		Err:     err,
+	}
+}
+
+func fieldErrors(errs validation.Errors) []FieldError {
+	fields := make([]FieldError, 0, len(errs))
+	for field, err := range errs {
+		fe := FieldError{Field: field, Message: err.Error()}
+		var ve validation.Error
+		if errors.As(err, &ve) {
+			fe.Code = ve.Code()
+		}
+		fields = append(fields, fe)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return fields
 }
 
-func ErrorUnauthorized(c *fiber.Ctx, m string) error {
-	return c.Status(401).JSON(map[string]interface{}{
-		"status":  "Error",
-		"message": m,
+// ErrorHandler is the fiber.Config ErrorHandler rendering every error in the same envelope.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	e := Resolve(err)
+	return c.Status(e.Status).JSON(ErrorBody{
+		Status:  "Error",
+		Code:    e.Code,
+		Message: e.Message,
+		Details: e.Details,
 	})
 }
@@ -0,0 +1,160 @@
+package responses_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"segokuning/api/responses"
+	"segokuning/db/functions"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestResolveSentinels(t *testing.T) {
+	for _, sentinel := range functions.Errors() {
+		t.Run(sentinel.Code, func(t *testing.T) {
+			got := responses.Resolve(fmt.Errorf("update users: %w", sentinel))
+			// a sentinel missing from the status map is served as an internal error
+			if got.Status < 400 || got.Status >= 500 {
+				t.Fatalf("status = %d, want a 4xx, is %s mapped to a status?", got.Status, sentinel.Code)
+			}
+			if got.Code != sentinel.Code || got.Message != sentinel.Message {
+				t.Errorf("served %s %q, want %s %q", got.Code, got.Message, sentinel.Code, sentinel.Message)
+			}
+		})
+	}
+
+	// spot checks the statuses clients rely on
+	for sentinel, want := range map[*functions.Error]int{
+		functions.ErrInvalidCredentials: http.StatusUnauthorized,
+		functions.ErrAccountLocked:      http.StatusTooManyRequests,
+		functions.ErrUserNotFound:       http.StatusNotFound,
+		functions.ErrEmailExists:        http.StatusConflict,
+		functions.ErrInsufficientRole:   http.StatusForbidden,
+	} {
+		if got := responses.Resolve(sentinel).Status; got != want {
+			t.Errorf("%s status = %d, want %d", sentinel.Code, got, want)
+		}
+	}
+}
+
+func TestResolveUnmappedDomainError(t *testing.T) {
+	got := responses.Resolve(&functions.Error{Code: "NOT_MAPPED", Message: "not mapped"})
+	if got.Status != http.StatusInternalServerError || got.Code != responses.CodeInternal {
+		t.Fatalf("served %d %s, want %d %s", got.Status, got.Code, http.StatusInternalServerError, responses.CodeInternal)
+	}
+}
+
+func TestResolveDetails(t *testing.T) {
+	until := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	got := responses.Resolve(&functions.SuspendedError{Until: &until})
+
+	if got.Status != http.StatusForbidden || got.Code != functions.ErrAccountSuspended.Code {
+		t.Fatalf("served %d %s, want %d %s", got.Status, got.Code, http.StatusForbidden, functions.ErrAccountSuspended.Code)
+	}
+	want := map[string]interface{}{"until": &until}
+	if !reflect.DeepEqual(got.Details, want) {
+		t.Errorf("details = %v, want %v", got.Details, want)
+	}
+}
+
+func TestResolveValidation(t *testing.T) {
+	req := struct {
+		Name  string
+		Limit int
+	}{Name: "a", Limit: 0}
+	err := validation.ValidateStruct(&req,
+		validation.Field(&req.Name, validation.Length(5, 50)),
+		validation.Field(&req.Limit, validation.Required),
+	)
+
+	got := responses.Resolve(err)
+	if got.Status != http.StatusBadRequest || got.Code != responses.CodeValidationFailed {
+		t.Fatalf("served %d %s, want %d %s", got.Status, got.Code, http.StatusBadRequest, responses.CodeValidationFailed)
+	}
+	fields, ok := got.Details.([]responses.FieldError)
+	if !ok || len(fields) != 2 {
+		t.Fatalf("details = %#v, want two field errors", got.Details)
+	}
+	// sorted by field
+	for i, want := range []struct{ field, code string }{
+		{"Limit", validation.ErrRequired.Code()},
+		{"Name", validation.ErrLengthOutOfRange.Code()},
+	} {
+		if fields[i].Field != want.field || fields[i].Code != want.code || fields[i].Message == "" {
+			t.Errorf("field %d = %+v, want %s %s with a message", i, fields[i], want.field, want.code)
+		}
+	}
+}
+
+func TestResolveFiberError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{fiber.ErrTooManyRequests, http.StatusTooManyRequests, "TOO_MANY_REQUESTS"},
+		{fiber.ErrRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE"},
+		{fiber.ErrUnauthorized, http.StatusUnauthorized, responses.CodeUnauthorized},
+		{fiber.ErrTeapot, http.StatusTeapot, responses.CodeBadRequest},
+		{fiber.ErrBadGateway, http.StatusBadGateway, responses.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		got := responses.Resolve(tt.err)
+		if got.Status != tt.wantStatus || got.Code != tt.wantCode {
+			t.Errorf("%v served %d %s, want %d %s", tt.err, got.Status, got.Code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"handler error", responses.ErrorNotFound("POST_NOT_FOUND", "post not found"), http.StatusNotFound, "POST_NOT_FOUND"},
+		{"domain error", fmt.Errorf("add friend: %w", functions.ErrNoAddSelf), http.StatusBadRequest, functions.ErrNoAddSelf.Code},
+		// what the database said stays in the logs
+		{"internal error", errors.New(`ERROR: relation "users" does not exist (SQLSTATE 42P01)`), http.StatusInternalServerError, responses.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error { return tt.err })
+
+			res, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			raw, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body responses.ErrorBody
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatalf("body %s: %v", raw, err)
+			}
+			if res.StatusCode != tt.wantStatus || body.Status != "Error" || body.Code != tt.wantCode {
+				t.Fatalf("served %d %s %s, want %d Error %s", res.StatusCode, body.Status, body.Code, tt.wantStatus, tt.wantCode)
+			}
+			if strings.Contains(string(raw), "SQLSTATE") || strings.Contains(string(raw), "relation") {
+				t.Errorf("body leaks the cause: %s", raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"segokuning/api/handlers"
+	"segokuning/api/middleware"
+	"segokuning/configs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AccountRoutes(app *fiber.App, accountHandler handlers.Account, auth fiber.Handler, cfg configs.Config) {
+	g := app.Group("/v1/user/me")
+	g.Delete("",
+		auth,
+		middleware.RateLimit(cfg.PasswordConfirmLimit, middleware.ByUser),
+		accountHandler.Delete,
+	)
+	g.Post("/deactivate",
+		auth,
+		middleware.RateLimit(cfg.PasswordConfirmLimit, middleware.ByUser),
+		accountHandler.Deactivate,
+	)
+	g.Get("/activity", auth, accountHandler.Activity)
+	g.Get("/export",
+		auth,
+		middleware.RateLimit(cfg.ExportLimit, middleware.ByUser),
+		accountHandler.Export,
+	)
+}
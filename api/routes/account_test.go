@@ -0,0 +1,193 @@
+package routes_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"segokuning/db/entity"
+)
+
+func TestExport(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	imageURL := s.upload(budi, jpeg(20_000))
+	s.expect(s.do(http.MethodPatch, "/v1/user", budi.token, map[string]string{"name": "budi santoso", "imageUrl": imageURL}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>halo</p>", "tags": []string{"hi"}}), http.StatusOK)
+
+	r := s.do(http.MethodGet, "/v1/user/me/export", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	if ct := r.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(r.Raw), int64(len(r.Raw)))
+	if err != nil {
+		t.Fatalf("open export: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var export entity.AccountExport
+	if err := json.Unmarshal(files["export.json"], &export); err != nil {
+		t.Fatalf("decode export.json: %v", err)
+	}
+	if export.Account.Name != "budi santoso" || len(export.Posts) != 1 || len(export.Friends) != 1 {
+		t.Fatalf("export = %+v", export)
+	}
+	if len(files["images/profile.jpg"]) != 20_000 {
+		t.Fatalf("profile image is %d bytes, want 20000", len(files["images/profile.jpg"]))
+	}
+
+	// an image uploaded by someone else is only linked to, its URL stays in export.json
+	s.expect(s.do(http.MethodPatch, "/v1/user", siti.token, map[string]string{"name": "siti nurhaliza", "imageUrl": imageURL}), http.StatusOK)
+	r = s.do(http.MethodGet, "/v1/user/me/export", siti.token, nil)
+	s.expect(r, http.StatusOK)
+	archive, err = zip.NewReader(bytes.NewReader(r.Raw), int64(len(r.Raw)))
+	if err != nil {
+		t.Fatalf("open export: %v", err)
+	}
+	for _, f := range archive.File {
+		if f.Name != "export.json" {
+			t.Errorf("siti's export carries %s, uploaded by budi", f.Name)
+		}
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	r := s.do(http.MethodDelete, "/v1/user/me", budi.token, map[string]string{"password": "wrong-password"})
+	s.expect(r, http.StatusBadRequest, "WRONG_PASSWORD")
+
+	r = s.do(http.MethodDelete, "/v1/user/me", budi.token, map[string]string{"password": budi.password})
+	s.expect(r, http.StatusOK)
+
+	// the token of a deleted user is refused and the friendship is gone
+	s.expect(s.do(http.MethodGet, "/v1/user/me/export", budi.token, nil), http.StatusUnauthorized)
+
+	r = s.do(http.MethodGet, "/v1/friend?onlyFriend=true", siti.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(0) {
+		t.Fatalf("siti still has budi as a friend: %s", r.Raw)
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>halo</p>", "tags": []string{"hi"}}), http.StatusOK)
+
+	friends := func() float64 {
+		t.Helper()
+		r := s.do(http.MethodGet, "/v1/friend?onlyFriend=true", siti.token, nil)
+		s.expect(r, http.StatusOK)
+		return r.Body["meta"].(map[string]interface{})["total"].(float64)
+	}
+
+	deactivate := func(password string) response {
+		return s.do(http.MethodPost, "/v1/user/me/deactivate", budi.token, map[string]string{"password": password})
+	}
+	s.expect(deactivate(""), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(deactivate("wrong-password"), http.StatusBadRequest, "WRONG_PASSWORD")
+	s.expect(deactivate(budi.password), http.StatusOK)
+
+	// signed out, hidden from friends and feeds, but not gone
+	s.expect(s.do(http.MethodGet, "/v1/post", budi.token, nil), http.StatusUnauthorized)
+	if posts := s.feed(siti); len(posts) != 0 {
+		t.Fatalf("siti still sees %d posts of budi", len(posts))
+	}
+	if total := friends(); total != 0 {
+		t.Fatalf("siti still lists %v friends", total)
+	}
+	s.expect(s.do(http.MethodPost, "/v1/friend", siti.token, map[string]string{"userId": budi.id}), http.StatusNotFound, "FRIEND_NOT_FOUND")
+
+	// logging in brings everything back
+	budi = s.login(budi)
+	if posts := s.feed(siti); len(posts) != 1 {
+		t.Fatalf("siti sees %d posts after budi came back, want 1", len(posts))
+	}
+	if total := friends(); total != 1 {
+		t.Fatalf("siti lists %v friends after budi came back, want 1", total)
+	}
+
+	// past the retention window the account can't come back
+	s.expect(deactivate(budi.password), http.StatusOK)
+	s.db.Retention = 0
+	r := s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": budi.email,
+		"password":        budi.password,
+	})
+	s.expect(r, http.StatusUnauthorized, "INVALID_CREDENTIALS")
+
+	// a deactivated friend can't be added again but is still unfriended
+	s.expect(s.do(http.MethodDelete, "/v1/friend", siti.token, map[string]string{"userId": budi.id}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/friend", siti.token, map[string]string{"userId": budi.id}), http.StatusNotFound, "FRIEND_NOT_FOUND")
+}
+
+func TestAccountActivity(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+
+	r := s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": budi.email,
+		"password":        "not-the-password",
+	})
+	s.expect(r, http.StatusUnauthorized, "INVALID_CREDENTIALS")
+	budi = s.login(budi)
+	s.expect(s.do(http.MethodPatch, "/v1/user", budi.token, map[string]string{"name": "budi santoso", "imageUrl": "https://example.com/budi.jpg"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/user/link/phone", budi.token, map[string]string{"phone": "+628123456"}), http.StatusOK)
+	s.befriend(budi, siti)
+
+	// what siti does to budi is hers, not his
+	s.expect(s.do(http.MethodDelete, "/v1/friend", siti.token, map[string]string{"userId": budi.id}), http.StatusOK)
+
+	s.expect(s.do(http.MethodGet, "/v1/user/me/activity?limit=101", budi.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+
+	r = s.do(http.MethodGet, "/v1/user/me/activity", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	entries := r.Body["data"].([]interface{})
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.(map[string]interface{})["action"].(string))
+	}
+	want := fmt.Sprint([]string{entity.ActionFriendAdd, entity.ActionPhoneUpdate, entity.ActionAccountUpdate, entity.ActionLogin, entity.ActionLoginFailed})
+	if fmt.Sprint(actions) != want {
+		t.Fatalf("activity = %v, want %v", actions, want)
+	}
+
+	update := entries[2].(map[string]interface{})
+	before := update["details"].(map[string]interface{})["before"].(map[string]interface{})
+	after := update["details"].(map[string]interface{})["after"].(map[string]interface{})
+	if before["name"] != "budiman" || after["name"] != "budi santoso" || update["ip"] == nil {
+		t.Fatalf("account update entry = %v", update)
+	}
+
+	r = s.do(http.MethodGet, "/v1/user/me/activity?limit=2&offset=4", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(5) || len(r.Body["data"].([]interface{})) != 1 {
+		t.Fatalf("last page = %s", r.Raw)
+	}
+}
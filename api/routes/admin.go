@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"segokuning/api/handlers"
+	"segokuning/api/middleware"
+	"segokuning/db/entity"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminRoutes(app *fiber.App, adminHandler handlers.Admin, auth fiber.Handler) {
+	staff := middleware.RequireRole(entity.RoleModerator, entity.RoleAdmin)
+	admin := middleware.RequireRole(entity.RoleAdmin)
+
+	g := app.Group("/v1/admin")
+	g.Get("/users", auth, staff, adminHandler.ListUsers)
+	g.Post("/users/:userId/suspend", auth, staff, adminHandler.Suspend)
+	g.Post("/users/:userId/unsuspend", auth, staff, adminHandler.Unsuspend)
+	g.Put("/users/:userId/role", auth, admin, adminHandler.SetRole)
+	g.Get("/posts/:postId", auth, staff, adminHandler.GetPost)
+	g.Delete("/posts/:postId", auth, staff, adminHandler.DeletePost)
+	g.Delete("/posts/:postId/comments/:commentId", auth, staff, adminHandler.DeleteComment)
+	g.Get("/audit", auth, admin, adminHandler.AuditLog)
+}
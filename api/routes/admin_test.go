@@ -0,0 +1,243 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"segokuning/db/entity"
+)
+
+// moderation returns the actions a is audited with, leaving out their own account events.
+func (s *suite) moderation(a account) []string {
+	var actions []string
+	for _, e := range s.db.AuditLog() {
+		if e.ActorID != nil && fmt.Sprint(*e.ActorID) == a.id && !slices.Contains(entity.AccountActions, e.Action) {
+			actions = append(actions, e.Action)
+		}
+	}
+	return actions
+}
+
+func TestAdminNeedsRole(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.promote(s.register("sitinur", "siti@example.com"), entity.RoleModerator)
+
+	s.expect(s.do(http.MethodGet, "/v1/admin/users", budi.token, nil), http.StatusForbidden, "FORBIDDEN")
+
+	// moderators moderate, only admins hand out roles
+	r := s.do(http.MethodPut, "/v1/admin/users/"+budi.id+"/role", siti.token, map[string]string{"role": entity.RoleModerator})
+	s.expect(r, http.StatusForbidden, "FORBIDDEN")
+}
+
+func TestAdminListUsers(t *testing.T) {
+	s := newSuite(t)
+	admin := s.promote(s.register("adminku", "admin@example.com"), entity.RoleAdmin)
+	s.register("budiman", "budi@example.com")
+	s.register("sitinur", "siti@example.com")
+
+	r := s.do(http.MethodGet, "/v1/admin/users?search=SITI", admin.token, nil)
+	s.expect(r, http.StatusOK)
+	users := r.Body["data"].([]interface{})
+	if len(users) != 1 || users[0].(map[string]interface{})["email"] != "siti@example.com" {
+		t.Fatalf("search = %s", r.Raw)
+	}
+
+	r = s.do(http.MethodGet, "/v1/admin/users?role=admin", admin.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(1) {
+		t.Fatalf("admins = %s", r.Raw)
+	}
+
+	s.expect(s.do(http.MethodGet, "/v1/admin/users?role=owner", admin.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+}
+
+func TestAdminSuspend(t *testing.T) {
+	s := newSuite(t)
+	admin := s.promote(s.register("adminku", "admin@example.com"), entity.RoleAdmin)
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+
+	suspend := func(by account, id string, body interface{}) response {
+		return s.do(http.MethodPost, "/v1/admin/users/"+id+"/suspend", by.token, body)
+	}
+
+	s.expect(suspend(mod, budi.id, map[string]interface{}{"reason": "spam", "until": time.Now().Add(-time.Hour)}), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(suspend(mod, mod.id, map[string]string{"reason": "testing"}), http.StatusBadRequest, "CANNOT_MODERATE_SELF")
+	s.expect(suspend(mod, admin.id, map[string]string{"reason": "coup"}), http.StatusForbidden, "INSUFFICIENT_ROLE")
+	s.expect(suspend(mod, "999", map[string]string{"reason": "spam"}), http.StatusNotFound, "USER_NOT_FOUND")
+
+	r := suspend(mod, budi.id, map[string]interface{}{"reason": "spam", "until": time.Now().Add(24 * time.Hour)})
+	s.expect(r, http.StatusOK)
+	if r.data()["suspendedUntil"] == nil {
+		t.Fatalf("suspend = %s", r.Raw)
+	}
+
+	// signed out and kept out
+	s.expect(s.do(http.MethodGet, "/v1/post", budi.token, nil), http.StatusUnauthorized)
+	r = s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": budi.email,
+		"password":        budi.password,
+	})
+	s.expect(r, http.StatusForbidden, "ACCOUNT_SUSPENDED")
+	if details, _ := r.Body["details"].(map[string]interface{}); details["until"] == nil {
+		t.Fatalf("suspended login doesn't tell until when: %s", r.Raw)
+	}
+
+	r = s.do(http.MethodGet, "/v1/admin/users?suspended=true", mod.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(1) {
+		t.Fatalf("suspended users = %s", r.Raw)
+	}
+
+	s.expect(s.do(http.MethodPost, "/v1/admin/users/"+budi.id+"/unsuspend", mod.token, nil), http.StatusOK)
+	s.login(budi)
+
+	// the audit log names the moderator on every action
+	actions := s.moderation(mod)
+	want := fmt.Sprint([]string{entity.ActionUserSuspend, entity.ActionUserSearch, entity.ActionUserUnsuspend})
+	if fmt.Sprint(actions) != want {
+		t.Fatalf("audited actions = %v, want %v", actions, want)
+	}
+}
+
+func TestAdminSuspendHidesContent(t *testing.T) {
+	s := newSuite(t)
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>halo</p>", "tags": []string{"hi"}}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/post", siti.token, map[string]interface{}{"postInHtml": "<p>promo</p>", "tags": []string{"promo"}}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/comment", siti.token, map[string]string{"postId": "1", "comment": "beli dong"}), http.StatusOK)
+
+	feed := func() (posts []interface{}, comments int) {
+		t.Helper()
+		r := s.do(http.MethodGet, "/v1/post", budi.token, nil)
+		s.expect(r, http.StatusOK)
+		posts = r.Body["data"].(map[string]interface{})["data"].([]interface{})
+		for _, p := range posts {
+			c, _ := p.(map[string]interface{})["comments"].([]interface{})
+			comments += len(c)
+		}
+		return posts, comments
+	}
+
+	if posts, comments := feed(); len(posts) != 2 || comments != 1 {
+		t.Fatalf("feed before the suspension has %d posts and %d comments", len(posts), comments)
+	}
+
+	s.expect(s.do(http.MethodPost, "/v1/admin/users/"+siti.id+"/suspend", mod.token, map[string]string{"reason": "spam"}), http.StatusOK)
+	if posts, comments := feed(); len(posts) != 1 || comments != 0 {
+		t.Fatalf("feed of a suspended friend has %d posts and %d comments", len(posts), comments)
+	}
+
+	s.expect(s.do(http.MethodPost, "/v1/admin/users/"+siti.id+"/unsuspend", mod.token, nil), http.StatusOK)
+	if posts, comments := feed(); len(posts) != 2 || comments != 1 {
+		t.Fatalf("feed after reinstating has %d posts and %d comments", len(posts), comments)
+	}
+}
+
+func TestAdminSetRole(t *testing.T) {
+	s := newSuite(t)
+	admin := s.promote(s.register("adminku", "admin@example.com"), entity.RoleAdmin)
+	budi := s.register("budiman", "budi@example.com")
+
+	setRole := func(id, role string) response {
+		return s.do(http.MethodPut, "/v1/admin/users/"+id+"/role", admin.token, map[string]string{"role": role})
+	}
+
+	s.expect(setRole(budi.id, "owner"), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(setRole(admin.id, entity.RoleUser), http.StatusBadRequest, "CANNOT_MODERATE_SELF")
+
+	r := setRole(budi.id, entity.RoleModerator)
+	s.expect(r, http.StatusOK)
+	if r.data()["role"] != entity.RoleModerator {
+		t.Fatalf("set role = %s", r.Raw)
+	}
+
+	// the old token carries the old role
+	s.expect(s.do(http.MethodGet, "/v1/post", budi.token, nil), http.StatusUnauthorized)
+	budi = s.login(budi)
+	s.expect(s.do(http.MethodGet, "/v1/admin/users", budi.token, nil), http.StatusOK)
+}
+
+func TestAdminPosts(t *testing.T) {
+	s := newSuite(t)
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>halo</p>", "tags": []string{"hi"}}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/comment", siti.token, map[string]string{"postId": "1", "comment": "halo juga"}), http.StatusOK)
+
+	// the moderator isn't budi's friend and sees the post anyway
+	r := s.do(http.MethodGet, "/v1/admin/posts/1", mod.token, nil)
+	s.expect(r, http.StatusOK)
+	comments := r.data()["comments"].([]interface{})
+	if len(comments) != 1 {
+		t.Fatalf("post = %s", r.Raw)
+	}
+	commentID := fmt.Sprint(comments[0].(map[string]interface{})["commentId"])
+
+	s.expect(s.do(http.MethodGet, "/v1/admin/posts/2", mod.token, nil), http.StatusNotFound, "POST_NOT_FOUND")
+
+	reason := map[string]string{"reason": "rude"}
+	s.expect(s.do(http.MethodDelete, "/v1/admin/posts/1/comments/"+commentID, mod.token, map[string]string{}), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(s.do(http.MethodDelete, "/v1/admin/posts/1/comments/"+commentID, mod.token, reason), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/v1/admin/posts/1/comments/"+commentID, mod.token, reason), http.StatusNotFound, "COMMENT_NOT_FOUND")
+
+	r = s.do(http.MethodGet, "/v1/post", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	posts := r.Body["data"].(map[string]interface{})["data"].([]interface{})
+	if comments, _ := posts[0].(map[string]interface{})["comments"].([]interface{}); len(comments) != 0 {
+		t.Fatalf("the comment is still there: %s", r.Raw)
+	}
+
+	s.expect(s.do(http.MethodDelete, "/v1/admin/posts/1", mod.token, reason), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/v1/admin/posts/1", mod.token, reason), http.StatusNotFound, "POST_NOT_FOUND")
+
+	log := s.db.AuditLog()
+	last := log[len(log)-1]
+	if last.Action != entity.ActionPostDelete || last.Details["postInHtml"] != "<p>halo</p>" || last.Details["reason"] != "rude" {
+		t.Fatalf("last audit entry = %+v", last)
+	}
+}
+
+func TestAdminAuditLog(t *testing.T) {
+	s := newSuite(t)
+	admin := s.promote(s.register("adminku", "admin@example.com"), entity.RoleAdmin)
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+	s.expect(s.do(http.MethodPost, "/v1/user/link/phone", budi.token, map[string]string{"phone": "+628123456"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/admin/users/"+budi.id+"/suspend", mod.token, map[string]string{"reason": "spam"}), http.StatusOK)
+
+	// the log has the IPs of every user, moderators don't read it
+	s.expect(s.do(http.MethodGet, "/v1/admin/audit", mod.token, nil), http.StatusForbidden, "FORBIDDEN")
+	s.expect(s.do(http.MethodGet, "/v1/admin/audit?since=yesterday", admin.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(s.do(http.MethodGet, "/v1/admin/audit?actorId=budi", admin.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+
+	r := s.do(http.MethodGet, "/v1/admin/audit?targetType=user&targetId="+budi.id, admin.token, nil)
+	s.expect(r, http.StatusOK)
+	entries := r.Body["data"].([]interface{})
+	if len(entries) != 2 || entries[0].(map[string]interface{})["action"] != entity.ActionUserSuspend || entries[1].(map[string]interface{})["action"] != entity.ActionPhoneUpdate {
+		t.Fatalf("entries on budi = %s", r.Raw)
+	}
+
+	since := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	r = s.do(http.MethodGet, "/v1/admin/audit?action="+entity.ActionLogin+"&actorId="+mod.id+"&since="+since, admin.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(1) {
+		t.Fatalf("logins of the moderator = %s", r.Raw)
+	}
+
+	if got := s.moderation(admin); fmt.Sprint(got) != fmt.Sprint([]string{entity.ActionAuditSearch, entity.ActionAuditSearch}) {
+		t.Fatalf("audited actions of the admin = %v", got)
+	}
+}
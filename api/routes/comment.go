@@ -3,11 +3,12 @@ package routes
 import (
 	"segokuning/api/handlers"
 	"segokuning/api/middleware"
+	"segokuning/configs"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func CommentRoutes(app *fiber.App, commentHandler handlers.Comment) {
+func CommentRoutes(app *fiber.App, commentHandler handlers.Comment, auth fiber.Handler, cfg configs.Config) {
 	g := app.Group("/v1/comment")
-	g.Post("", middleware.JWTAuth(), commentHandler.AddComment)
+	g.Post("", auth, middleware.RateLimit(cfg.CommentLimit, middleware.ByUser), commentHandler.AddComment)
 }
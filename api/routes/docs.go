@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"segokuning/api/docs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func DocsRoutes(app *fiber.App) {
+	app.Get("/openapi.json", func(c *fiber.Ctx) error {
+		c.Type("json")
+		return c.Send(docs.Spec)
+	})
+	app.Get("/docs", func(c *fiber.Ctx) error {
+		c.Type("html")
+		c.Set(fiber.HeaderContentSecurityPolicy, docs.PageCSP)
+		return c.Send(docs.Page)
+	})
+	app.Get("/docs/docs.js", func(c *fiber.Ctx) error {
+		c.Type("js")
+		return c.Send(docs.Script)
+	})
+	app.Get("/docs/docs.css", func(c *fiber.Ctx) error {
+		c.Type("css")
+		return c.Send(docs.Style)
+	})
+}
@@ -3,13 +3,17 @@ package routes
 import (
 	"segokuning/api/handlers"
 	"segokuning/api/middleware"
+	"segokuning/configs"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func FriendRoutes(app *fiber.App, friendHandler handlers.Friend) {
+func FriendRoutes(app *fiber.App, friendHandler handlers.Friend, auth fiber.Handler, cfg configs.Config) {
+	// adding and removing friends share one budget
+	writeLimit := middleware.RateLimit(cfg.FriendLimit, middleware.ByUser)
+
 	g := app.Group("/v1/friend")
-	g.Get("", middleware.JWTAuth(), friendHandler.GetFriends)
-	g.Post("", middleware.JWTAuth(), friendHandler.AddFriend)
-	g.Delete("", middleware.JWTAuth(), friendHandler.DeleteFriend)
+	g.Get("", auth, friendHandler.GetFriends)
+	g.Post("", auth, writeLimit, friendHandler.AddFriend)
+	g.Delete("", auth, writeLimit, friendHandler.DeleteFriend)
 }
@@ -0,0 +1,43 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFriends(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	joko := s.register("jokowidodo", "joko@example.com")
+
+	add := func(a account, userID string) response {
+		return s.do(http.MethodPost, "/v1/friend", a.token, map[string]string{"userId": userID})
+	}
+	s.expect(add(budi, siti.id), http.StatusOK)
+	s.expect(add(budi, joko.id), http.StatusOK)
+	s.expect(add(siti, budi.id), http.StatusBadRequest, "FRIENDSHIP_EXISTS")
+	s.expect(add(budi, budi.id), http.StatusBadRequest, "NO_ADD_SELF")
+	s.expect(add(budi, "999"), http.StatusNotFound, "FRIEND_NOT_FOUND")
+	s.expect(add(budi, ""), http.StatusBadRequest, "VALIDATION_FAILED")
+
+	r := s.do(http.MethodGet, "/v1/friend?onlyFriend=true&limit=10", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	if friends := r.Body["data"].([]interface{}); len(friends) != 2 {
+		t.Fatalf("budi has %d friends, want 2: %s", len(friends), r.Raw)
+	}
+
+	s.expect(s.do(http.MethodGet, "/v1/friend?sortBy=name", budi.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+
+	remove := func(a account, userID string) response {
+		return s.do(http.MethodDelete, "/v1/friend", a.token, map[string]string{"userId": userID})
+	}
+	s.expect(remove(siti, budi.id), http.StatusOK)
+	s.expect(remove(budi, siti.id), http.StatusBadRequest, "FRIENDSHIP_NOT_EXISTS")
+
+	r = s.do(http.MethodGet, "/v1/friend?onlyFriend=true", siti.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(0) {
+		t.Fatalf("siti still has friends: %s", r.Raw)
+	}
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"segokuning/api/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func HealthRoutes(app *fiber.App, healthHandler handlers.Health) {
+	app.Get("/healthz", healthHandler.Liveness)
+	app.Get("/readyz", healthHandler.Readiness)
+}
@@ -2,11 +2,10 @@ package routes
 
 import (
 	"segokuning/api/handlers"
-	"segokuning/api/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func ImageRoutes(app *fiber.App, h handlers.ImageUploader) {
-	app.Post("/v1/image", middleware.JWTAuth(), h.Upload)
+func ImageRoutes(app *fiber.App, h handlers.ImageUploader, auth fiber.Handler) {
+	app.Post("/v1/image", auth, h.Upload)
 }
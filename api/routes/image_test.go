@@ -0,0 +1,55 @@
+package routes_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// jpeg returns size bytes carrying a JPEG signature, enough for the mimetype check.
+func jpeg(size int) []byte {
+	data := make([]byte, size)
+	copy(data, []byte{0xff, 0xd8, 0xff, 0xe0})
+	return data
+}
+
+func (s *suite) uploadRequest(a account, name string, data []byte) response {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		s.t.Fatalf("create form file: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/image", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return s.send(req, a.token)
+}
+
+// upload stores data as an image and returns its URL.
+func (s *suite) upload(a account, data []byte) string {
+	s.t.Helper()
+
+	r := s.uploadRequest(a, "photo.jpg", data)
+	s.expect(r, http.StatusOK)
+	url, _ := r.data()["imageUrl"].(string)
+	return url
+}
+
+func TestUploadImage(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	if url := s.upload(budi, jpeg(20_000)); url == "" {
+		t.Fatal("upload returned no url")
+	}
+
+	s.expect(s.uploadRequest(budi, "small.jpg", jpeg(100)), http.StatusBadRequest, "INVALID_FILE_SIZE")
+	s.expect(s.uploadRequest(budi, "photo.png", make([]byte, 20_000)), http.StatusBadRequest, "UNSUPPORTED_MIMETYPE")
+}
@@ -2,8 +2,7 @@ package routes
 
 import (
 	"segokuning/api/handlers"
-	"segokuning/db/functions"
-	"segokuning/internal/utils"
+	"segokuning/api/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,30 +12,74 @@ func RouteRegister(app *fiber.App, deps handlers.Dependencies) {
 		return c.SendString("pong")
 	})
 
+	stores := deps.Stores
+	var sessions middleware.Sessions
+	if stores.Users != nil {
+		sessions = middleware.NewSessionCache(stores.Users, deps.Cfg.SessionCacheTTL)
+	}
+	auth := middleware.JWTAuth(deps.Cfg, sessions)
+
 	userHandler := handlers.User{
-		Database: functions.NewUser(deps.DbPool, deps.Cfg),
+		Cfg:           deps.Cfg,
+		Database:      stores.Users,
+		Verification:  stores.Verification,
+		PasswordReset: stores.PasswordReset,
+		Notifier:      deps.Notifier,
 	}
 
 	postHandler := handlers.Post{
-		Database: functions.NewPost(deps.DbPool, deps.Cfg),
+		Database: stores.Posts,
 	}
 
 	commentHandler := handlers.Comment{
-		PostDatabase:   functions.NewPost(deps.DbPool, deps.Cfg),
-		FriendDatabase: functions.NewFriend(deps.DbPool, deps.Cfg),
+		Database:       stores.Comments,
+		FriendDatabase: stores.Friends,
 	}
 
 	imageUploaderHandler := handlers.ImageUploader{
-		Uploader: utils.NewImageUploader(deps.Cfg),
+		Uploader: stores.Objects,
+		Uploads:  stores.Uploads,
+	}
+
+	// checks are only set when their dependency is, a nil pool in an interface isn't nil
+	healthHandler := handlers.Health{
+		Timeout: deps.Cfg.ReadinessTimeout,
+	}
+	if deps.DbPool != nil {
+		healthHandler.DbPool = deps.DbPool
+	}
+	if deps.ReadPool != nil {
+		healthHandler.ReadPool = deps.ReadPool
+	}
+	if deps.Cfg.ReadinessCheckStorage && stores.Objects != nil {
+		healthHandler.Storage = stores.Objects
+	}
+
+	accountHandler := handlers.Account{
+		Database: stores.Accounts,
+		Storage:  stores.Objects,
 	}
 
 	friendHandler := handlers.Friend{
-		Database: functions.NewFriend(deps.DbPool, deps.Cfg),
+		Database: stores.Friends,
+	}
+
+	adminHandler := handlers.Admin{
+		Database: stores.Admin,
+	}
+
+	reportHandler := handlers.Report{
+		Database: stores.Reports,
 	}
 
-	ImageRoutes(app, imageUploaderHandler)
-	UserRoutes(app, userHandler)
-	PostRoutes(app, postHandler)
-	CommentRoutes(app, commentHandler)
-	FriendRoutes(app, friendHandler)
+	HealthRoutes(app, healthHandler)
+	DocsRoutes(app)
+	ImageRoutes(app, imageUploaderHandler, auth)
+	UserRoutes(app, userHandler, auth, deps.Cfg)
+	AccountRoutes(app, accountHandler, auth, deps.Cfg)
+	PostRoutes(app, postHandler, auth, deps.Cfg)
+	CommentRoutes(app, commentHandler, auth, deps.Cfg)
+	FriendRoutes(app, friendHandler, auth, deps.Cfg)
+	AdminRoutes(app, adminHandler, auth)
+	ReportRoutes(app, reportHandler, auth, deps.Cfg)
 }
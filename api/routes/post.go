@@ -3,12 +3,15 @@ package routes
 import (
 	"segokuning/api/handlers"
 	"segokuning/api/middleware"
+	"segokuning/configs"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 )
 
-func PostRoutes(app *fiber.App, postHandler handlers.Post) {
+func PostRoutes(app *fiber.App, postHandler handlers.Post, auth fiber.Handler, cfg configs.Config) {
 	g := app.Group("/v1/post")
-	g.Post("", middleware.JWTAuth(), postHandler.AddPost)
-	g.Get("", middleware.JWTAuth(), postHandler.GetPosts)
+	g.Post("", auth, middleware.RateLimit(cfg.PostLimit, middleware.ByUser), postHandler.AddPost)
+	// an unchanged feed answers If-None-Match with 304 instead of the page
+	g.Get("", auth, etag.New(etag.Config{Weak: true}), postHandler.GetPosts)
 }
@@ -0,0 +1,122 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPosts(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	joko := s.register("jokowidodo", "joko@example.com")
+	s.befriend(budi, siti)
+
+	post := func(a account, html string, tags ...string) {
+		t.Helper()
+		r := s.do(http.MethodPost, "/v1/post", a.token, map[string]interface{}{"postInHtml": html, "tags": tags})
+		s.expect(r, http.StatusOK)
+	}
+	post(budi, "<p>nasi goreng</p>", "food")
+	post(siti, "<p>soto ayam</p>", "food", "soup")
+	post(joko, "<p>not a friend of budi</p>", "food")
+
+	r := s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "x", "tags": []string{}})
+	s.expect(r, http.StatusBadRequest, "VALIDATION_FAILED")
+
+	r = s.do(http.MethodGet, "/v1/post?limit=10", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	data, _ := r.data()["data"].([]interface{})
+	if len(data) != 2 {
+		t.Fatalf("feed has %d posts, want budi's and siti's: %s", len(data), r.Raw)
+	}
+	newest := data[0].(map[string]interface{})
+	if newest["post"].(map[string]interface{})["postInHtml"] != "<p>soto ayam</p>" {
+		t.Fatalf("feed isn't newest first: %s", r.Raw)
+	}
+
+	r = s.do(http.MethodGet, "/v1/post?limit=1&offset=1", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.data()["meta"].(map[string]interface{}); meta["total"] != float64(2) || meta["limit"] != float64(1) {
+		t.Fatalf("meta = %v", meta)
+	}
+	if data := r.data()["data"].([]interface{}); len(data) != 1 {
+		t.Fatalf("page has %d posts, want 1: %s", len(data), r.Raw)
+	}
+
+	r = s.do(http.MethodGet, "/v1/post?searchTags=soup", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.data()["meta"].(map[string]interface{}); meta["total"] != float64(1) {
+		t.Fatalf("tagged posts = %v, want 1", meta["total"])
+	}
+
+	s.expect(s.do(http.MethodGet, "/v1/post?limit=0&offset=-1", budi.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(s.do(http.MethodGet, "/v1/post?limit=101", budi.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+}
+
+func TestFeedETag(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	s.expect(s.do(http.MethodPost, "/v1/post", siti.token, map[string]interface{}{"postInHtml": "<p>soto ayam</p>", "tags": []string{"food"}}), http.StatusOK)
+
+	r := s.do(http.MethodGet, "/v1/post", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	tag := r.Header.Get(fiber.HeaderETag)
+	if tag == "" || r.Header.Get(fiber.HeaderCacheControl) != "private, no-cache" {
+		t.Fatalf("headers = %v", r.Header)
+	}
+
+	revalidate := func() response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/v1/post", nil)
+		req.Header.Set(fiber.HeaderIfNoneMatch, tag)
+		return s.send(req, budi.token)
+	}
+	if r := revalidate(); r.Status != http.StatusNotModified || len(r.Raw) != 0 {
+		t.Fatalf("unchanged feed = %d %s, want 304", r.Status, r.Raw)
+	}
+
+	s.expect(s.do(http.MethodPost, "/v1/post", siti.token, map[string]interface{}{"postInHtml": "<p>nasi goreng</p>", "tags": []string{"food"}}), http.StatusOK)
+	s.expect(revalidate(), http.StatusOK)
+}
+
+func TestComments(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	joko := s.register("jokowidodo", "joko@example.com")
+	s.befriend(budi, siti)
+
+	r := s.do(http.MethodPost, "/v1/post", siti.token, map[string]interface{}{"postInHtml": "<p>soto ayam</p>", "tags": []string{"food"}})
+	s.expect(r, http.StatusOK)
+	postID := fmt.Sprint(r.data()["id"])
+
+	comment := func(a account, postID string) response {
+		return s.do(http.MethodPost, "/v1/comment", a.token, map[string]string{"comment": "enak!", "postId": postID})
+	}
+
+	r = comment(budi, postID)
+	s.expect(r, http.StatusOK)
+	if creator := r.data()["creator"].(map[string]interface{}); creator["name"] != budi.name {
+		t.Fatalf("comment = %s", r.Raw)
+	}
+
+	s.expect(comment(joko, postID), http.StatusBadRequest, "NOT_FRIENDS_POST")
+	s.expect(comment(budi, "999"), http.StatusNotFound, "POST_NOT_FOUND")
+	s.expect(comment(budi, "abc"), http.StatusNotFound, "POST_NOT_FOUND")
+
+	r = s.do(http.MethodGet, "/v1/post", budi.token, nil)
+	s.expect(r, http.StatusOK)
+	feed := r.data()["data"].([]interface{})
+	comments := feed[0].(map[string]interface{})["comments"].([]interface{})
+	if len(comments) != 1 {
+		t.Fatalf("post has %d comments, want 1: %s", len(comments), r.Raw)
+	}
+}
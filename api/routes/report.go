@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"segokuning/api/handlers"
+	"segokuning/api/middleware"
+	"segokuning/configs"
+	"segokuning/db/entity"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ReportRoutes(app *fiber.App, reportHandler handlers.Report, auth fiber.Handler, cfg configs.Config) {
+	staff := middleware.RequireRole(entity.RoleModerator, entity.RoleAdmin)
+
+	app.Post("/v1/report", auth, middleware.RateLimit(cfg.ReportLimit, middleware.ByUser), reportHandler.AddReport)
+
+	g := app.Group("/v1/admin/reports")
+	g.Get("", auth, staff, reportHandler.Queue)
+	g.Post("/:reportId/resolve", auth, staff, reportHandler.Resolve)
+}
@@ -0,0 +1,166 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"segokuning/db/entity"
+)
+
+// feed returns the posts a sees on GET /v1/post.
+func (s *suite) feed(a account) []interface{} {
+	s.t.Helper()
+
+	r := s.do(http.MethodGet, "/v1/post", a.token, nil)
+	s.expect(r, http.StatusOK)
+	posts, _ := r.Body["data"].(map[string]interface{})["data"].([]interface{})
+	return posts
+}
+
+func TestReport(t *testing.T) {
+	s := newSuite(t)
+	s.db.HideThreshold = 2
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	andi := s.register("andiono", "andi@example.com")
+	rina := s.register("rinawati", "rina@example.com")
+	s.befriend(budi, siti)
+	s.befriend(budi, andi)
+
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>beli sekarang</p>", "tags": []string{"promo"}}), http.StatusOK)
+
+	report := func(by account, body map[string]string) response {
+		return s.do(http.MethodPost, "/v1/report", by.token, body)
+	}
+	post := func(reason string) map[string]string {
+		return map[string]string{"targetType": "post", "targetId": "1", "reason": reason}
+	}
+
+	s.expect(report(siti, map[string]string{"targetType": "page", "targetId": "1", "reason": "spam"}), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(report(siti, post("boring")), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(report(siti, map[string]string{"targetType": "post", "targetId": "satu", "reason": "spam"}), http.StatusNotFound, "POST_NOT_FOUND")
+	s.expect(report(budi, post("spam")), http.StatusBadRequest, "CANNOT_REPORT_SELF")
+	// to rina, who can't see the post, it doesn't exist
+	s.expect(report(rina, post("spam")), http.StatusNotFound, "POST_NOT_FOUND")
+
+	r := report(siti, map[string]string{"targetType": "post", "targetId": "1", "reason": "spam", "text": "iklan terus"})
+	s.expect(r, http.StatusOK)
+	if r.data()["status"] != entity.ReportOpen || r.data()["text"] != "iklan terus" {
+		t.Fatalf("report = %s", r.Raw)
+	}
+	s.expect(report(siti, post("other")), http.StatusConflict, "ALREADY_REPORTED")
+
+	// the second report crosses the threshold, nobody sees the post until it's reviewed
+	if len(s.feed(budi)) != 1 {
+		t.Fatal("the post is hidden after one report")
+	}
+	s.expect(report(andi, post("spam")), http.StatusOK)
+	if posts := s.feed(budi); len(posts) != 0 {
+		t.Fatalf("feed of a hidden post = %v", posts)
+	}
+
+	s.expect(s.do(http.MethodGet, "/v1/admin/reports", budi.token, nil), http.StatusForbidden, "FORBIDDEN")
+	s.expect(s.do(http.MethodGet, "/v1/admin/reports?status=closed", mod.token, nil), http.StatusBadRequest, "VALIDATION_FAILED")
+
+	r = s.do(http.MethodGet, "/v1/admin/reports?limit=1", mod.token, nil)
+	s.expect(r, http.StatusOK)
+	queue := r.Body["data"].([]interface{})
+	first := queue[0].(map[string]interface{})
+	if len(queue) != 1 || r.Body["meta"].(map[string]interface{})["total"] != float64(2) ||
+		first["reports"] != float64(2) || first["hidden"] != true || fmt.Sprint(first["reporterId"]) != siti.id {
+		t.Fatalf("queue = %s", r.Raw)
+	}
+
+	resolve := func(id string, body map[string]interface{}) response {
+		return s.do(http.MethodPost, "/v1/admin/reports/"+id+"/resolve", mod.token, body)
+	}
+	dismiss := map[string]interface{}{"action": "dismiss", "reason": "just a promo"}
+
+	s.expect(resolve("1", map[string]interface{}{"action": "ban", "reason": "spam"}), http.StatusBadRequest, "VALIDATION_FAILED")
+	s.expect(resolve("9", dismiss), http.StatusNotFound, "REPORT_NOT_FOUND")
+
+	r = resolve("1", dismiss)
+	s.expect(r, http.StatusOK)
+	if r.data()["status"] != entity.ReportDismissed || r.data()["hidden"] != false {
+		t.Fatalf("dismissed = %s", r.Raw)
+	}
+	// both reports on the post are closed and it's back in the feed
+	s.expect(resolve("2", dismiss), http.StatusConflict, "REPORT_RESOLVED")
+	if len(s.feed(budi)) != 1 {
+		t.Fatal("the post is still hidden after its reports were dismissed")
+	}
+
+	r = s.do(http.MethodGet, "/v1/admin/reports?status=dismissed", mod.token, nil)
+	s.expect(r, http.StatusOK)
+	if meta := r.Body["meta"].(map[string]interface{}); meta["total"] != float64(2) {
+		t.Fatalf("dismissed reports = %s", r.Raw)
+	}
+
+	// reviewed reports don't count toward the threshold, siti may report the post again
+	s.expect(report(siti, post("spam")), http.StatusOK)
+	if len(s.feed(budi)) != 1 {
+		t.Fatal("the post is hidden again after one new report")
+	}
+}
+
+func TestReportResolve(t *testing.T) {
+	s := newSuite(t)
+	admin := s.promote(s.register("adminku", "admin@example.com"), entity.RoleAdmin)
+	mod := s.promote(s.register("moderator", "mod@example.com"), entity.RoleModerator)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+	s.befriend(budi, siti)
+
+	s.expect(s.do(http.MethodPost, "/v1/post", budi.token, map[string]interface{}{"postInHtml": "<p>halo</p>", "tags": []string{"hi"}}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/v1/comment", siti.token, map[string]string{"postId": "1", "comment": "dasar bodoh"}), http.StatusOK)
+	comments := s.feed(budi)[0].(map[string]interface{})["comments"].([]interface{})
+	commentID := fmt.Sprint(comments[0].(map[string]interface{})["commentId"])
+
+	report := func(by account, targetType, targetID string) {
+		s.t.Helper()
+		r := s.do(http.MethodPost, "/v1/report", by.token, map[string]string{"targetType": targetType, "targetId": targetID, "reason": "harassment"})
+		s.expect(r, http.StatusOK)
+	}
+	resolve := func(id string, body map[string]interface{}) response {
+		return s.do(http.MethodPost, "/v1/admin/reports/"+id+"/resolve", mod.token, body)
+	}
+
+	report(budi, "comment", commentID)
+	report(budi, "user", siti.id)
+	report(budi, "user", admin.id)
+
+	// hiding keeps the comment on the post for moderators and out of the feed
+	s.expect(resolve("1", map[string]interface{}{"action": "hide", "reason": "insult"}), http.StatusOK)
+	if comments, _ := s.feed(budi)[0].(map[string]interface{})["comments"].([]interface{}); len(comments) != 0 {
+		t.Fatalf("feed comments after hide = %v", comments)
+	}
+	r := s.do(http.MethodGet, "/v1/admin/posts/1", mod.token, nil)
+	s.expect(r, http.StatusOK)
+	if c := r.data()["comments"].([]interface{})[0].(map[string]interface{}); c["hidden"] != true {
+		t.Fatalf("admin post = %s", r.Raw)
+	}
+	// dismissing a later report leaves what the moderator hid hidden
+	report(budi, "comment", commentID)
+	s.expect(resolve("4", map[string]interface{}{"action": "dismiss", "reason": "already handled"}), http.StatusOK)
+	if comments, _ := s.feed(budi)[0].(map[string]interface{})["comments"].([]interface{}); len(comments) != 0 {
+		t.Fatalf("feed comments after dismissing a moderator-hidden comment = %v", comments)
+	}
+
+	s.expect(resolve("2", map[string]interface{}{"action": "hide", "reason": "insult"}), http.StatusBadRequest, "INVALID_RESOLUTION")
+	s.expect(resolve("3", map[string]interface{}{"action": "suspend", "reason": "insult"}), http.StatusForbidden, "INSUFFICIENT_ROLE")
+
+	r = resolve("2", map[string]interface{}{"action": "suspend", "reason": "repeated insults"})
+	s.expect(r, http.StatusOK)
+	if r.data()["status"] != entity.ReportActioned || r.data()["resolution"] != entity.ResolveSuspend || fmt.Sprint(r.data()["resolvedBy"]) != mod.id {
+		t.Fatalf("suspended = %s", r.Raw)
+	}
+	s.expect(s.do(http.MethodGet, "/v1/post", siti.token, nil), http.StatusUnauthorized)
+
+	actions := s.moderation(mod)
+	want := fmt.Sprint([]string{entity.ActionReportResolve, entity.ActionPostView, entity.ActionReportResolve, entity.ActionUserSuspend, entity.ActionReportResolve})
+	if fmt.Sprint(actions) != want {
+		t.Fatalf("audited actions = %v, want %v", actions, want)
+	}
+}
@@ -0,0 +1,366 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"segokuning/api/handlers"
+	"segokuning/api/middleware"
+	"segokuning/api/responses"
+	"segokuning/api/routes"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/db/fakes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// hit records every route a test reached, TestMain fails a full run that left one out.
+var hit = struct {
+	sync.Mutex
+	routes map[string]bool
+}{routes: map[string]bool{}}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	// a -run filter skips tests on purpose
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if missing := untested(); len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "routes without a test: %s\n", strings.Join(missing, ", "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func untested() []string {
+	app := fiber.New()
+	routes.RouteRegister(app, handlers.Dependencies{})
+
+	hit.Lock()
+	defer hit.Unlock()
+
+	var missing []string
+	for _, r := range app.GetRoutes(true) {
+		key := r.Method + " " + r.Path
+		if r.Method != http.MethodHead && !hit.routes[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+var testConfig = configs.Config{
+	JWTSecret:        "routes-test-secret",
+	BcryptSalt:       4,
+	ReadinessTimeout: time.Second,
+}
+
+type suite struct {
+	t        *testing.T
+	app      *fiber.App
+	db       *fakes.DB
+	objects  *fakes.Objects
+	notifier *fakes.Notifier
+
+	registered int
+}
+
+// newSuite serves every route against fresh fakes.
+func newSuite(t *testing.T) *suite {
+	t.Helper()
+
+	s := &suite{
+		t:        t,
+		db:       fakes.New(),
+		objects:  fakes.NewObjects(),
+		notifier: &fakes.Notifier{},
+	}
+
+	s.app = fiber.New(fiber.Config{ErrorHandler: responses.ErrorHandler})
+	s.app.Use(func(c *fiber.Ctx) error {
+		err := c.Next()
+		if r := c.Route(); r != nil && r.Path != "/" {
+			hit.Lock()
+			hit.routes[c.Method()+" "+r.Path] = true
+			hit.Unlock()
+		}
+		return err
+	})
+	s.app.Use(middleware.Origin())
+
+	routes.RouteRegister(s.app, handlers.Dependencies{
+		Cfg: testConfig,
+		Stores: handlers.Stores{
+			Users:         s.db.Users(),
+			Verification:  s.db.Verification(),
+			PasswordReset: s.db.PasswordReset(),
+			Posts:         s.db.Posts(),
+			Comments:      s.db.Posts(),
+			Friends:       s.db.Friends(),
+			Accounts:      s.db.Accounts(),
+			Admin:         s.db.Admin(),
+			Reports:       s.db.Reports(),
+			Uploads:       s.db.Uploads(),
+			Objects:       s.objects,
+		},
+		Notifier: s.notifier,
+	})
+
+	return s
+}
+
+type response struct {
+	Status int
+	Header http.Header
+	Raw    []byte
+	Body   map[string]interface{}
+}
+
+// data returns the "data" object of a success envelope.
+func (r response) data() map[string]interface{} {
+	data, _ := r.Body["data"].(map[string]interface{})
+	return data
+}
+
+func (r response) code() string {
+	code, _ := r.Body["code"].(string)
+	return code
+}
+
+func (s *suite) do(method, path, token string, body interface{}) response {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	return s.send(req, token)
+}
+
+func (s *suite) send(req *http.Request, token string) response {
+	s.t.Helper()
+
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	res, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatalf("read body: %v", err)
+	}
+
+	r := response{Status: res.StatusCode, Header: res.Header, Raw: raw}
+	if len(raw) > 0 && strings.HasPrefix(res.Header.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := json.Unmarshal(raw, &r.Body); err != nil {
+			s.t.Fatalf("%s %s: decode body: %v", req.Method, req.URL.Path, err)
+		}
+	}
+	return r
+}
+
+// expect fails the test unless r has the status, and the error code when one is given.
+func (s *suite) expect(r response, status int, code ...string) {
+	s.t.Helper()
+
+	if r.Status != status {
+		s.t.Fatalf("status = %d, want %d: %s", r.Status, status, r.Raw)
+	}
+	if len(code) > 0 && r.code() != code[0] {
+		s.t.Fatalf("code = %q, want %q: %s", r.code(), code[0], r.Raw)
+	}
+}
+
+type account struct {
+	id       string
+	name     string
+	email    string
+	password string
+	token    string
+}
+
+// register signs up a user by email and returns their access token.
+func (s *suite) register(name, email string) account {
+	s.t.Helper()
+
+	a := account{name: name, email: email, password: "kopi-tubruk-" + name}
+	r := s.do(http.MethodPost, "/v1/user/register", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": a.email,
+		"name":            a.name,
+		"password":        a.password,
+	})
+	s.expect(r, http.StatusCreated)
+
+	a.token, _ = r.data()["accessToken"].(string)
+	if a.token == "" {
+		s.t.Fatalf("register returned no access token: %s", r.Raw)
+	}
+
+	// the fakes number users from 1 in the order they register
+	s.registered++
+	a.id = fmt.Sprint(s.registered)
+	return a
+}
+
+// login signs a in again and keeps the new token.
+func (s *suite) login(a account) account {
+	s.t.Helper()
+
+	r := s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": a.email,
+		"password":        a.password,
+	})
+	s.expect(r, http.StatusOK)
+	a.token, _ = r.data()["accessToken"].(string)
+	return a
+}
+
+// promote gives a the role from the command line and signs them in again, the role is in the token.
+func (s *suite) promote(a account, role string) account {
+	s.t.Helper()
+
+	if _, err := s.db.Admin().SetRole(context.Background(), entity.Actor{}, a.id, role); err != nil {
+		s.t.Fatalf("set role: %v", err)
+	}
+	return s.login(a)
+}
+
+// befriend makes a and b friends through the API.
+func (s *suite) befriend(a, b account) {
+	s.t.Helper()
+	s.expect(s.do(http.MethodPost, "/v1/friend", a.token, map[string]string{"userId": b.id}), http.StatusOK)
+}
+
+// sentCode returns the last code or token the notifier sent to, the last word of the message.
+func (s *suite) sentCode(to string) string {
+	s.t.Helper()
+
+	msg, ok := s.notifier.Last(to)
+	if !ok {
+		s.t.Fatalf("nothing was sent to %s", to)
+	}
+	words := strings.Fields(msg.Body)
+	return words[len(words)-1]
+}
+
+// resetToken waits for the reset token sent to after the answer, the first code that isn't
+// previous.
+func (s *suite) resetToken(to, previous string) string {
+	s.t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if code := s.sentCode(to); code != previous {
+			return code
+		}
+	}
+	s.t.Fatalf("no reset token was sent to %s", to)
+	return ""
+}
+
+func TestPing(t *testing.T) {
+	s := newSuite(t)
+
+	r := s.do(http.MethodGet, "/ping", "", nil)
+	s.expect(r, http.StatusOK)
+	if string(r.Raw) != "pong" {
+		t.Fatalf("body = %q, want pong", r.Raw)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s := newSuite(t)
+
+	s.expect(s.do(http.MethodGet, "/healthz", "", nil), http.StatusOK)
+
+	r := s.do(http.MethodGet, "/readyz", "", nil)
+	s.expect(r, http.StatusOK)
+	if r.Body["status"] != "ok" {
+		t.Fatalf("readiness = %s", r.Raw)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	s := newSuite(t)
+
+	r := s.do(http.MethodGet, "/openapi.json", "", nil)
+	s.expect(r, http.StatusOK)
+	if _, ok := r.Body["paths"]; !ok {
+		t.Fatalf("spec has no paths: %.200s", r.Raw)
+	}
+
+	r = s.do(http.MethodGet, "/docs", "", nil)
+	s.expect(r, http.StatusOK)
+	if !strings.Contains(r.Header.Get(fiber.HeaderContentType), "text/html") {
+		t.Fatalf("content type = %q", r.Header.Get(fiber.HeaderContentType))
+	}
+	if csp := r.Header.Get(fiber.HeaderContentSecurityPolicy); !strings.Contains(csp, "script-src 'self'") {
+		t.Fatalf("content security policy = %q", csp)
+	}
+	if bytes.Contains(r.Raw, []byte("://")) {
+		t.Fatalf("docs page loads from another origin: %s", r.Raw)
+	}
+
+	for path, contentType := range map[string]string{"/docs/docs.js": "javascript", "/docs/docs.css": "text/css"} {
+		r = s.do(http.MethodGet, path, "", nil)
+		s.expect(r, http.StatusOK)
+		if !strings.Contains(r.Header.Get(fiber.HeaderContentType), contentType) || len(r.Raw) == 0 {
+			t.Fatalf("%s content type = %q, %d bytes", path, r.Header.Get(fiber.HeaderContentType), len(r.Raw))
+		}
+	}
+}
+
+func TestProtectedRoutesNeedToken(t *testing.T) {
+	s := newSuite(t)
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPatch, "/v1/user"},
+		{http.MethodPost, "/v1/user/link/email"},
+		{http.MethodPost, "/v1/user/password"},
+		{http.MethodDelete, "/v1/user/me"},
+		{http.MethodGet, "/v1/user/me/export"},
+		{http.MethodGet, "/v1/post"},
+		{http.MethodPost, "/v1/comment"},
+		{http.MethodGet, "/v1/friend"},
+		{http.MethodPost, "/v1/image"},
+		{http.MethodGet, "/v1/admin/users"},
+	} {
+		r := s.do(route.method, route.path, "", nil)
+		if r.Status != http.StatusUnauthorized {
+			t.Errorf("%s %s without token = %d, want 401", route.method, route.path, r.Status)
+		}
+	}
+
+	r := s.do(http.MethodGet, "/v1/post", "not-a-jwt", nil)
+	s.expect(r, http.StatusUnauthorized)
+}
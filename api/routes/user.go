@@ -3,16 +3,44 @@ package routes
 import (
 	"segokuning/api/handlers"
 	"segokuning/api/middleware"
+	"segokuning/configs"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func UserRoutes(app *fiber.App, userHandler handlers.User) {
+func UserRoutes(app *fiber.App, userHandler handlers.User, auth fiber.Handler, cfg configs.Config) {
 	g := app.Group("/v1/user")
-	g.Post("/register", userHandler.Register)
-	g.Post("/login", userHandler.Login)
+	g.Post("/register",
+		middleware.RateLimit(cfg.RegisterIPLimit, middleware.ByIP),
+		userHandler.Register,
+	)
+	g.Post("/login",
+		middleware.RateLimit(cfg.LoginIPLimit, middleware.ByIP),
+		middleware.RateLimit(cfg.LoginCredentialLimit, middleware.ByCredential),
+		userHandler.Login,
+	)
 	// protected routes
-	g.Patch("", middleware.JWTAuth(), userHandler.UpdateAccount)
-	g.Post("/link/email", middleware.JWTAuth(), userHandler.UpdateEmail)
-	g.Post("/link/phone", middleware.JWTAuth(), userHandler.UpdatePhone)
+	g.Patch("", auth, userHandler.UpdateAccount)
+	g.Post("/link/email", auth, userHandler.UpdateEmail)
+	g.Post("/link/phone", auth, userHandler.UpdatePhone)
+	g.Post("/verify/request",
+		auth,
+		middleware.RateLimit(cfg.VerificationLimit, middleware.ByUser),
+		userHandler.RequestVerification,
+	)
+	g.Post("/verify", auth, userHandler.Verify)
+	g.Post("/password",
+		auth,
+		middleware.RateLimit(cfg.PasswordConfirmLimit, middleware.ByUser),
+		userHandler.ChangePassword,
+	)
+	g.Post("/password/forgot",
+		middleware.RateLimit(cfg.LoginIPLimit, middleware.ByIP),
+		middleware.RateLimit(cfg.PasswordResetLimit, middleware.ByCredential),
+		userHandler.ForgotPassword,
+	)
+	g.Post("/password/reset",
+		middleware.RateLimit(cfg.LoginIPLimit, middleware.ByIP),
+		userHandler.ResetPassword,
+	)
 }
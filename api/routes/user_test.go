@@ -0,0 +1,242 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegister(t *testing.T) {
+	s := newSuite(t)
+	s.register("budiman", "budi@example.com")
+
+	r := s.do(http.MethodPost, "/v1/user/register", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": "budi@example.com",
+		"name":            "budi kedua",
+		"password":        "another-password",
+	})
+	s.expect(r, http.StatusConflict, "EXISTING_USERNAME")
+
+	r = s.do(http.MethodPost, "/v1/user/register", "", map[string]string{
+		"credentialType":  "phone",
+		"credentialValue": "08123",
+		"name":            "x",
+		"password":        "password",
+	})
+	s.expect(r, http.StatusBadRequest, "VALIDATION_FAILED")
+
+	// a verification code goes to the new credential right away
+	if code := s.sentCode("budi@example.com"); len(code) != 6 {
+		t.Fatalf("verification code = %q", code)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	s := newSuite(t)
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{"shorter than MinLength", "abc1234", http.StatusBadRequest},
+		{"on the denylist", "Password123", http.StatusBadRequest},
+		{"72 bytes", strings.Repeat("a", 71) + "b", http.StatusCreated},
+		// 40 characters, but 80 bytes are more than bcrypt reads
+		{"longer than MaxLength in bytes", strings.Repeat("é", 40), http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := s.do(http.MethodPost, "/v1/user/register", "", map[string]string{
+				"credentialType":  "email",
+				"credentialValue": fmt.Sprintf("policy%d@example.com", i),
+				"name":            "policy",
+				"password":        tt.password,
+			})
+			if r.Status != tt.want {
+				t.Fatalf("status = %d, want %d: %s", r.Status, tt.want, r.Raw)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	login := func(password string) response {
+		return s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+			"credentialType":  "email",
+			"credentialValue": budi.email,
+			"password":        password,
+		})
+	}
+
+	r := login(budi.password)
+	s.expect(r, http.StatusOK)
+	if r.data()["email"] != budi.email || r.data()["accessToken"] == "" {
+		t.Fatalf("login = %s", r.Raw)
+	}
+
+	s.expect(login("not-the-password"), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+}
+
+func TestUpdateAccount(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	r := s.do(http.MethodPatch, "/v1/user", budi.token, map[string]string{
+		"name":     "budi santoso",
+		"imageUrl": "https://example.com/budi.jpg",
+	})
+	s.expect(r, http.StatusOK)
+	if r.data()["name"] != "budi santoso" {
+		t.Fatalf("update = %s", r.Raw)
+	}
+
+	r = s.do(http.MethodPatch, "/v1/user", budi.token, map[string]string{"name": "budi santoso", "imageUrl": "not a url"})
+	s.expect(r, http.StatusBadRequest, "VALIDATION_FAILED")
+}
+
+func TestLinkCredentials(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	siti := s.register("sitinur", "siti@example.com")
+
+	r := s.do(http.MethodPost, "/v1/user/link/phone", budi.token, map[string]string{"phone": "+628123456"})
+	s.expect(r, http.StatusOK)
+	if r.data()["phone"] != "+628123456" {
+		t.Fatalf("link phone = %s", r.Raw)
+	}
+	s.sentCode("+628123456")
+
+	r = s.do(http.MethodPost, "/v1/user/link/phone", siti.token, map[string]string{"phone": "+628123456"})
+	s.expect(r, http.StatusConflict, "PHONE_EXISTS")
+
+	r = s.do(http.MethodPost, "/v1/user/link/phone", budi.token, map[string]string{"phone": "+628999999"})
+	s.expect(r, http.StatusBadRequest, "PHONE_ALREADY_SET")
+
+	r = s.do(http.MethodPost, "/v1/user/link/email", budi.token, map[string]string{"email": "budi@other.com"})
+	s.expect(r, http.StatusBadRequest, "EMAIL_ALREADY_SET")
+}
+
+func TestVerify(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	r := s.do(http.MethodPost, "/v1/user/verify/request", budi.token, map[string]string{"credentialType": "phone"})
+	s.expect(r, http.StatusBadRequest, "CREDENTIAL_NOT_SET")
+
+	r = s.do(http.MethodPost, "/v1/user/verify/request", budi.token, map[string]string{"credentialType": "email"})
+	s.expect(r, http.StatusOK)
+
+	code := s.sentCode(budi.email)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	r = s.do(http.MethodPost, "/v1/user/verify", budi.token, map[string]string{"credentialType": "email", "code": wrong})
+	s.expect(r, http.StatusBadRequest, "INVALID_CODE")
+
+	r = s.do(http.MethodPost, "/v1/user/verify", budi.token, map[string]string{"credentialType": "email", "code": code})
+	s.expect(r, http.StatusOK)
+	if r.data()["credentialValue"] != budi.email {
+		t.Fatalf("verify = %s", r.Raw)
+	}
+
+	r = s.do(http.MethodPost, "/v1/user/verify/request", budi.token, map[string]string{"credentialType": "email"})
+	s.expect(r, http.StatusConflict, "ALREADY_VERIFIED")
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	r := s.do(http.MethodPost, "/v1/user/password", budi.token, map[string]string{
+		"currentPassword": "wrong-password",
+		"newPassword":     "a-brand-new-password",
+	})
+	s.expect(r, http.StatusBadRequest, "WRONG_PASSWORD")
+
+	r = s.do(http.MethodPost, "/v1/user/password", budi.token, map[string]string{
+		"currentPassword": budi.password,
+		"newPassword":     "a-brand-new-password",
+	})
+	s.expect(r, http.StatusOK)
+	token, _ := r.data()["accessToken"].(string)
+
+	// the change signs out every other session and keeps this one with the new token
+	s.expect(s.do(http.MethodGet, "/v1/post", budi.token, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/v1/post", token, nil), http.StatusOK)
+}
+
+func TestResetPassword(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+
+	forgot := func() response {
+		return s.do(http.MethodPost, "/v1/user/password/forgot", "", map[string]string{
+			"credentialType":  "email",
+			"credentialValue": budi.email,
+		})
+	}
+
+	// unverified credentials get the same answer without a token
+	s.expect(forgot(), http.StatusOK)
+	verificationCode := s.sentCode(budi.email)
+
+	s.expect(s.do(http.MethodPost, "/v1/user/verify", budi.token, map[string]string{
+		"credentialType": "email",
+		"code":           verificationCode,
+	}), http.StatusOK)
+
+	s.expect(forgot(), http.StatusOK)
+	token := s.resetToken(budi.email, verificationCode)
+
+	reset := func(token string) response {
+		return s.do(http.MethodPost, "/v1/user/password/reset", "", map[string]string{
+			"token":       token,
+			"newPassword": "reset-to-this-one",
+		})
+	}
+	s.expect(reset(token), http.StatusOK)
+	s.expect(reset(token), http.StatusBadRequest, "INVALID_RESET_TOKEN")
+
+	s.expect(s.do(http.MethodGet, "/v1/post", budi.token, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/v1/user/login", "", map[string]string{
+		"credentialType":  "email",
+		"credentialValue": budi.email,
+		"password":        "reset-to-this-one",
+	}), http.StatusOK)
+}
+
+func TestForgotPasswordAnswersBeforeSending(t *testing.T) {
+	s := newSuite(t)
+	budi := s.register("budiman", "budi@example.com")
+	s.expect(s.do(http.MethodPost, "/v1/user/verify", budi.token, map[string]string{
+		"credentialType": "email",
+		"code":           s.sentCode(budi.email),
+	}), http.StatusOK)
+	verificationCode := s.sentCode(budi.email)
+
+	const delay = 500 * time.Millisecond
+	s.notifier.SetDelay(delay)
+
+	// a registered credential must not be told apart by waiting on the notifier
+	for _, credential := range []string{budi.email, "nobody@example.com"} {
+		start := time.Now()
+		s.expect(s.do(http.MethodPost, "/v1/user/password/forgot", "", map[string]string{
+			"credentialType":  "email",
+			"credentialValue": credential,
+		}), http.StatusOK)
+		if elapsed := time.Since(start); elapsed >= delay {
+			t.Errorf("forgot password for %s took %s, the notifier's delay is %s", credential, elapsed, delay)
+		}
+	}
+
+	s.resetToken(budi.email, verificationCode)
+}
@@ -0,0 +1,421 @@
+package load
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"segokuning/db/seed"
+)
+
+// Run executes `load [flags]` and exits non-zero on failure.
+func Run(args []string) {
+	if err := run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "load: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	url         string
+	users       int
+	prefix      string
+	password    string
+	concurrency int
+	duration    time.Duration
+	mix         string
+	seed        int64
+}
+
+func run(args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `usage: segokuning load [flags]
+
+logs in users created by "segokuning seed" and replays a mix of the /v1 endpoints against a running
+server, then reports the latency percentiles of every endpoint. Raise the login and write rate limits
+of the server first, or most requests end in 429.
+
+operations: `+strings.Join(operationNames(), ", "))
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.url, "url", "http://localhost:8080", "server to load")
+	flags.IntVar(&opts.users, "users", 100, "seeded users to log in, the first n")
+	flags.StringVar(&opts.prefix, "prefix", "user", "email prefix given to seed")
+	flags.StringVar(&opts.password, "password", "password", "password given to seed")
+	flags.IntVar(&opts.concurrency, "concurrency", 16, "requests in flight")
+	flags.DurationVar(&opts.duration, "duration", 30*time.Second, "how long to send requests")
+	flags.StringVar(&opts.mix, "mix", "feed=50,search=10,friends=20,post=10,comment=10", "weight of every operation")
+	flags.Int64Var(&opts.seed, "seed", 1, "random seed of the request sequence")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	mix, err := parseMix(opts.mix)
+	if err != nil {
+		return err
+	}
+
+	client := &client{
+		base: strings.TrimRight(opts.url, "/"),
+		http: &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: opts.concurrency}},
+	}
+
+	sessions, err := login(client, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d users logged in, sending requests for %s\n", len(sessions), opts.duration)
+
+	rec := newRecorder()
+	ctx, cancel := context.WithTimeout(context.Background(), opts.duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				s := sessions[rng.Intn(len(sessions))]
+				name := mix.pick(rng)
+				if name == "comment" && !s.hasPosts() {
+					// nothing to comment on before the first feed of this user
+					name = "feed"
+				}
+				took, status, err := operations[name](ctx, client, s, rng)
+				if ctx.Err() != nil && errors.Is(err, context.DeadlineExceeded) {
+					return
+				}
+				rec.add(name, took, status, err)
+			}
+		}(rand.New(rand.NewSource(opts.seed + int64(w))))
+	}
+	wg.Wait()
+
+	rec.report(os.Stdout, time.Since(start))
+	return nil
+}
+
+type session struct {
+	email string
+	token string
+
+	mu sync.Mutex
+	// posts seen in the feed of this user, theirs and their friends', the ones they may comment on
+	posts []string
+}
+
+func (s *session) seen(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts = append(s.posts, ids...)
+	if len(s.posts) > 50 {
+		s.posts = s.posts[len(s.posts)-50:]
+	}
+}
+
+func (s *session) hasPosts() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.posts) > 0
+}
+
+// post picks a seen post, call it after hasPosts.
+func (s *session) post(rng *rand.Rand) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts[rng.Intn(len(s.posts))]
+}
+
+func login(c *client, opts options) ([]*session, error) {
+	var (
+		mu       sync.Mutex
+		sessions []*session
+		failures = map[string]int{}
+		wg       sync.WaitGroup
+		next     = make(chan int)
+	)
+
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range next {
+				email := seed.Email(opts.prefix, n)
+				var body struct {
+					Data struct {
+						AccessToken string `json:"accessToken"`
+					} `json:"data"`
+				}
+				_, status, err := c.do(context.Background(), http.MethodPost, "/v1/user/login", "", map[string]string{
+					"credentialType":  "email",
+					"credentialValue": email,
+					"password":        opts.password,
+				}, &body)
+
+				mu.Lock()
+				if err != nil || status != http.StatusOK {
+					failures[failure(status, err)]++
+				} else {
+					sessions = append(sessions, &session{email: email, token: body.Data.AccessToken})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for n := 1; n <= opts.users; n++ {
+		next <- n
+	}
+	close(next)
+	wg.Wait()
+
+	for reason, count := range failures {
+		fmt.Fprintf(os.Stderr, "%d logins failed: %s\n", count, reason)
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("no user could log in, seed the database with the same -prefix and -password")
+	}
+	return sessions, nil
+}
+
+type operation func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error)
+
+var operations = map[string]operation{
+	"feed": func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error) {
+		return feed(ctx, c, s, url.Values{"limit": {"10"}, "offset": {strconv.Itoa(10 * rng.Intn(3))}})
+	},
+	"search": func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error) {
+		return feed(ctx, c, s, url.Values{"limit": {"10"}, "search": {words[rng.Intn(len(words))]}})
+	},
+	"friends": func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error) {
+		query := url.Values{"limit": {"10"}, "onlyFriend": {strconv.FormatBool(rng.Intn(2) == 0)}}
+		return c.do(ctx, http.MethodGet, "/v1/friend?"+query.Encode(), s.token, nil, nil)
+	},
+	"post": func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error) {
+		return c.do(ctx, http.MethodPost, "/v1/post", s.token, map[string]interface{}{
+			"postInHtml": "<p>" + words[rng.Intn(len(words))] + " " + words[rng.Intn(len(words))] + "</p>",
+			"tags":       []string{words[rng.Intn(len(words))]},
+		}, nil)
+	},
+	"comment": func(ctx context.Context, c *client, s *session, rng *rand.Rand) (time.Duration, int, error) {
+		return c.do(ctx, http.MethodPost, "/v1/comment", s.token, map[string]string{
+			"postId":  s.post(rng),
+			"comment": words[rng.Intn(len(words))] + " " + words[rng.Intn(len(words))],
+		}, nil)
+	},
+}
+
+var words = []string{"kopi", "pagi", "macet", "hujan", "pantai", "liburan", "makan", "teman", "kerja", "senja"}
+
+func operationNames() []string {
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func feed(ctx context.Context, c *client, s *session, query url.Values) (time.Duration, int, error) {
+	var body struct {
+		Data []struct {
+			PostID int `json:"postId"`
+		} `json:"data"`
+	}
+	took, status, err := c.do(ctx, http.MethodGet, "/v1/post?"+query.Encode(), s.token, nil, &body)
+	if err == nil {
+		ids := make([]string, len(body.Data))
+		for i, p := range body.Data {
+			ids[i] = strconv.Itoa(p.PostID)
+		}
+		s.seen(ids)
+	}
+	return took, status, err
+}
+
+type mix struct {
+	names   []string
+	weights []int
+	total   int
+}
+
+// parseMix reads "feed=50,post=10", the chance of an operation is its share of the total weight.
+func parseMix(spec string) (mix, error) {
+	var m mix
+	for _, part := range strings.Split(spec, ",") {
+		name, weight, found := strings.Cut(strings.TrimSpace(part), "=")
+		if _, ok := operations[name]; !ok || !found {
+			return mix{}, fmt.Errorf("invalid mix %q, want name=weight with names from %s", part, strings.Join(operationNames(), ", "))
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return mix{}, fmt.Errorf("invalid weight %q of %s", weight, name)
+		}
+		m.names = append(m.names, name)
+		m.weights = append(m.weights, w)
+		m.total += w
+	}
+	if m.total == 0 {
+		return mix{}, fmt.Errorf("the mix %q has no weight", spec)
+	}
+	return m, nil
+}
+
+func (m mix) pick(rng *rand.Rand) string {
+	n := rng.Intn(m.total)
+	for i, w := range m.weights {
+		if n < w {
+			return m.names[i]
+		}
+		n -= w
+	}
+	return m.names[len(m.names)-1]
+}
+
+type client struct {
+	base string
+	http *http.Client
+}
+
+// do sends a JSON request and decodes a 2xx response into out, it returns how long the round trip took.
+func (c *client) do(ctx context.Context, method, path, token string, in, out interface{}) (time.Duration, int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return time.Since(start), 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	took := time.Since(start)
+	if err != nil {
+		return took, resp.StatusCode, err
+	}
+	if out != nil && resp.StatusCode/100 == 2 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return took, resp.StatusCode, err
+		}
+	}
+	return took, resp.StatusCode, nil
+}
+
+func failure(status int, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	failures  map[string]map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: map[string][]time.Duration{},
+		failures:  map[string]map[string]int{},
+	}
+}
+
+func (r *recorder) add(name string, took time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies[name] = append(r.latencies[name], took)
+	if err != nil || status/100 != 2 {
+		if r.failures[name] == nil {
+			r.failures[name] = map[string]int{}
+		}
+		r.failures[name][failure(status, err)]++
+	}
+}
+
+func (r *recorder) report(w io.Writer, elapsed time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\trequests\tfailed\treq/s\tp50\tp90\tp99\tmax\t")
+
+	var all []time.Duration
+	names := make([]string, 0, len(r.latencies))
+	for name := range r.latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failedTotal := 0
+	row := func(name string, latencies []time.Duration, failed int) {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", name, len(latencies), failed,
+			float64(len(latencies))/elapsed.Seconds(),
+			percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.99), percentile(latencies, 1))
+	}
+	for _, name := range names {
+		failed := 0
+		for _, count := range r.failures[name] {
+			failed += count
+		}
+		failedTotal += failed
+		all = append(all, r.latencies[name]...)
+		row(name, r.latencies[name], failed)
+	}
+	row("all", all, failedTotal)
+	tw.Flush()
+
+	for _, name := range names {
+		for reason, count := range r.failures[name] {
+			fmt.Fprintf(w, "%s: %d failed with %s\n", name, count, reason)
+		}
+	}
+}
+
+// percentile takes sorted latencies and returns the smallest one at least q of them don't exceed.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(10 * time.Microsecond)
+}
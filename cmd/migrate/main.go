@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"segokuning/configs"
+	"segokuning/db/connections"
+	"segokuning/db/migrations"
+	"segokuning/internal/logging"
+)
+
+const usage = `usage: segokuning migrate <command>
+
+commands:
+  up       apply every pending migration
+  down     revert the last applied migration
+  status   show the applied version and the pending migrations
+  to N     migrate up or down to version N, 0 reverts everything
+  verify   report rows breaking the integrity checks, exits 1 when there are any`
+
+// Run executes `migrate <args>` and exits non-zero on failure.
+func Run(args []string) {
+	if err := run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	config, err := configs.LoadDBConfig()
+	if err != nil {
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	logger, err := logging.New(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	dbPool, err := connections.NewPgConn(config)
+	if err != nil {
+		return fmt.Errorf("failed open connection to db: %w", err)
+	}
+	defer dbPool.Close()
+
+	migrator, err := migrations.New(dbPool)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("missing version\n%s", usage)
+		}
+		target, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrator.To(ctx, uint(target))
+	case "status":
+		return status(ctx, migrator)
+	case "verify":
+		return verify(ctx, migrator)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func status(ctx context.Context, migrator *migrations.Migrator) error {
+	current, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version %d of %d", current, migrator.Latest())
+	if dirty {
+		fmt.Print(" (dirty)")
+	}
+	fmt.Println()
+
+	for _, mig := range migrator.Migrations() {
+		state := "pending"
+		if mig.Version <= current {
+			state = "applied"
+		}
+		fmt.Printf("  %06d_%s  %s\n", mig.Version, mig.Name, state)
+	}
+	return nil
+}
+
+func verify(ctx context.Context, migrator *migrations.Migrator) error {
+	violations, err := migrator.Verify(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(violations) == 0 {
+		fmt.Printf("all %d checks passed\n", len(migrations.Checks))
+		return nil
+	}
+
+	for _, v := range violations {
+		fmt.Printf("  %-30s %6d rows  %s\n", v.Check.Name, v.Rows, v.Check.Description)
+	}
+	return fmt.Errorf("%d of %d checks failed, 000009_schema_integrity repairs these rows when applied", len(violations), len(migrations.Checks))
+}
@@ -0,0 +1,68 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"segokuning/configs"
+	"segokuning/db/connections"
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+	"segokuning/internal/logging"
+)
+
+const usage = `usage: segokuning role <email or phone> [user|moderator|admin]
+
+shows the role of a user, or changes it and signs them out. The change is audited without an actor,
+this is how the first admin is made.`
+
+// Run executes `role <args>` and exits non-zero on failure.
+func Run(args []string) {
+	if err := run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "role: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("%s", usage)
+	}
+
+	config, err := configs.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	logger, err := logging.New(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	dbPool, err := connections.NewPgConn(config)
+	if err != nil {
+		return fmt.Errorf("failed open connection to db: %w", err)
+	}
+	defer dbPool.Close()
+
+	ctx := context.Background()
+	admin := functions.NewAdmin(dbPool, config)
+
+	usr, err := admin.UserByCredential(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		usr, err = admin.SetRole(ctx, entity.Actor{UserAgent: "segokuning role"}, usr.Id, args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("user %s (%s) is %s\n", usr.Id, usr.Name, usr.Role)
+	return nil
+}
@@ -0,0 +1,75 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"segokuning/configs"
+	"segokuning/db/connections"
+	"segokuning/db/seed"
+	"segokuning/internal/logging"
+)
+
+// Run executes `seed [flags]` and exits non-zero on failure.
+func Run(args []string) {
+	if err := run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	var opts seed.Options
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: segokuning seed [flags]\n\nfills the configured database with generated users, friendships, posts and comments")
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&opts.Users, "users", 1000, "users to create")
+	flags.IntVar(&opts.Friends, "friends", 20, "average friends per user")
+	flags.IntVar(&opts.Posts, "posts", 5, "average posts per user")
+	flags.IntVar(&opts.Comments, "comments", 5, "most comments on a post")
+	flags.Int64Var(&opts.Seed, "seed", 1, "random seed, the same seed gives the same data")
+	flags.StringVar(&opts.Prefix, "prefix", "user", "emails are <prefix><n>@example.com")
+	flags.StringVar(&opts.Password, "password", "password", "password of every user")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	config, err := configs.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	logger, err := logging.New(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	dbPool, err := connections.NewPgConn(config)
+	if err != nil {
+		return fmt.Errorf("failed open connection to db: %w", err)
+	}
+	defer dbPool.Close()
+
+	start := time.Now()
+	stats, err := seed.New(dbPool, config).Run(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d users, %d friendships, %d posts, %d comments in %s\n",
+		stats.Users, stats.Friendships, stats.Posts, stats.Comments, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("log in as %s .. %s with password %q\n",
+		seed.Email(opts.Prefix, 1), seed.Email(opts.Prefix, opts.Users), opts.Password)
+	return nil
+}
@@ -0,0 +1,121 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"segokuning/configs"
+	"segokuning/db/connections"
+	"segokuning/db/functions"
+	"segokuning/internal/logging"
+)
+
+const usage = `usage: segokuning timeline <command> [flags]
+
+commands:
+  rebuild  rewrite every timeline from posts and friendships, run it before switching FEED_MODE to timeline
+  check    compare the newest posts of every timeline against the feed the friendships give,
+           exits 1 when any differ`
+
+// Run executes `timeline <args>` and exits non-zero on failure.
+func Run(args []string) {
+	if err := run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "timeline: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	config, err := configs.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	flags := flag.NewFlagSet("timeline "+args[0], flag.ContinueOnError)
+	batch := flags.Int("batch", 500, "users per transaction")
+	depth := flags.Int("depth", min(50, config.TimelineBackfill), "newest posts compared per user, check only")
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *batch <= 0 || *depth <= 0 {
+		return fmt.Errorf("-batch and -depth must be positive")
+	}
+
+	logger, err := logging.New(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	dbPool, err := connections.NewPgConn(config)
+	if err != nil {
+		return fmt.Errorf("failed open connection to db: %w", err)
+	}
+	defer dbPool.Close()
+
+	ctx := context.Background()
+	timelines := functions.NewTimeline(dbPool, config)
+
+	switch args[0] {
+	case "rebuild":
+		return rebuild(ctx, timelines, *batch)
+	case "check":
+		return check(ctx, timelines, *batch, *depth)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func rebuild(ctx context.Context, timelines *functions.Timeline, batch int) error {
+	start := time.Now()
+	for after := 0; ; {
+		last, err := timelines.Rebuild(ctx, after, batch)
+		if err != nil {
+			return fmt.Errorf("rebuild timelines after user %d: %w", after, err)
+		}
+		if last == after {
+			break
+		}
+		after = last
+		slog.Info("rebuilt timelines", "through_user", last)
+	}
+
+	fmt.Printf("rebuilt every timeline in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func check(ctx context.Context, timelines *functions.Timeline, batch, depth int) error {
+	drifted := 0
+	for after := 0; ; {
+		drifts, last, err := timelines.Check(ctx, after, batch, depth)
+		if err != nil {
+			return fmt.Errorf("check timelines after user %d: %w", after, err)
+		}
+		for _, d := range drifts {
+			fmt.Printf("  user %-10d missing %v  extra %v\n", d.UserID, d.Missing, d.Extra)
+		}
+		drifted += len(drifts)
+		if last == after {
+			break
+		}
+		after = last
+	}
+
+	if drifted == 0 {
+		fmt.Printf("every timeline matches its feed in the newest %d posts\n", depth)
+		return nil
+	}
+	return fmt.Errorf("%d timelines differ from their feed, `segokuning timeline rebuild` rewrites them", drifted)
+}
@@ -2,52 +2,181 @@ package webservices
 
 import (
 	"context"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"segokuning/api/handlers"
+	"segokuning/api/middleware"
 	"segokuning/api/responses"
 	"segokuning/api/routes"
 	"segokuning/configs"
 	"segokuning/db/connections"
+	"segokuning/db/functions"
+	"segokuning/db/migrations"
+	"segokuning/internal/cache"
+	"segokuning/internal/cleanup"
+	"segokuning/internal/logging"
+	"segokuning/internal/metrics"
+	"segokuning/internal/notify"
+	"segokuning/internal/timeline"
+	"segokuning/internal/tracing"
+	"segokuning/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// fatal logs at error level and exits, the slog counterpart of log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func Run() {
-	app := fiber.New(
+	config, err := configs.LoadConfig()
+	if err != nil {
+		fatal("cannot load config", "error", err)
+	}
+
+	app := fiber.New(middleware.TrustProxy(
 		fiber.Config{
 			StrictRouting:     true,
 			EnablePrintRoutes: true,
 			CaseSensitive:     true,
+			ErrorHandler:      responses.ErrorHandler,
 		},
-	)
+		config,
+	))
 
-	config, err := configs.LoadConfig()
+	logger, err := logging.New(config.LogLevel)
+	if err != nil {
+		fatal("cannot create logger", "error", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config)
 	if err != nil {
-		log.Fatal("Cannot load config:", err)
+		fatal("cannot setup tracing", "error", err)
 	}
 
 	dbPool, err := connections.NewPgConn(config)
 	if err != nil {
-		log.Fatalf("failed open connection to db: %v", err)
+		fatal("failed open connection to db", "error", err)
 	}
 
 	err = dbPool.Ping(context.Background())
 	if err != nil {
-		log.Fatalf("FAILED PING TO DB: %v", err)
+		fatal("failed ping to db", "error", err)
+	}
+
+	// refuse to serve a schema the code doesn't match, `migrate up` has to run first
+	migrator, err := migrations.New(dbPool)
+	if err != nil {
+		dbPool.Close()
+		fatal("cannot load migrations", "error", err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		dbPool.Close()
+		fatal("database schema is not up to date", "error", err)
+	}
+
+	readPool, err := connections.NewReplicaConn(config)
+	if err != nil {
+		dbPool.Close()
+		fatal("failed open connection to db replica", "error", err)
+	}
+	if readPool != nil {
+		if err := readPool.Ping(context.Background()); err != nil {
+			closePools(dbPool, readPool)
+			fatal("failed ping to db replica", "error", err)
+		}
+		prometheus.MustRegister(metrics.NewPoolCollector(readPool, "replica"))
+	}
+
+	prometheus.MustRegister(metrics.NewPoolCollector(dbPool, "primary"))
+
+	// serve metrics apart from the API so /metrics is never exposed publicly
+	metricsServer := metrics.NewServer(config.PrometheusAddress)
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+
+	notifier, err := notify.New(config)
+	if err != nil {
+		fatal("cannot create notification sender", "error", err)
+	}
+
+	// feeds fall back to the database while the cache is down, so it isn't checked for readiness
+	feedCache, err := cache.New(config)
+	if err != nil {
+		closePools(dbPool, readPool)
+		fatal("cannot create cache", "error", err)
 	}
 
 	deps := handlers.Dependencies{
-		Cfg:    config,
-		DbPool: dbPool,
+		Cfg:      config,
+		DbPool:   dbPool,
+		ReadPool: readPool,
+		Stores:   handlers.NewStores(dbPool, readPool, feedCache, config),
+		Notifier: notifier,
+	}
+
+	// erase accounts deactivated past retention and remove storage objects of deleted accounts in the background
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	var cleanups sync.WaitGroup
+	storageCleanup := cleanup.Storage{
+		Queue:    functions.NewStorageDeletion(dbPool, config),
+		Storage:  utils.NewImageUploader(config),
+		Interval: config.StorageCleanupInterval,
+		Batch:    50,
+	}
+	deactivatedCleanup := cleanup.Deactivated{
+		Accounts: functions.NewAccount(dbPool, config).WithCache(feedCache),
+		Interval: config.DeactivationPurgeInterval,
+		Batch:    50,
+	}
+	cleanups.Add(2)
+	go func() {
+		defer cleanups.Done()
+		storageCleanup.Run(cleanupCtx)
+	}()
+	go func() {
+		defer cleanups.Done()
+		deactivatedCleanup.Run(cleanupCtx)
+	}()
+
+	// fan new posts out to the friends' timelines, stopped along with the cleanups
+	if config.FeedMode == "timeline" {
+		fanout := timeline.Fanout{
+			Timelines: functions.NewTimeline(dbPool, config).WithCache(feedCache),
+			Interval:  config.TimelineFanoutInterval,
+			Batch:     config.TimelineFanoutBatch,
+		}
+		cleanups.Add(1)
+		go func() {
+			defer cleanups.Done()
+			fanout.Run(cleanupCtx)
+		}()
 	}
 
 	// load Middlewares
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Origin())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.Logger())
 	app.Use(recover.New())
-	app.Use(logger.New())
+	app.Use(middleware.Metrics())
 	app.Use(cors.New())
 
 	// register route in another package
@@ -55,9 +184,58 @@ func Run() {
 
 	// handle unavailable route
 	app.Use(func(c *fiber.Ctx) error {
-		return responses.ReturnTheResponse(c, true, int(404), "Not Found", nil)
+		return fiber.ErrNotFound
 	})
 
 	// Here we go!
-	log.Fatalln(app.Listen(":" + config.APPPort))
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":" + config.APPPort)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-listenErr:
+		closePools(dbPool, readPool)
+		fatal("http server stopped", "error", err)
+	case sig := <-quit:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+
+	// stop accepting connections and drain the in-flight requests before the pool goes away
+	if err := app.ShutdownWithTimeout(config.ShutdownTimeout); err != nil {
+		slog.Error("failed shutdown http server", "error", err)
+	}
+
+	stopCleanup()
+	cleanups.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		slog.Error("failed shutdown metrics server", "error", err)
+	}
+
+	closePools(dbPool, readPool)
+
+	if closer, ok := feedCache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("failed close cache", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed flush traces", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+func closePools(pools ...*pgxpool.Pool) {
+	for _, pool := range pools {
+		if pool != nil {
+			pool.Close()
+		}
+	}
 }
@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Production is the ENV value that turns on the stricter checks in Validate.
+const Production = "production"
+
 type Config struct {
 	DbName     string
 	DbPort     string
@@ -13,48 +18,282 @@ type Config struct {
 	DbUsername string
 	DbPassword string
 
-	APPPort string
-	ENV     string
+	// read-only queries go to the replica when DbReplicaHost is set
+	DbReplicaHost string
+	DbReplicaPort string
+
+	DbMaxConns          int32
+	DbMinConns          int32
+	DbMaxConnLifetime   time.Duration
+	DbMaxConnIdleTime   time.Duration
+	DbHealthCheckPeriod time.Duration
+	DbStatementTimeout  time.Duration
+	DbApplicationName   string
+	DbSSLMode           string
+	DbSSLRootCert       string
+
+	APPPort  string
+	ENV      string
+	LogLevel string
+
+	// behind a load balancer the client address is read from ProxyHeader, only on connections
+	// from TrustedProxies, so rate limits and audit entries see the client and not the balancer
+	ProxyHeader    string
+	TrustedProxies []string
+
+	ShutdownTimeout       time.Duration
+	ReadinessTimeout      time.Duration
+	ReadinessCheckStorage bool
 
 	PrometheusAddress string
 
+	StorageCleanupInterval time.Duration
+
+	// deactivated accounts come back on login within DeactivationRetention, after that they
+	// are erased by a job running every DeactivationPurgeInterval
+	DeactivationRetention     time.Duration
+	DeactivationPurgeInterval time.Duration
+
+	TracingExporter    string
+	TracingSampleRatio float64
+	OTLPEndpoint       string
+
 	JWTSecret  string
 	BcryptSalt int
 
+	// how long the auth middleware trusts a looked up token version and account status
+	SessionCacheTTL time.Duration
+
+	// login lockout after LoginMaxFailures failed attempts within LoginLockout
+	LoginMaxFailures int
+	LoginLockout     time.Duration
+
+	// credentials left unverified past VerificationGracePeriod can't login nor hold their value
+	VerificationCodeTTL     time.Duration
+	VerificationMaxAttempts int
+	VerificationGracePeriod time.Duration
+
+	PasswordResetTTL time.Duration
+
+	// feed pages, friend ids and creator profiles are cached for CacheTTL, CacheSize entries in
+	// each process with the lru driver or shared in redis
+	CacheDriver   string
+	CacheSize     int
+	CacheTTL      time.Duration
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// FeedMode is pull to query feeds from friendships on every request, timeline to read them
+	// from timelines written when a post is made. The fan-out writes queued posts every
+	// TimelineFanoutInterval, TimelineFanoutBatch at a time, a new friend's TimelineBackfill most
+	// recent posts are copied in
+	FeedMode               string
+	TimelineFanoutInterval time.Duration
+	TimelineFanoutBatch    int
+	TimelineBackfill       int
+
+	// posts and comments with this many open reports are hidden until reviewed, 0 never hides them
+	ReportHideThreshold int
+
+	NotifyDriver     string
+	NotifyFile       string
+	NotifyWebhookURL string
+
+	LoginIPLimit         RateLimit
+	LoginCredentialLimit RateLimit
+	RegisterIPLimit      RateLimit
+	VerificationLimit    RateLimit
+	PasswordResetLimit   RateLimit
+	PasswordConfirmLimit RateLimit
+	ExportLimit          RateLimit
+	PostLimit            RateLimit
+	CommentLimit         RateLimit
+	FriendLimit          RateLimit
+	ReportLimit          RateLimit
+
 	S3ID        string
 	S3SecretKey string
 	S3BaseURL   string
 }
 
+// LoadConfig reads the config once at startup from the environment, <KEY>_FILE secrets and the
+// optional YAML or TOML file named by CONFIG_FILE, in that order of precedence, then validates it.
 func LoadConfig() (Config, error) {
-	config := Config{
-		DbName:     os.Getenv("DB_NAME"),
-		DbHost:     os.Getenv("DB_HOST"),
-		DbPort:     os.Getenv("DB_PORT"),
-		DbUsername: os.Getenv("DB_USERNAME"),
-		DbPassword: os.Getenv("DB_PASSWORD"),
+	config, err := load()
+	if err != nil {
+		return Config{}, err
+	}
 
-		APPPort: os.Getenv("APP_PORT"),
-		ENV:     os.Getenv("ENV"),
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
 
-		PrometheusAddress: os.Getenv("PROMETHEUS_ADDRESS"),
+	return config, nil
+}
 
-		JWTSecret: os.Getenv("JWT_SECRET"),
+// LoadDBConfig loads the config checking only the database settings, for commands such as migrate
+// that don't serve requests and shouldn't need the server's secrets.
+func LoadDBConfig() (Config, error) {
+	config, err := load()
+	if err != nil {
+		return Config{}, err
+	}
 
-		S3ID:        os.Getenv("S3_ID"),
-		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
-		S3BaseURL:   os.Getenv("S3_BASE_URL"),
+	if err := config.ValidateDB(); err != nil {
+		return Config{}, err
 	}
-	salt, err := strconv.Atoi(os.Getenv("BCRYPT_SALT"))
+
+	return config, nil
+}
+
+func load() (Config, error) {
+	src, err := newSource(os.Getenv("CONFIG_FILE"))
 	if err != nil {
-		return Config{}, fmt.Errorf("failed get bcrypt salt %v", err)
+		return Config{}, err
 	}
 
-	if os.Getenv("APP_PORT") == "" {
-		config.APPPort = "8080"
+	config := Config{
+		DbName:     src.get("DB_NAME"),
+		DbHost:     src.get("DB_HOST"),
+		DbPort:     src.get("DB_PORT"),
+		DbUsername: src.get("DB_USERNAME"),
+		DbPassword: src.get("DB_PASSWORD"),
+
+		DbReplicaHost: src.get("DB_REPLICA_HOST"),
+
+		DbMaxConns:          int32(src.int("DB_MAX_CONNS", 15)),
+		DbMinConns:          int32(src.int("DB_MIN_CONNS", 5)),
+		DbMaxConnLifetime:   src.duration("DB_MAX_CONN_LIFETIME", time.Hour),
+		DbMaxConnIdleTime:   src.duration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute),
+		DbHealthCheckPeriod: src.duration("DB_HEALTH_CHECK_PERIOD", 5*time.Second),
+		DbStatementTimeout:  src.duration("DB_STATEMENT_TIMEOUT", 0),
+		DbApplicationName:   src.string("DB_APPLICATION_NAME", "segokuning"),
+		DbSSLMode:           src.get("DB_SSL_MODE"),
+		DbSSLRootCert:       src.get("DB_SSL_ROOT_CERT"),
+
+		APPPort:  src.string("APP_PORT", "8080"),
+		ENV:      src.get("ENV"),
+		LogLevel: src.string("LOG_LEVEL", "info"),
+
+		ProxyHeader:    src.get("PROXY_HEADER"),
+		TrustedProxies: src.list("TRUSTED_PROXIES"),
+
+		ShutdownTimeout:       src.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		ReadinessTimeout:      src.duration("READINESS_TIMEOUT", 2*time.Second),
+		ReadinessCheckStorage: src.get("READINESS_CHECK_STORAGE") == "true",
+
+		PrometheusAddress: src.string("PROMETHEUS_ADDRESS", ":9100"),
+
+		StorageCleanupInterval: src.duration("STORAGE_CLEANUP_INTERVAL", time.Minute),
+
+		DeactivationRetention:     src.duration("DEACTIVATION_RETENTION", 30*24*time.Hour),
+		DeactivationPurgeInterval: src.duration("DEACTIVATION_PURGE_INTERVAL", time.Hour),
+
+		TracingExporter:    src.string("TRACING_EXPORTER", "none"),
+		TracingSampleRatio: src.float("TRACING_SAMPLE_RATIO", 1),
+		OTLPEndpoint:       src.get("OTLP_ENDPOINT"),
+
+		JWTSecret:  src.get("JWT_SECRET"),
+		BcryptSalt: src.int("BCRYPT_SALT", 0),
+
+		SessionCacheTTL: src.duration("SESSION_CACHE_TTL", 10*time.Second),
+
+		LoginMaxFailures: src.int("LOGIN_MAX_FAILURES", 5),
+		LoginLockout:     src.duration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		VerificationCodeTTL:     src.duration("VERIFICATION_CODE_TTL", 10*time.Minute),
+		VerificationMaxAttempts: src.int("VERIFICATION_MAX_ATTEMPTS", 5),
+		VerificationGracePeriod: src.duration("VERIFICATION_GRACE_PERIOD", 72*time.Hour),
+
+		PasswordResetTTL: src.duration("PASSWORD_RESET_TTL", 30*time.Minute),
+
+		ReportHideThreshold: src.int("REPORT_HIDE_THRESHOLD", 3),
+
+		CacheDriver:   src.string("CACHE_DRIVER", "lru"),
+		CacheSize:     src.int("CACHE_SIZE", 10000),
+		CacheTTL:      src.duration("CACHE_TTL", 30*time.Second),
+		RedisAddr:     src.string("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: src.get("REDIS_PASSWORD"),
+		RedisDB:       src.int("REDIS_DB", 0),
+
+		FeedMode:               src.string("FEED_MODE", "pull"),
+		TimelineFanoutInterval: src.duration("TIMELINE_FANOUT_INTERVAL", time.Second),
+		TimelineFanoutBatch:    src.int("TIMELINE_FANOUT_BATCH", 100),
+		TimelineBackfill:       src.int("TIMELINE_BACKFILL", 100),
+
+		NotifyDriver:     src.string("NOTIFY_DRIVER", "log"),
+		NotifyFile:       src.string("NOTIFY_FILE", "notifications.log"),
+		NotifyWebhookURL: src.get("NOTIFY_WEBHOOK_URL"),
+
+		S3ID:        src.get("S3_ID"),
+		S3SecretKey: src.get("S3_SECRET_KEY"),
+		S3BaseURL:   src.get("S3_BASE_URL"),
 	}
+	config.DbReplicaPort = src.string("DB_REPLICA_PORT", config.DbPort)
 
-	config.BcryptSalt = salt
+	// production used to hard-code these, keep them as its defaults
+	if config.ENV == Production {
+		if config.DbSSLMode == "" {
+			config.DbSSLMode = "verify-full"
+		}
+		if config.DbSSLRootCert == "" {
+			config.DbSSLRootCert = "ap-southeast-1-bundle.pem"
+		}
+	}
+
+	config.loadRateLimits(src)
+
+	if err := src.err(); err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return config, nil
 }
+
+func (s *source) string(key, def string) string {
+	if value := s.get(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// duration parses a time.ParseDuration value such as "10s", falling back to def when unset.
+func (s *source) duration(key string, def time.Duration) time.Duration {
+	value := s.get(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed get %s %v", key, err))
+		return def
+	}
+	return d
+}
+
+// list splits a comma separated value, dropping empty entries.
+func (s *source) list(key string) []string {
+	var values []string
+	for _, value := range strings.Split(s.get(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (s *source) float(key string, def float64) float64 {
+	value := s.get(key)
+	if value == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed get %s: %q is not a number", key, value))
+		return def
+	}
+	return f
+}
@@ -0,0 +1,68 @@
+package configs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit allows Max requests per Window, a zero Max disables the limit.
+type RateLimit struct {
+	Max    int
+	Window time.Duration
+}
+
+// rateLimit parses "<max>/<window>" such as "10/1m", falling back to def when unset.
+func (s *source) rateLimit(key string, def RateLimit) (RateLimit, error) {
+	value := s.get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	maxStr, windowStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("failed get %s: expected <max>/<window> such as 10/1m, got %q", key, value)
+	}
+
+	max, err := strconv.Atoi(maxStr)
+	if err != nil || max < 0 {
+		return RateLimit{}, fmt.Errorf("failed get %s: invalid max %q", key, maxStr)
+	}
+
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("failed get %s: invalid window %q", key, windowStr)
+	}
+
+	return RateLimit{Max: max, Window: window}, nil
+}
+
+func (c *Config) loadRateLimits(src *source) {
+	limits := []struct {
+		key   string
+		field *RateLimit
+		def   RateLimit
+	}{
+		{"RATE_LIMIT_LOGIN_IP", &c.LoginIPLimit, RateLimit{Max: 20, Window: time.Minute}},
+		{"RATE_LIMIT_LOGIN_CREDENTIAL", &c.LoginCredentialLimit, RateLimit{Max: 5, Window: time.Minute}},
+		{"RATE_LIMIT_REGISTER_IP", &c.RegisterIPLimit, RateLimit{Max: 10, Window: time.Hour}},
+		{"RATE_LIMIT_VERIFICATION", &c.VerificationLimit, RateLimit{Max: 5, Window: time.Hour}},
+		{"RATE_LIMIT_PASSWORD_RESET", &c.PasswordResetLimit, RateLimit{Max: 5, Window: time.Hour}},
+		{"RATE_LIMIT_PASSWORD_CONFIRM", &c.PasswordConfirmLimit, RateLimit{Max: 5, Window: 15 * time.Minute}},
+		{"RATE_LIMIT_EXPORT", &c.ExportLimit, RateLimit{Max: 3, Window: time.Hour}},
+		{"RATE_LIMIT_POST", &c.PostLimit, RateLimit{Max: 30, Window: time.Minute}},
+		{"RATE_LIMIT_COMMENT", &c.CommentLimit, RateLimit{Max: 60, Window: time.Minute}},
+		{"RATE_LIMIT_FRIEND", &c.FriendLimit, RateLimit{Max: 60, Window: time.Minute}},
+		{"RATE_LIMIT_REPORT", &c.ReportLimit, RateLimit{Max: 20, Window: time.Hour}},
+	}
+
+	for _, l := range limits {
+		limit, err := src.rateLimit(l.key, l.def)
+		if err != nil {
+			src.errs = append(src.errs, err)
+			limit = l.def
+		}
+		*l.field = limit
+	}
+}
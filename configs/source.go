@@ -0,0 +1,121 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeys may also be read from the file named by <KEY>_FILE, such as a mounted docker or k8s secret.
+var secretKeys = map[string]bool{
+	"DB_PASSWORD":    true,
+	"JWT_SECRET":     true,
+	"S3_ID":          true,
+	"S3_SECRET_KEY":  true,
+	"REDIS_PASSWORD": true,
+}
+
+// source resolves a key from, in order, the environment, <KEY>_FILE for secrets and the config file.
+// Problems are collected instead of returned so every one of them is reported at once.
+type source struct {
+	file map[string]string
+	errs []error
+}
+
+func newSource(path string) (*source, error) {
+	s := &source{file: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+
+	var unmarshal func(data []byte, v interface{}) error
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return nil, fmt.Errorf("failed read config file %s: unsupported extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read config file %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed parse config file %s: %v", path, err)
+	}
+	flatten("", doc, s.file)
+
+	return s, nil
+}
+
+// flatten turns nested keys into env names, so `db: {host: x}` and `db_host: x` both set DB_HOST.
+func flatten(prefix string, doc map[string]interface{}, out map[string]string) {
+	for k, v := range doc {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			// lists are read back comma separated, like their env var
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func (s *source) get(key string) string {
+	// an exported but empty variable counts as unset so it doesn't shadow the file
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	if secretKeys[key] {
+		if path := os.Getenv(key + "_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				s.errs = append(s.errs, fmt.Errorf("failed read %s_FILE %v", key, err))
+				return ""
+			}
+			return strings.TrimSpace(string(data))
+		}
+	}
+
+	return s.file[key]
+}
+
+func (s *source) int(key string, def int) int {
+	value := s.get(key)
+	if value == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed get %s: %q is not a number", key, value))
+		return def
+	}
+	return i
+}
+
+func (s *source) err() error {
+	return errors.Join(s.errs...)
+}
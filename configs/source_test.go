@@ -0,0 +1,137 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  map[string]interface{}
+		want map[string]string
+	}{
+		{"flat keys are uppercased", map[string]interface{}{"db_host": "localhost", "APP_PORT": 8080},
+			map[string]string{"DB_HOST": "localhost", "APP_PORT": "8080"}},
+		{"nested keys are joined", map[string]interface{}{"db": map[string]interface{}{"host": "localhost", "replica": map[string]interface{}{"port": 5433}}},
+			map[string]string{"DB_HOST": "localhost", "DB_REPLICA_PORT": "5433"}},
+		{"scalars", map[string]interface{}{"readiness_check_storage": true, "tracing_sample_ratio": 0.5},
+			map[string]string{"READINESS_CHECK_STORAGE": "true", "TRACING_SAMPLE_RATIO": "0.5"}},
+		{"lists are comma separated", map[string]interface{}{"trusted_proxies": []interface{}{"10.0.0.0/8", "192.168.1.1"}},
+			map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8,192.168.1.1"}},
+		{"null is unset", map[string]interface{}{"db_password": nil}, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			flatten("", tt.doc, got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSourcePrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+db:
+  password: from-file
+  host: file-host
+log_level: debug
+app_port: 9000
+`)
+	secret := writeFile(t, "db_password", "from-secret\n")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		key  string
+		want string
+	}{
+		{"file", nil, "DB_PASSWORD", "from-file"},
+		{"secret file over the file", map[string]string{"DB_PASSWORD_FILE": secret}, "DB_PASSWORD", "from-secret"},
+		{"env over the secret file", map[string]string{"DB_PASSWORD_FILE": secret, "DB_PASSWORD": "from-env"}, "DB_PASSWORD", "from-env"},
+		{"empty env is unset", map[string]string{"LOG_LEVEL": ""}, "LOG_LEVEL", "debug"},
+		{"env over the file", map[string]string{"DB_HOST": "env-host"}, "DB_HOST", "env-host"},
+		{"_FILE only for secrets", map[string]string{"APP_PORT_FILE": secret}, "APP_PORT", "9000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"DB_PASSWORD", "DB_PASSWORD_FILE", "DB_HOST", "LOG_LEVEL", "APP_PORT", "APP_PORT_FILE"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			src, err := newSource(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := src.get(tt.key); got != tt.want {
+				t.Fatalf("get(%s) = %q, want %q", tt.key, got, tt.want)
+			}
+			if err := src.err(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("unreadable secret file", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "")
+		t.Setenv("JWT_SECRET", "")
+		t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+		src, err := newSource(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := src.get("JWT_SECRET"); got != "" {
+			t.Fatalf("get(JWT_SECRET) = %q", got)
+		}
+		if err := src.err(); err == nil || !strings.Contains(err.Error(), "JWT_SECRET_FILE") {
+			t.Fatalf("err() = %v, want the JWT_SECRET_FILE failure", err)
+		}
+	})
+}
+
+func TestSourceFormats(t *testing.T) {
+	yaml := writeFile(t, "config.yml", "db:\n  host: localhost\ntrusted_proxies: [10.0.0.0/8, 10.1.0.1]\n")
+	toml := writeFile(t, "config.toml", "trusted_proxies = [\n  \"10.0.0.0/8\", # internal\n  '10.1.0.1',\n]\n\n[db]\nhost = \"localhost\"\n")
+
+	for _, path := range []string{yaml, toml} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			t.Setenv("DB_HOST", "")
+			t.Setenv("TRUSTED_PROXIES", "")
+			src, err := newSource(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := src.get("DB_HOST"); got != "localhost" {
+				t.Errorf("DB_HOST = %q, want localhost", got)
+			}
+			if got := src.list("TRUSTED_PROXIES"); !reflect.DeepEqual(got, []string{"10.0.0.0/8", "10.1.0.1"}) {
+				t.Errorf("TRUSTED_PROXIES = %q", got)
+			}
+		})
+	}
+
+	if _, err := newSource(writeFile(t, "config.toml", "[db]\nhost = localhost\n")); err == nil || !strings.Contains(err.Error(), "failed parse config file") {
+		t.Fatalf("newSource() of invalid TOML error = %v", err)
+	}
+
+	if _, err := newSource(writeFile(t, "config.json", "{}")); err == nil || !strings.Contains(err.Error(), `unsupported extension ".json"`) {
+		t.Fatalf("newSource() of a .json file error = %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minProductionBcryptCost is the lowest cost that is still slow enough to resist offline cracking.
+	minProductionBcryptCost = 10
+	// minProductionSecretLength is 256 bits, the HS256 key size.
+	minProductionSecretLength = 32
+)
+
+// Validate reports every missing or malformed value, plus values that are unsafe when ENV is production.
+func (c Config) Validate() error {
+	var problems []error
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	c.validateDB(problem)
+
+	if c.JWTSecret == "" {
+		problem("JWT_SECRET is required")
+	}
+
+	if _, err := strconv.Atoi(c.APPPort); err != nil {
+		problem("APP_PORT must be a number, got %q", c.APPPort)
+	}
+
+	// without trusted proxies any client could put its own address in the header
+	if c.ProxyHeader != "" && len(c.TrustedProxies) == 0 {
+		problem("TRUSTED_PROXIES is required with PROXY_HEADER")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problem("TRUSTED_PROXIES must be IP addresses or CIDR ranges, got %q", proxy)
+			}
+		}
+	}
+
+	if c.BcryptSalt < bcrypt.MinCost || c.BcryptSalt > bcrypt.MaxCost {
+		problem("BCRYPT_SALT must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptSalt)
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		problem("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	switch c.TracingExporter {
+	case "none", "stdout", "otlp":
+	default:
+		problem("TRACING_EXPORTER must be none, stdout or otlp, got %q", c.TracingExporter)
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		problem("TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", c.TracingSampleRatio)
+	}
+
+	switch c.NotifyDriver {
+	case "log", "file":
+	case "webhook":
+		if u, err := url.Parse(c.NotifyWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("NOTIFY_WEBHOOK_URL must be an http or https URL with the webhook driver, got %q", c.NotifyWebhookURL)
+		}
+	default:
+		problem("NOTIFY_DRIVER must be log, file or webhook, got %q", c.NotifyDriver)
+	}
+
+	switch c.CacheDriver {
+	case "lru", "redis", "none":
+	default:
+		problem("CACHE_DRIVER must be lru, redis or none, got %q", c.CacheDriver)
+	}
+	if c.CacheDriver == "lru" && c.CacheSize <= 0 {
+		problem("CACHE_SIZE must be positive, got %d", c.CacheSize)
+	}
+
+	switch c.FeedMode {
+	case "pull", "timeline":
+	default:
+		problem("FEED_MODE must be pull or timeline, got %q", c.FeedMode)
+	}
+	if c.TimelineFanoutBatch <= 0 {
+		problem("TIMELINE_FANOUT_BATCH must be positive, got %d", c.TimelineFanoutBatch)
+	}
+	if c.TimelineBackfill <= 0 {
+		problem("TIMELINE_BACKFILL must be positive, got %d", c.TimelineBackfill)
+	}
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"READINESS_TIMEOUT", c.ReadinessTimeout},
+		{"STORAGE_CLEANUP_INTERVAL", c.StorageCleanupInterval},
+		{"DEACTIVATION_RETENTION", c.DeactivationRetention},
+		{"DEACTIVATION_PURGE_INTERVAL", c.DeactivationPurgeInterval},
+		{"LOGIN_LOCKOUT", c.LoginLockout},
+		{"VERIFICATION_CODE_TTL", c.VerificationCodeTTL},
+		{"VERIFICATION_GRACE_PERIOD", c.VerificationGracePeriod},
+		{"PASSWORD_RESET_TTL", c.PasswordResetTTL},
+		{"CACHE_TTL", c.CacheTTL},
+		{"TIMELINE_FANOUT_INTERVAL", c.TimelineFanoutInterval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			problem("%s must be positive, got %s", d.key, d.value)
+		}
+	}
+
+	if c.LoginMaxFailures < 0 {
+		problem("LOGIN_MAX_FAILURES must not be negative, got %d", c.LoginMaxFailures)
+	}
+	if c.SessionCacheTTL < 0 {
+		problem("SESSION_CACHE_TTL must not be negative, got %s", c.SessionCacheTTL)
+	}
+	if c.ReportHideThreshold < 0 {
+		problem("REPORT_HIDE_THRESHOLD must not be negative, got %d", c.ReportHideThreshold)
+	}
+	if c.VerificationMaxAttempts <= 0 {
+		problem("VERIFICATION_MAX_ATTEMPTS must be positive, got %d", c.VerificationMaxAttempts)
+	}
+
+	if c.ENV == Production {
+		if len(c.JWTSecret) < minProductionSecretLength {
+			problem("JWT_SECRET must be at least %d bytes in production", minProductionSecretLength)
+		}
+		if c.BcryptSalt < minProductionBcryptCost {
+			problem("BCRYPT_SALT must be at least %d in production, got %d", minProductionBcryptCost, c.BcryptSalt)
+		}
+		if c.S3ID == "" || c.S3SecretKey == "" {
+			problem("S3_ID and S3_SECRET_KEY are required in production")
+		}
+		if c.TracingExporter == "stdout" {
+			problem("TRACING_EXPORTER stdout is for local development, use none or otlp in production")
+		}
+		// both write verification codes and reset tokens where anyone reading the logs sees them
+		if c.NotifyDriver == "log" || c.NotifyDriver == "file" {
+			problem("NOTIFY_DRIVER %s is for local development, use webhook in production", c.NotifyDriver)
+		}
+	}
+
+	return invalid(problems)
+}
+
+// ValidateDB is Validate for the database settings alone, for commands that only connect to it.
+func (c Config) ValidateDB() error {
+	var problems []error
+	c.validateDB(func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	})
+	return invalid(problems)
+}
+
+func (c Config) validateDB(problem func(format string, args ...interface{})) {
+	required := []struct{ key, value string }{
+		{"DB_NAME", c.DbName},
+		{"DB_HOST", c.DbHost},
+		{"DB_PORT", c.DbPort},
+		{"DB_USERNAME", c.DbUsername},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			problem("%s is required", r.key)
+		}
+	}
+
+	if c.DbPort != "" {
+		if _, err := strconv.Atoi(c.DbPort); err != nil {
+			problem("DB_PORT must be a number, got %q", c.DbPort)
+		}
+	}
+	if c.DbReplicaHost != "" {
+		if _, err := strconv.Atoi(c.DbReplicaPort); err != nil {
+			problem("DB_REPLICA_PORT must be a number, got %q", c.DbReplicaPort)
+		}
+	}
+	if c.DbMaxConns <= 0 {
+		problem("DB_MAX_CONNS must be positive, got %d", c.DbMaxConns)
+	}
+	if c.DbMinConns < 0 || c.DbMinConns > c.DbMaxConns {
+		problem("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS, got %d", c.DbMinConns)
+	}
+	for key, d := range map[string]time.Duration{
+		"DB_MAX_CONN_LIFETIME":   c.DbMaxConnLifetime,
+		"DB_MAX_CONN_IDLE_TIME":  c.DbMaxConnIdleTime,
+		"DB_HEALTH_CHECK_PERIOD": c.DbHealthCheckPeriod,
+	} {
+		if d <= 0 {
+			problem("%s must be positive, got %s", key, d)
+		}
+	}
+	if c.DbStatementTimeout < 0 {
+		problem("DB_STATEMENT_TIMEOUT must not be negative, got %s", c.DbStatementTimeout)
+	}
+	switch c.DbSSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problem("DB_SSL_MODE must be disable, allow, prefer, require, verify-ca or verify-full, got %q", c.DbSSLMode)
+	}
+
+	if c.ENV == Production {
+		if c.DbPassword == "" {
+			problem("DB_PASSWORD is required in production")
+		}
+		switch c.DbSSLMode {
+		case "disable", "allow", "prefer":
+			problem("DB_SSL_MODE %s doesn't enforce TLS, use require, verify-ca or verify-full in production", c.DbSSLMode)
+		}
+	}
+}
+
+func invalid(problems []error) error {
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(problems...))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig loads the defaults with only the required values set.
+func validConfig(t *testing.T) Config {
+	t.Helper()
+
+	for key, value := range map[string]string{
+		"CONFIG_FILE": "",
+		"ENV":         "",
+		"DB_NAME":     "postgres",
+		"DB_HOST":     "localhost",
+		"DB_PORT":     "5432",
+		"DB_USERNAME": "postgres",
+		"JWT_SECRET":  "secretjwt",
+		"BCRYPT_SALT": "8",
+	} {
+		t.Setenv(key, value)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	production := func(c *Config) {
+		c.ENV = Production
+		c.JWTSecret = strings.Repeat("s", minProductionSecretLength)
+		c.BcryptSalt = minProductionBcryptCost
+		c.DbPassword = "postgres"
+		c.S3ID, c.S3SecretKey = "id", "secret"
+		c.DbSSLMode = "verify-full"
+		c.NotifyDriver, c.NotifyWebhookURL = "webhook", "https://relay.internal/notifications"
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string // problems reported, none for a valid config
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"every problem at once", func(c *Config) { c.DbName, c.JWTSecret, c.DbPort = "", "", "five" },
+			[]string{"DB_NAME is required", "JWT_SECRET is required", "DB_PORT must be a number"}},
+		{"connections", func(c *Config) { c.DbMaxConns, c.DbMinConns = 2, 3 }, []string{"DB_MIN_CONNS"}},
+		{"bcrypt cost", func(c *Config) { c.BcryptSalt = 40 }, []string{"BCRYPT_SALT must be between"}},
+		{"proxy header without proxies", func(c *Config) { c.ProxyHeader = "X-Real-IP" }, []string{"TRUSTED_PROXIES is required"}},
+		{"proxies", func(c *Config) {
+			c.ProxyHeader, c.TrustedProxies = "X-Real-IP", []string{"10.0.0.1", "10.0.0.0/8", "lb.internal"}
+		}, []string{`got "lb.internal"`}},
+		{"durations", func(c *Config) { c.CacheTTL, c.LoginLockout = 0, -time.Second },
+			[]string{"CACHE_TTL must be positive", "LOGIN_LOCKOUT must be positive"}},
+		{"notify driver", func(c *Config) { c.NotifyDriver = "smtp" }, []string{"NOTIFY_DRIVER must be log, file or webhook"}},
+		{"webhook without url", func(c *Config) { c.NotifyDriver = "webhook" }, []string{"NOTIFY_WEBHOOK_URL"}},
+		{"webhook url", func(c *Config) { c.NotifyDriver, c.NotifyWebhookURL = "webhook", "relay.internal" }, []string{"NOTIFY_WEBHOOK_URL"}},
+		{"cache size", func(c *Config) { c.CacheSize = 0 }, []string{"CACHE_SIZE must be positive"}},
+		{"production", production, nil},
+		{"production secrets", func(c *Config) {
+			production(c)
+			c.JWTSecret, c.BcryptSalt, c.DbPassword, c.S3SecretKey = "secretjwt", 8, "", ""
+		}, []string{"JWT_SECRET must be at least", "BCRYPT_SALT must be at least", "DB_PASSWORD is required", "S3_ID and S3_SECRET_KEY"}},
+		{"production tls", func(c *Config) { production(c); c.DbSSLMode = "prefer" }, []string{"DB_SSL_MODE prefer doesn't enforce TLS"}},
+		{"production tracing", func(c *Config) { production(c); c.TracingExporter = "stdout" }, []string{"TRACING_EXPORTER stdout"}},
+		{"production log notify", func(c *Config) { production(c); c.NotifyDriver = "log" }, []string{"NOTIFY_DRIVER log is for local development"}},
+		{"production file notify", func(c *Config) { production(c); c.NotifyDriver = "file" }, []string{"NOTIFY_DRIVER file is for local development"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t)
+			tt.modify(&config)
+
+			err := config.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to report %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.want) {
+				t.Errorf("Validate() reported %d problems, want %d: %v", got, len(tt.want), err)
+			}
+		})
+	}
+}
+
+func TestValidateDB(t *testing.T) {
+	config := validConfig(t)
+	// what a migrate container without the server's settings loads
+	config.JWTSecret, config.BcryptSalt = "", 0
+
+	if err := config.ValidateDB(); err != nil {
+		t.Fatalf("ValidateDB() error = %v", err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate() = nil, want the missing server settings reported")
+	}
+
+	config.DbHost, config.DbMaxConnLifetime = "", 0
+	config.ENV, config.DbSSLMode = Production, "disable"
+	err := config.ValidateDB()
+	for _, want := range []string{"DB_HOST is required", "DB_MAX_CONN_LIFETIME must be positive", "DB_PASSWORD is required", "DB_SSL_MODE disable"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateDB() error = %v, want it to report %q", err, want)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Errorf("ValidateDB() reported a server setting: %v", err)
+	}
+}
@@ -2,35 +2,68 @@ package connections
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"net"
+	"net/url"
 	"segokuning/configs"
-	"time"
+	"strconv"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// NewPgConn opens the primary pool every write goes through.
 func NewPgConn(config configs.Config) (*pgxpool.Pool, error) {
-	ctx := context.Background()
-
-	var dsn string
+	return newPool(config, config.DbHost, config.DbPort)
+}
 
-	if os.Getenv("ENV") == "production" {
-		dsn = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=verify-full&sslrootcert=ap-southeast-1-bundle.pem", config.DbUsername, config.DbPassword, config.DbHost, config.DbPort, config.DbName)
-	} else {
-		dsn = fmt.Sprintf("postgres://%s:%s@%s:%s/%s", config.DbUsername, config.DbPassword, config.DbHost, config.DbPort, config.DbName)
+// NewReplicaConn opens a pool on the read replica for read-only queries such as feeds and
+// friend lists. It returns a nil pool when DB_REPLICA_HOST is unset, callers then read from the primary.
+func NewReplicaConn(config configs.Config) (*pgxpool.Pool, error) {
+	if config.DbReplicaHost == "" {
+		return nil, nil
 	}
+	return newPool(config, config.DbReplicaHost, config.DbReplicaPort)
+}
 
-	dbconfig, err := pgxpool.ParseConfig(dsn)
+func newPool(config configs.Config, host, port string) (*pgxpool.Pool, error) {
+	dbconfig, err := pgxpool.ParseConfig(dsn(config, host, port))
 	if err != nil {
 		return nil, err
 	}
 
-	dbconfig.MaxConnLifetime = 1 * time.Hour
-	dbconfig.MaxConnIdleTime = 30 * time.Minute
-	dbconfig.HealthCheckPeriod = 5 * time.Second
-	dbconfig.MaxConns = 15
-	dbconfig.MinConns = 5
+	dbconfig.MaxConnLifetime = config.DbMaxConnLifetime
+	dbconfig.MaxConnIdleTime = config.DbMaxConnIdleTime
+	dbconfig.HealthCheckPeriod = config.DbHealthCheckPeriod
+	dbconfig.MaxConns = config.DbMaxConns
+	dbconfig.MinConns = config.DbMinConns
+	dbconfig.ConnConfig.Tracer = queryTracer{dbName: config.DbName, host: host}
+
+	if config.DbApplicationName != "" {
+		dbconfig.ConnConfig.RuntimeParams["application_name"] = config.DbApplicationName
+	}
+	if config.DbStatementTimeout > 0 {
+		dbconfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(config.DbStatementTimeout.Milliseconds(), 10)
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), dbconfig)
+}
+
+// dsn builds the connection URL, escaping credentials that contain URL syntax.
+func dsn(config configs.Config, host, port string) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(config.DbUsername, config.DbPassword),
+		Host:   net.JoinHostPort(host, port),
+		Path:   "/" + config.DbName,
+	}
+
+	query := url.Values{}
+	if config.DbSSLMode != "" {
+		query.Set("sslmode", config.DbSSLMode)
+	}
+	if config.DbSSLRootCert != "" {
+		query.Set("sslrootcert", config.DbSSLRootCert)
+	}
+	u.RawQuery = query.Encode()
 
-	return pgxpool.NewWithConfig(ctx, dbconfig)
+	return u.String()
 }
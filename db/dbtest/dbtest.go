@@ -0,0 +1,258 @@
+// Package dbtest runs integration tests against a throwaway postgres cluster. Main creates the
+// cluster with the local initdb and pg_ctl in a temporary directory, migrates a template database
+// once, and DB hands every test its own copy of that template, dropped when the test ends.
+//
+// A database per test rather than a transaction per test, because the code under test acquires
+// its own connections and opens its own transactions.
+//
+// The binaries are looked up in PG_BIN, then PATH, then /usr/lib/postgresql/*/bin. Without them
+// the tests calling DB are skipped. initdb refuses to run as root.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"segokuning/configs"
+	"segokuning/db/connections"
+	"segokuning/db/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const template = "segokuning_template"
+
+// ErrNoPostgres is why DB skips, no initdb or pg_ctl was found.
+var ErrNoPostgres = errors.New("initdb and pg_ctl not found, set PG_BIN to the postgres bin directory")
+
+type Server struct {
+	bin    string
+	dir    string
+	config configs.Config
+	admin  *pgxpool.Pool
+	seq    atomic.Int64
+}
+
+var (
+	server   *Server
+	startErr error
+)
+
+// Main starts the server for a package's tests, runs them and stops it. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(dbtest.Main(m)) }
+func Main(m *testing.M) int {
+	server, startErr = Start()
+	if startErr != nil && !errors.Is(startErr, ErrNoPostgres) {
+		fmt.Fprintf(os.Stderr, "dbtest: %v\n", startErr)
+	}
+
+	code := m.Run()
+
+	if server != nil {
+		if err := server.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtest: %v\n", err)
+		}
+	}
+	return code
+}
+
+// DB returns a pool on a freshly migrated database of its own and the config pointing at it.
+func DB(t testing.TB) (*pgxpool.Pool, configs.Config) {
+	t.Helper()
+
+	switch {
+	case errors.Is(startErr, ErrNoPostgres):
+		t.Skip(startErr)
+	case startErr != nil:
+		t.Fatalf("postgres failed to start: %v", startErr)
+	case server == nil:
+		t.Fatal("dbtest.DB needs dbtest.Main to run from TestMain")
+	}
+	return server.DB(t)
+}
+
+// Start creates a cluster on a free port and migrates the template database.
+func Start() (*Server, error) {
+	bin, err := binDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "segokuning-pg-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{bin: bin, dir: dir}
+
+	port, err := freePort()
+	if err != nil {
+		s.cleanup()
+		return nil, err
+	}
+
+	data := filepath.Join(dir, "data")
+	if err := s.run("initdb", "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync"); err != nil {
+		s.cleanup()
+		return nil, err
+	}
+
+	// fsync off and the socket in our own directory, the cluster only lives as long as the tests
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off -c full_page_writes=off", port, dir)
+	if err := s.run("pg_ctl", "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", options, "-w", "start"); err != nil {
+		s.cleanup()
+		return nil, err
+	}
+
+	s.config = configs.Config{
+		DbHost:              "127.0.0.1",
+		DbPort:              strconv.Itoa(port),
+		DbUsername:          "postgres",
+		DbName:              "postgres",
+		DbSSLMode:           "disable",
+		DbMaxConns:          10,
+		DbMaxConnLifetime:   time.Hour,
+		DbMaxConnIdleTime:   time.Minute,
+		DbHealthCheckPeriod: time.Minute,
+
+		BcryptSalt:              4,
+		LoginMaxFailures:        5,
+		LoginLockout:            15 * time.Minute,
+		VerificationCodeTTL:     10 * time.Minute,
+		VerificationMaxAttempts: 5,
+		VerificationGracePeriod: 72 * time.Hour,
+		PasswordResetTTL:        30 * time.Minute,
+		DeactivationRetention:   30 * 24 * time.Hour,
+		CacheTTL:                time.Minute,
+	}
+
+	if err := s.migrateTemplate(); err != nil {
+		s.Stop()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) migrateTemplate() error {
+	ctx := context.Background()
+
+	admin, err := connections.NewPgConn(s.config)
+	if err != nil {
+		return err
+	}
+	s.admin = admin
+
+	if _, err := admin.Exec(ctx, `CREATE DATABASE `+template); err != nil {
+		return err
+	}
+
+	config := s.config
+	config.DbName = template
+	pool, err := connections.NewPgConn(config)
+	if err != nil {
+		return err
+	}
+	// a template can't be copied while anything is connected to it
+	defer pool.Close()
+
+	migrator, err := migrations.New(pool)
+	if err != nil {
+		return err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		return fmt.Errorf("failed migrate template %w", err)
+	}
+	return nil
+}
+
+// DB copies the template into a new database for t and drops it when t ends.
+func (s *Server) DB(t testing.TB) (*pgxpool.Pool, configs.Config) {
+	t.Helper()
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test_%d", s.seq.Add(1))
+	if _, err := s.admin.Exec(ctx, `CREATE DATABASE `+name+` TEMPLATE `+template); err != nil {
+		t.Fatalf("create database %s: %v", name, err)
+	}
+
+	config := s.config
+	config.DbName = name
+	pool, err := connections.NewPgConn(config)
+	if err != nil {
+		t.Fatalf("connect to %s: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		if _, err := s.admin.Exec(ctx, `DROP DATABASE `+name+` WITH (FORCE)`); err != nil {
+			t.Errorf("drop database %s: %v", name, err)
+		}
+	})
+
+	return pool, config
+}
+
+// Stop shuts the cluster down and removes its directory.
+func (s *Server) Stop() error {
+	if s.admin != nil {
+		s.admin.Close()
+	}
+	err := s.run("pg_ctl", "-D", filepath.Join(s.dir, "data"), "-m", "immediate", "-w", "stop")
+	s.cleanup()
+	return err
+}
+
+func (s *Server) cleanup() {
+	os.RemoveAll(s.dir)
+}
+
+func (s *Server) run(name string, args ...string) error {
+	out, err := exec.Command(filepath.Join(s.bin, name), args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w\n%s", name, err, out)
+	}
+	return nil
+}
+
+func binDir() (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return dir, nil
+	}
+	if path, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(path), nil
+	}
+
+	// debian and ubuntu keep the server binaries off PATH, take the newest version
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Slice(dirs, func(i, j int) bool { return version(dirs[i]) > version(dirs[j]) })
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "pg_ctl")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", ErrNoPostgres
+}
+
+func version(binDir string) int {
+	v, _ := strconv.Atoi(filepath.Base(filepath.Dir(binDir)))
+	return v
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,54 @@
+package entity
+
+import "time"
+
+type (
+	// AccountExport is everything a user created, as handed out by the data export.
+	AccountExport struct {
+		Account    ExportedAccount   `json:"account"`
+		Posts      []ExportedPost    `json:"posts"`
+		Comments   []ExportedComment `json:"comments"`
+		Friends    []ExportedFriend  `json:"friends"`
+		ExportedAt time.Time         `json:"exportedAt"`
+
+		// ImageKey is the storage key of the profile image when the user uploaded it, empty
+		// for an image they only linked to
+		ImageKey string `json:"-"`
+	}
+
+	ExportedAccount struct {
+		Id              string     `json:"id"`
+		Name            string     `json:"name"`
+		Email           *string    `json:"email"`
+		Phone           *string    `json:"phone"`
+		ImageUrl        *string    `json:"imageUrl"`
+		EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+		PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt"`
+		CreatedAt       time.Time  `json:"createdAt"`
+	}
+
+	ExportedPost struct {
+		Id         int       `json:"id"`
+		PostInHtml string    `json:"postInHtml"`
+		Tags       []string  `json:"tags"`
+		CreatedAt  time.Time `json:"createdAt"`
+	}
+
+	ExportedComment struct {
+		PostId    int       `json:"postId"`
+		Comment   string    `json:"comment"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	ExportedFriend struct {
+		UserId int       `json:"userId"`
+		Name   string    `json:"name"`
+		Since  time.Time `json:"since"`
+	}
+
+	StorageDeletion struct {
+		Id        int64
+		ObjectKey string
+		Attempts  int
+	}
+)
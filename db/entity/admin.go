@@ -0,0 +1,116 @@
+package entity
+
+import "time"
+
+// Roles a user can hold, moderators and admins reach the /v1/admin endpoints and only admins
+// change roles.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Audited admin actions.
+const (
+	ActionUserSearch    = "user.search"
+	ActionUserSuspend   = "user.suspend"
+	ActionUserUnsuspend = "user.unsuspend"
+	ActionUserRole      = "user.role"
+	ActionPostView      = "post.view"
+	ActionPostDelete    = "post.delete"
+	ActionCommentDelete = "comment.delete"
+	ActionReportResolve = "report.resolve"
+	ActionAuditSearch   = "audit.search"
+)
+
+// Audited account events, the user they're about sees them on /v1/user/me/activity. Deleting
+// the account is audited too, with no one left to see it.
+const (
+	ActionLogin              = "account.login"
+	ActionLoginFailed        = "account.login_failed"
+	ActionEmailUpdate        = "account.email"
+	ActionPhoneUpdate        = "account.phone"
+	ActionCredentialReleased = "account.credential_released"
+	ActionAccountUpdate      = "account.update"
+	ActionPasswordChange     = "account.password"
+	ActionPasswordReset      = "account.password_reset"
+	ActionDeactivate         = "account.deactivate"
+	ActionFriendAdd          = "friend.add"
+	ActionFriendDelete       = "friend.delete"
+
+	ActionAccountDelete = "account.delete"
+)
+
+// AccountActions are the account events, in the order above.
+var AccountActions = []string{
+	ActionLogin, ActionLoginFailed, ActionEmailUpdate, ActionPhoneUpdate, ActionCredentialReleased, ActionAccountUpdate,
+	ActionPasswordChange, ActionPasswordReset, ActionDeactivate, ActionFriendAdd, ActionFriendDelete,
+}
+
+type (
+	// Actor is who performs an audited action and from where. A zero UserID is the command line.
+	Actor struct {
+		UserID    string
+		Role      string
+		IP        string
+		UserAgent string
+	}
+
+	AuditEntry struct {
+		Id         int64                  `json:"id"`
+		ActorID    *int64                 `json:"actorId"`
+		Action     string                 `json:"action"`
+		TargetType string                 `json:"targetType"`
+		TargetID   string                 `json:"targetId"`
+		IP         *string                `json:"ip"`
+		UserAgent  *string                `json:"userAgent"`
+		Details    map[string]interface{} `json:"details"`
+		CreatedAt  time.Time              `json:"createdAt"`
+	}
+
+	// AdminUser is a user as moderators see them.
+	AdminUser struct {
+		Id               string     `json:"id"`
+		Name             string     `json:"name"`
+		Email            *string    `json:"email"`
+		Phone            *string    `json:"phone"`
+		ImageUrl         *string    `json:"imageUrl"`
+		Role             string     `json:"role"`
+		FriendCount      int        `json:"friendCount"`
+		Status           string     `json:"status"`
+		SuspendedAt      *time.Time `json:"suspendedAt"`
+		SuspendedUntil   *time.Time `json:"suspendedUntil"`
+		SuspensionReason *string    `json:"suspensionReason"`
+		CreatedAt        time.Time  `json:"createdAt"`
+	}
+
+	QueryAdminUsers struct {
+		Search    string `query:"search"`
+		Role      string `query:"role"`
+		Suspended bool   `query:"suspended"`
+		Limit     int    `query:"limit"`
+		Offset    int    `query:"offset"`
+	}
+
+	AdminUserData struct {
+		Data []AdminUser `json:"data"`
+		Meta Meta        `json:"meta"`
+	}
+
+	// QueryAuditLog narrows the audit log, zero fields match every entry.
+	QueryAuditLog struct {
+		ActorID    string
+		Action     string
+		TargetType string
+		TargetID   string
+		Since      *time.Time
+		Until      *time.Time
+		Limit      int
+		Offset     int
+	}
+
+	AuditLogData struct {
+		Data []AuditEntry `json:"data"`
+		Meta Meta         `json:"meta"`
+	}
+)
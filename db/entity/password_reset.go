@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+type PasswordReset struct {
+	UserID          string    `json:"userId"`
+	CredentialType  string    `json:"credentialType"`
+	CredentialValue string    `json:"credentialValue"`
+	Token           string    `json:"-"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
@@ -12,9 +12,12 @@ type (
 	}
 
 	CommentPerPost struct {
+		Id        int64     `json:"id"`
 		Comment   string    `json:"comment"`
 		Creator   Creator   `json:"creator"`
 		CreatedAt time.Time `json:"createdAt"`
+		// Hidden comments stay on the post for moderators and are left out of feeds
+		Hidden bool `json:"hidden,omitempty"`
 	}
 
 	Post struct {
@@ -25,6 +28,7 @@ type (
 		CreatedAt  time.Time        `json:"createdAt"`
 		Comments   []CommentPerPost `json:"comments"`
 		Creator    Creator          `json:"creator"`
+		Hidden     bool             `json:"hidden"`
 	}
 
 	QueryGetPosts struct {
@@ -34,4 +38,11 @@ type (
 		Search     string   `query:"search"`
 		SearchTags []string `query:"searchTags"`
 	}
+
+	// TimelineDrift is a user whose timeline differs from the feed their friendships give.
+	TimelineDrift struct {
+		UserID  int
+		Missing []int // posts the feed has and the timeline doesn't
+		Extra   []int // posts the timeline has and the feed doesn't
+	}
 )
@@ -0,0 +1,76 @@
+package entity
+
+import "time"
+
+// What a report is about.
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+)
+
+// Why something was reported.
+const (
+	ReportReasonSpam       = "spam"
+	ReportReasonHarassment = "harassment"
+	ReportReasonHate       = "hate"
+	ReportReasonNudity     = "nudity"
+	ReportReasonViolence   = "violence"
+	ReportReasonOther      = "other"
+)
+
+// Report statuses, a report is open until a moderator resolves it.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// Actions resolving a report, they apply to every open report on the same target.
+const (
+	ResolveDismiss = "dismiss"
+	ResolveHide    = "hide"
+	ResolveSuspend = "suspend"
+)
+
+type (
+	Report struct {
+		Id         int64  `json:"id"`
+		ReporterID int64  `json:"reporterId"`
+		TargetType string `json:"targetType"`
+		TargetID   int64  `json:"targetId"`
+		// PostID is the post holding a reported comment
+		PostID     *int64     `json:"postId"`
+		Reason     string     `json:"reason"`
+		Text       *string    `json:"text"`
+		Status     string     `json:"status"`
+		Resolution *string    `json:"resolution"`
+		ResolvedBy *int64     `json:"resolvedBy"`
+		ResolvedAt *time.Time `json:"resolvedAt"`
+		CreatedAt  time.Time  `json:"createdAt"`
+
+		// Reports counts the open reports on the target, Hidden is whether the content is
+		// hidden from feeds right now.
+		Reports int  `json:"reports"`
+		Hidden  bool `json:"hidden"`
+	}
+
+	// Resolution is what a moderator does about a report. Until only applies to suspend.
+	Resolution struct {
+		Action string
+		Reason string
+		Until  *time.Time
+	}
+
+	QueryReports struct {
+		Status     string `query:"status"`
+		TargetType string `query:"targetType"`
+		Limit      int    `query:"limit"`
+		Offset     int    `query:"offset"`
+	}
+
+	ReportData struct {
+		Data []Report `json:"data"`
+		Meta Meta     `json:"meta"`
+	}
+)
@@ -1,5 +1,14 @@
 package entity
 
+import "time"
+
+// Account statuses. A suspension with an end is over once it passes.
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusDeactivated = "deactivated"
+)
+
 type User struct {
 	Id              string  `json:"id"`
 	Name            string  `json:"name"`
@@ -9,4 +18,22 @@ type User struct {
 	Phone           *string `json:"phone"`
 	Email           *string `json:"email"`
 	ImageUrl        *string `json:"imageUrl"`
+	TokenVersion    int     `json:"-"`
+	Role            string  `json:"-"`
+
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt"`
+}
+
+// Session is what an access token of the user is checked against on every request.
+type Session struct {
+	TokenVersion   int
+	Status         string
+	SuspendedUntil *time.Time
+}
+
+// Suspended reports whether the user is suspended at now, a session cached before the end of a
+// suspension isn't once it passes.
+func (s Session) Suspended(now time.Time) bool {
+	return s.Status == StatusSuspended && (s.SuspendedUntil == nil || s.SuspendedUntil.After(now))
 }
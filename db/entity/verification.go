@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+type Verification struct {
+	UserID          string    `json:"userId"`
+	CredentialType  string    `json:"credentialType"`
+	CredentialValue string    `json:"credentialValue"`
+	Code            string    `json:"-"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,175 @@
+package fakes
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+	"segokuning/internal/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Accounts struct {
+	db *DB
+}
+
+func (s *Accounts) Export(ctx context.Context, userID string) (entity.AccountExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.AccountExport{}, functions.ErrUserNotFound
+	}
+	id, _ := strconv.Atoi(userID)
+
+	result := entity.AccountExport{
+		Account: entity.ExportedAccount{
+			Id:              u.Id,
+			Name:            u.Name,
+			Email:           u.Email,
+			Phone:           u.Phone,
+			ImageUrl:        u.ImageUrl,
+			EmailVerifiedAt: u.EmailVerifiedAt,
+			PhoneVerifiedAt: u.PhoneVerifiedAt,
+			CreatedAt:       u.createdAt,
+		},
+		Posts:      []entity.ExportedPost{},
+		Comments:   []entity.ExportedComment{},
+		Friends:    []entity.ExportedFriend{},
+		ExportedAt: time.Now().UTC(),
+	}
+
+	if u.ImageUrl != nil {
+		if key, ok := utils.ObjectKey(*u.ImageUrl); ok && s.db.uploads[key] == userID {
+			result.ImageKey = key
+		}
+	}
+
+	for _, p := range s.db.posts {
+		if p.UserID == id {
+			result.Posts = append(result.Posts, entity.ExportedPost{Id: p.Id, PostInHtml: p.PostInHtml, Tags: p.Tags, CreatedAt: p.CreatedAt})
+		}
+		for _, c := range p.Comments {
+			if c.Creator.UserId == id {
+				result.Comments = append(result.Comments, entity.ExportedComment{PostId: p.Id, Comment: c.Comment, CreatedAt: c.CreatedAt})
+			}
+		}
+	}
+
+	for friendID, since := range s.db.friends[id] {
+		if f := s.db.userByID(friendID); f != nil {
+			result.Friends = append(result.Friends, entity.ExportedFriend{UserId: friendID, Name: f.Name, Since: since})
+		}
+	}
+	sort.Slice(result.Friends, func(i, j int) bool { return result.Friends[i].UserId < result.Friends[j].UserId })
+
+	return result, nil
+}
+
+// Activity lists the account events by the user and the failed logins on their account, newest first.
+func (s *Accounts) Activity(ctx context.Context, userID string, limit, offset int) (entity.AuditLogData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.auditLog(func(e entity.AuditEntry) bool {
+		if !slices.Contains(entity.AccountActions, e.Action) {
+			return false
+		}
+		if e.ActorID != nil {
+			return strconv.FormatInt(*e.ActorID, 10) == userID
+		}
+		return e.TargetType == "user" && e.TargetID == userID
+	}, limit, offset), nil
+}
+
+// Delete erases the user with their posts, friendships, comments and pending codes.
+func (s *Accounts) Delete(ctx context.Context, userID, password string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return functions.ErrUserNotFound
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		return functions.ErrWrongPassword
+	}
+	id, _ := strconv.Atoi(userID)
+
+	for friendID := range s.db.friends[id] {
+		delete(s.db.friends[friendID], id)
+	}
+	delete(s.db.friends, id)
+
+	posts := s.db.posts[:0]
+	for _, p := range s.db.posts {
+		if p.UserID == id {
+			continue
+		}
+		comments := p.Comments[:0]
+		for _, c := range p.Comments {
+			if c.Creator.UserId != id {
+				comments = append(comments, c)
+			}
+		}
+		p.Comments = comments
+		posts = append(posts, p)
+	}
+	s.db.posts = posts
+
+	for key := range s.db.codes {
+		if key.userID == userID {
+			delete(s.db.codes, key)
+		}
+	}
+	for token, r := range s.db.resets {
+		if r.userID == userID {
+			delete(s.db.resets, token)
+		}
+	}
+	delete(s.db.users, userID)
+
+	// like the audit_log redaction erasing an account does
+	for i := range s.db.audit {
+		e := &s.db.audit[i]
+		if e.ActorID != nil && *e.ActorID == int64(id) {
+			e.IP, e.UserAgent = nil, nil
+		}
+		if e.TargetType == "user" && e.TargetID == userID {
+			e.Details = map[string]interface{}{"redacted": true}
+		}
+	}
+	s.db.record(entity.Actor{UserID: userID}, entity.ActionAccountDelete, "user", userID, nil)
+
+	return nil
+}
+
+// Deactivate hides the user and signs them out, keeping their posts and friendships.
+func (s *Accounts) Deactivate(ctx context.Context, userID, password string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return functions.ErrUserNotFound
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		return functions.ErrWrongPassword
+	}
+	if session := u.session(); session.Suspended(time.Now()) {
+		return &functions.SuspendedError{Until: session.SuspendedUntil}
+	}
+
+	now := time.Now()
+	u.status, u.deactivatedAt = entity.StatusDeactivated, &now
+	u.suspendedAt, u.suspendedUntil, u.suspensionReason = nil, nil, nil
+	u.TokenVersion++
+	s.db.record(functions.OriginActor(ctx, userID), entity.ActionDeactivate, "user", userID, nil)
+	return nil
+}
@@ -0,0 +1,309 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+)
+
+// Admin moderates users and content like functions.Admin and keeps the audit log in memory.
+type Admin struct {
+	db *DB
+}
+
+// AuditLog returns the entries written so far, oldest first.
+func (db *DB) AuditLog() []entity.AuditEntry {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]entity.AuditEntry(nil), db.audit...)
+}
+
+func (db *DB) record(actor entity.Actor, action, targetType, targetID string, details map[string]interface{}) {
+	entry := entity.AuditEntry{
+		Id:         int64(len(db.audit) + 1),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	}
+	if id, err := strconv.ParseInt(actor.UserID, 10, 64); err == nil {
+		entry.ActorID = &id
+	}
+	if actor.IP != "" {
+		entry.IP = ptr(actor.IP)
+	}
+	if actor.UserAgent != "" {
+		entry.UserAgent = ptr(actor.UserAgent)
+	}
+	db.audit = append(db.audit, entry)
+}
+
+// auditLog pages through the entries match accepts, newest first.
+func (db *DB) auditLog(match func(e entity.AuditEntry) bool, limit, offset int) entity.AuditLogData {
+	var matched []entity.AuditEntry
+	for i := len(db.audit) - 1; i >= 0; i-- {
+		if match(db.audit[i]) {
+			matched = append(matched, db.audit[i])
+		}
+	}
+
+	result := entity.AuditLogData{
+		Data: []entity.AuditEntry{},
+		Meta: entity.Meta{Total: len(matched), Limit: limit, Offset: offset},
+	}
+	if offset < len(matched) {
+		result.Data = matched[offset:min(offset+limit, len(matched))]
+	}
+	return result
+}
+
+func (db *DB) adminUser(u *user) entity.AdminUser {
+	id, _ := strconv.Atoi(u.Id)
+	return entity.AdminUser{
+		Id:               u.Id,
+		Name:             u.Name,
+		Email:            u.Email,
+		Phone:            u.Phone,
+		ImageUrl:         u.ImageUrl,
+		Role:             u.Role,
+		FriendCount:      len(db.friends[id]),
+		Status:           u.accountStatus(),
+		SuspendedAt:      u.suspendedAt,
+		SuspendedUntil:   u.suspendedUntil,
+		SuspensionReason: u.suspensionReason,
+		CreatedAt:        u.createdAt,
+	}
+}
+
+// target returns the user an action is taken on, with the same checks as functions.Admin.
+func (db *DB) target(actor entity.Actor, userID string) (*user, error) {
+	if actor.UserID != "" && actor.UserID == userID {
+		return nil, functions.ErrCannotModerateSelf
+	}
+	u, ok := db.users[userID]
+	if !ok {
+		return nil, functions.ErrUserNotFound
+	}
+	if actor.UserID != "" && u.Role != entity.RoleUser && actor.Role != entity.RoleAdmin {
+		return nil, functions.ErrInsufficientRole
+	}
+	return u, nil
+}
+
+func (s *Admin) ListUsers(ctx context.Context, actor entity.Actor, q entity.QueryAdminUsers) (entity.AdminUserData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var matched []entity.AdminUser
+	for _, u := range s.db.users {
+		if q.Search != "" && !containsFold(u.Name, q.Search) && !containsFold(deref(u.Email), q.Search) && !containsFold(deref(u.Phone), q.Search) {
+			continue
+		}
+		if q.Role != "" && u.Role != q.Role {
+			continue
+		}
+		if q.Suspended && u.accountStatus() != entity.StatusSuspended {
+			continue
+		}
+		matched = append(matched, s.db.adminUser(u))
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, _ := strconv.Atoi(matched[i].Id)
+		b, _ := strconv.Atoi(matched[j].Id)
+		return a < b
+	})
+
+	result := entity.AdminUserData{
+		Data: []entity.AdminUser{},
+		Meta: entity.Meta{Total: len(matched), Limit: q.Limit, Offset: q.Offset},
+	}
+	if q.Offset < len(matched) {
+		matched = matched[q.Offset:]
+		if len(matched) > q.Limit {
+			matched = matched[:q.Limit]
+		}
+		result.Data = matched
+	}
+
+	s.db.record(actor, entity.ActionUserSearch, "user", "", map[string]interface{}{
+		"search":    q.Search,
+		"role":      q.Role,
+		"suspended": q.Suspended,
+	})
+	return result, nil
+}
+
+func (s *Admin) AuditLog(ctx context.Context, actor entity.Actor, q entity.QueryAuditLog) (entity.AuditLogData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	result := s.db.auditLog(func(e entity.AuditEntry) bool {
+		switch {
+		case q.ActorID != "" && (e.ActorID == nil || strconv.FormatInt(*e.ActorID, 10) != q.ActorID),
+			q.Action != "" && e.Action != q.Action,
+			q.TargetType != "" && e.TargetType != q.TargetType,
+			q.TargetID != "" && e.TargetID != q.TargetID,
+			q.Since != nil && e.CreatedAt.Before(*q.Since),
+			q.Until != nil && !e.CreatedAt.Before(*q.Until):
+			return false
+		}
+		return true
+	}, q.Limit, q.Offset)
+
+	s.db.record(actor, entity.ActionAuditSearch, "audit_log", "", map[string]interface{}{
+		"actorId":    q.ActorID,
+		"action":     q.Action,
+		"targetType": q.TargetType,
+		"targetId":   q.TargetID,
+	})
+	return result, nil
+}
+
+func (s *Admin) Suspend(ctx context.Context, actor entity.Actor, userID string, until *time.Time, reason string) (entity.AdminUser, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, err := s.db.target(actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	s.db.suspend(actor, u, until, reason)
+	return s.db.adminUser(u), nil
+}
+
+func (db *DB) suspend(actor entity.Actor, u *user, until *time.Time, reason string) {
+	previous := u.suspendedUntil
+	u.status = entity.StatusSuspended
+	u.suspendedAt, u.suspendedUntil, u.suspensionReason = ptr(time.Now()), until, ptr(reason)
+	u.TokenVersion++
+
+	db.record(actor, entity.ActionUserSuspend, "user", u.Id, map[string]interface{}{
+		"until":         until,
+		"reason":        reason,
+		"previousUntil": previous,
+	})
+}
+
+func (s *Admin) Unsuspend(ctx context.Context, actor entity.Actor, userID string) (entity.AdminUser, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, err := s.db.target(actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	s.db.record(actor, entity.ActionUserUnsuspend, "user", userID, map[string]interface{}{
+		"suspendedAt":    u.suspendedAt,
+		"suspendedUntil": u.suspendedUntil,
+		"reason":         u.suspensionReason,
+	})
+	if u.status == entity.StatusSuspended {
+		u.status = entity.StatusActive
+		u.suspendedAt, u.suspendedUntil, u.suspensionReason = nil, nil, nil
+	}
+	return s.db.adminUser(u), nil
+}
+
+func (s *Admin) SetRole(ctx context.Context, actor entity.Actor, userID, role string) (entity.AdminUser, error) {
+	if role != entity.RoleUser && role != entity.RoleModerator && role != entity.RoleAdmin {
+		return entity.AdminUser{}, functions.ErrInvalidRole
+	}
+	if actor.UserID != "" && actor.Role != entity.RoleAdmin {
+		return entity.AdminUser{}, functions.ErrInsufficientRole
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, err := s.db.target(actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	s.db.record(actor, entity.ActionUserRole, "user", userID, map[string]interface{}{
+		"from": u.Role,
+		"to":   role,
+	})
+	u.Role = role
+	u.TokenVersion++
+	return s.db.adminUser(u), nil
+}
+
+func (s *Admin) GetPost(ctx context.Context, actor entity.Actor, postID int) (entity.Post, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, p := range s.db.posts {
+		if p.Id == postID {
+			post := *p
+			post.Creator = s.db.creator(p.UserID)
+			post.Comments = append([]entity.CommentPerPost{}, p.Comments...)
+			s.db.record(actor, entity.ActionPostView, "post", strconv.Itoa(postID), nil)
+			return post, nil
+		}
+	}
+	return entity.Post{}, functions.ErrPostNotFound
+}
+
+func (s *Admin) DeletePost(ctx context.Context, actor entity.Actor, postID int, reason string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for i, p := range s.db.posts {
+		if p.Id == postID {
+			s.db.posts = append(s.db.posts[:i], s.db.posts[i+1:]...)
+			s.db.record(actor, entity.ActionPostDelete, "post", strconv.Itoa(postID), map[string]interface{}{
+				"authorId":   p.UserID,
+				"postInHtml": p.PostInHtml,
+				"tags":       p.Tags,
+				"reason":     reason,
+			})
+			return nil
+		}
+	}
+	return functions.ErrPostNotFound
+}
+
+func (s *Admin) DeleteComment(ctx context.Context, actor entity.Actor, postID int, commentID int64, reason string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, p := range s.db.posts {
+		if p.Id != postID {
+			continue
+		}
+		for i, c := range p.Comments {
+			if c.Id == commentID {
+				p.Comments = append(p.Comments[:i], p.Comments[i+1:]...)
+				s.db.record(actor, entity.ActionCommentDelete, "comment", strconv.FormatInt(commentID, 10), map[string]interface{}{
+					"postId":   postID,
+					"authorId": c.Creator.UserId,
+					"comment":  c.Comment,
+					"reason":   reason,
+				})
+				return nil
+			}
+		}
+		return functions.ErrCommentNotFound
+	}
+	return functions.ErrPostNotFound
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,212 @@
+// Package fakes keeps the stores the handlers use in memory, so handlers can be tested without
+// postgres or S3. They return the same db/functions errors as the real stores. Login lockouts,
+// the verification grace period and the storage deletion queue aren't modelled, the db/functions
+// tests cover them against postgres.
+package fakes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	codeTTL           = 10 * time.Minute
+	codeMaxAttempts   = 5
+	passwordResetTTL  = 30 * time.Minute
+	passwordHashCost  = bcrypt.MinCost
+	defaultFriendPage = 5
+)
+
+// DB is the state every fake store shares, friendships for example decide which posts a
+// user sees and who may comment on them.
+type DB struct {
+	mu sync.Mutex
+
+	users      map[string]*user
+	lastUserID int
+	// friends holds both directions of a friendship, like the friends table
+	friends       map[int]map[int]time.Time
+	posts         []*entity.Post
+	lastPostID    int
+	lastCommentID int64
+	codes         map[codeKey]*code
+	resets        map[string]*reset
+	audit         []entity.AuditEntry
+	reports       []*entity.Report
+	// uploads is who uploaded each object key, like the uploads table
+	uploads map[string]string
+	// hiddenBy is why a hidden post or comment is hidden, like posts.hidden_by
+	hiddenBy map[reported]string
+	// HideThreshold is the REPORT_HIDE_THRESHOLD of the fake reports, 0 never hides
+	HideThreshold int
+	// Retention is the DEACTIVATION_RETENTION within which a login brings an account back
+	Retention time.Duration
+}
+
+type (
+	user struct {
+		entity.User
+		createdAt time.Time
+
+		status           string
+		suspendedAt      *time.Time
+		suspendedUntil   *time.Time
+		suspensionReason *string
+		deactivatedAt    *time.Time
+	}
+
+	codeKey struct {
+		userID         string
+		credentialType string
+	}
+
+	code struct {
+		value           string
+		credentialValue string
+		attempts        int
+		expiresAt       time.Time
+	}
+
+	reset struct {
+		userID    string
+		expiresAt time.Time
+		used      bool
+	}
+)
+
+func New() *DB {
+	return &DB{
+		users:   map[string]*user{},
+		friends: map[int]map[int]time.Time{},
+		codes:   map[codeKey]*code{},
+		resets:  map[string]*reset{},
+		uploads: map[string]string{},
+
+		hiddenBy: map[reported]string{},
+
+		HideThreshold: 3,
+		Retention:     30 * 24 * time.Hour,
+	}
+}
+
+func (db *DB) Users() *Users                 { return &Users{db: db} }
+func (db *DB) Verification() *Verification   { return &Verification{db: db} }
+func (db *DB) PasswordReset() *PasswordReset { return &PasswordReset{db: db} }
+func (db *DB) Posts() *Posts                 { return &Posts{db: db} }
+func (db *DB) Friends() *Friends             { return &Friends{db: db} }
+func (db *DB) Accounts() *Accounts           { return &Accounts{db: db} }
+func (db *DB) Admin() *Admin                 { return &Admin{db: db} }
+func (db *DB) Reports() *Reports             { return &Reports{db: db} }
+func (db *DB) Uploads() *Uploads             { return &Uploads{db: db} }
+
+// credential returns the user holding value as their email or phone.
+func (db *DB) credential(credentialType, value string) (*user, error) {
+	if credentialType != "email" && credentialType != "phone" {
+		return nil, functions.ErrInvalidCredentialType
+	}
+	for _, u := range db.users {
+		if held := u.credential(credentialType); held != nil && *held == value {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DB) userByID(id int) *user {
+	return db.users[fmt.Sprint(id)]
+}
+
+func (db *DB) creator(id int) entity.Creator {
+	u := db.userByID(id)
+	if u == nil {
+		return entity.Creator{UserId: id}
+	}
+	return entity.Creator{
+		UserId:      id,
+		Name:        u.Name,
+		ImageUrl:    u.ImageUrl,
+		FriendCount: len(db.friends[id]),
+	}
+}
+
+func (u *user) credential(credentialType string) *string {
+	if credentialType == "phone" {
+		return u.Phone
+	}
+	return u.Email
+}
+
+func (u *user) verifiedAt(credentialType string) *time.Time {
+	if credentialType == "phone" {
+		return u.PhoneVerifiedAt
+	}
+	return u.EmailVerifiedAt
+}
+
+func (u *user) session() entity.Session {
+	return entity.Session{TokenVersion: u.TokenVersion, Status: u.accountStatus(), SuspendedUntil: u.suspendedUntil}
+}
+
+// accountStatus is what account_status() returns, a suspension past its end is over.
+func (u *user) accountStatus() string {
+	if u.status == entity.StatusSuspended && u.suspendedUntil != nil && !u.suspendedUntil.After(time.Now()) {
+		return entity.StatusActive
+	}
+	return u.status
+}
+
+func (u *user) active() bool {
+	return u.accountStatus() == entity.StatusActive
+}
+
+// inactive reports whether feeds leave out the posts and comments of the user.
+func (db *DB) inactive(id int) bool {
+	u := db.userByID(id)
+	return u != nil && !u.active()
+}
+
+// hidden reports whether the user is deactivated, their profile is left out of friend listings.
+func (db *DB) hidden(id int) bool {
+	u := db.userByID(id)
+	return u == nil || u.status == entity.StatusDeactivated
+}
+
+func (u *user) public() entity.User {
+	usr := u.User
+	usr.Password = ""
+	return usr
+}
+
+func hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	return string(hashed), err
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
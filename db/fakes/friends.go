@@ -0,0 +1,128 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+)
+
+type Friends struct {
+	db *DB
+}
+
+func (s *Friends) IsFriend(ctx context.Context, userID, friendID int) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	_, ok := s.db.friends[userID][friendID]
+	return ok, nil
+}
+
+// Get lists friendships like functions.Friend.Get, every friendship unless OnlyFriends
+// narrows it to the user's, ordered by when the friend registered.
+func (s *Friends) Get(ctx context.Context, q entity.QueryGetFriends) (entity.FriendData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var friends []entity.Friend
+	for userID, edges := range s.db.friends {
+		if q.OnlyFriends && userID != q.UserID {
+			continue
+		}
+		for friendID := range edges {
+			if s.db.hidden(friendID) {
+				continue
+			}
+			u := s.db.userByID(friendID)
+			if q.Search != "" && !strings.Contains(strings.ToLower(u.Name), strings.ToLower(q.Search)) {
+				continue
+			}
+			friends = append(friends, entity.Friend{
+				UserID:    userID,
+				FriendID:  friendID,
+				Name:      u.Name,
+				ImageUrl:  u.ImageUrl,
+				CreatedAt: u.createdAt,
+			})
+		}
+	}
+
+	sort.Slice(friends, func(i, j int) bool {
+		if q.OrderBy == "desc" {
+			i, j = j, i
+		}
+		if !friends[i].CreatedAt.Equal(friends[j].CreatedAt) {
+			return friends[i].CreatedAt.Before(friends[j].CreatedAt)
+		}
+		if friends[i].FriendID != friends[j].FriendID {
+			return friends[i].FriendID < friends[j].FriendID
+		}
+		return friends[i].UserID < friends[j].UserID
+	})
+
+	total := len(friends)
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultFriendPage
+	}
+	page := []entity.Friend{}
+	if q.Offset < total {
+		page = friends[q.Offset:min(q.Offset+limit, total)]
+	}
+
+	return entity.FriendData{
+		Data: page,
+		Meta: entity.Meta{Total: total, Limit: q.Limit, Offset: q.Offset},
+	}, nil
+}
+
+func (s *Friends) AddFriend(ctx context.Context, userID, friendID int) error {
+	if userID == friendID {
+		return functions.ErrNoAddSelf
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.hidden(friendID) {
+		return functions.ErrFriendNotFound
+	}
+	if _, ok := s.db.friends[userID][friendID]; ok {
+		return functions.ErrFriendshipExists
+	}
+
+	now := time.Now()
+	s.db.befriend(userID, friendID, now)
+	s.db.befriend(friendID, userID, now)
+	s.db.record(functions.OriginActor(ctx, strconv.Itoa(userID)), entity.ActionFriendAdd, "user", strconv.Itoa(friendID), nil)
+	return nil
+}
+
+func (s *Friends) DeleteFriend(ctx context.Context, userID, friendID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.userByID(friendID) == nil {
+		return functions.ErrFriendNotFound
+	}
+	if _, ok := s.db.friends[userID][friendID]; !ok {
+		return functions.ErrFriendshipNotExists
+	}
+
+	delete(s.db.friends[userID], friendID)
+	delete(s.db.friends[friendID], userID)
+	s.db.record(functions.OriginActor(ctx, strconv.Itoa(userID)), entity.ActionFriendDelete, "user", strconv.Itoa(friendID), nil)
+	return nil
+}
+
+func (db *DB) befriend(userID, friendID int, since time.Time) {
+	if db.friends[userID] == nil {
+		db.friends[userID] = map[int]time.Time{}
+	}
+	db.friends[userID][friendID] = since
+}
@@ -0,0 +1,51 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"segokuning/internal/notify"
+)
+
+// Notifier records messages instead of sending them, so tests can read the codes and
+// tokens a user would have received.
+type Notifier struct {
+	mu    sync.Mutex
+	sent  []notify.Message
+	delay time.Duration
+}
+
+func (n *Notifier) Send(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	delay := n.delay
+	n.mu.Unlock()
+	time.Sleep(delay)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// SetDelay makes every later Send take d, like a slow provider.
+func (n *Notifier) SetDelay(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.delay = d
+}
+
+// Last returns the latest message sent to the given address or number.
+func (n *Notifier) Last(to string) (notify.Message, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i := len(n.sent) - 1; i >= 0; i-- {
+		if n.sent[i].To == to {
+			return n.sent[i], true
+		}
+	}
+	return notify.Message{}, false
+}
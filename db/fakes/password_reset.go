@@ -0,0 +1,74 @@
+package fakes
+
+import (
+	"context"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+)
+
+type PasswordReset struct {
+	db *DB
+}
+
+func (s *PasswordReset) Issue(ctx context.Context, credentialType, credentialValue string) (entity.PasswordReset, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, err := s.db.credential(credentialType, credentialValue)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+	// an unverified credential can't reset the password
+	if u == nil || u.verifiedAt(credentialType) == nil {
+		return entity.PasswordReset{}, functions.ErrUserNotFound
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	for _, r := range s.db.resets {
+		if r.userID == u.Id {
+			r.used = true
+		}
+	}
+	r := &reset{userID: u.Id, expiresAt: time.Now().Add(passwordResetTTL)}
+	s.db.resets[token] = r
+
+	return entity.PasswordReset{
+		UserID:          u.Id,
+		CredentialType:  credentialType,
+		CredentialValue: credentialValue,
+		Token:           token,
+		ExpiresAt:       r.expiresAt,
+	}, nil
+}
+
+func (s *PasswordReset) Reset(ctx context.Context, token, newPassword string) error {
+	hashed, err := hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	r, ok := s.db.resets[token]
+	if !ok || r.used || r.expiresAt.Before(time.Now()) {
+		return functions.ErrInvalidResetToken
+	}
+	r.used = true
+
+	u, ok := s.db.users[r.userID]
+	if !ok {
+		return functions.ErrInvalidResetToken
+	}
+	u.Password = hashed
+	u.TokenVersion++
+	s.db.record(functions.OriginActor(ctx, r.userID), entity.ActionPasswordReset, "user", r.userID, nil)
+
+	return nil
+}
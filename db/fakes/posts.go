@@ -0,0 +1,129 @@
+package fakes
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"segokuning/db/entity"
+)
+
+// Posts stores posts and the comments on them, like functions.Post.
+type Posts struct {
+	db *DB
+}
+
+func (s *Posts) Add(ctx context.Context, post entity.Post) (entity.Post, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.lastPostID++
+	post.Id = s.db.lastPostID
+	post.CreatedAt = time.Now()
+	post.Comments = []entity.CommentPerPost{}
+	stored := post
+	s.db.posts = append(s.db.posts, &stored)
+
+	return post, nil
+}
+
+func (s *Posts) GetByID(ctx context.Context, postID int) (entity.Post, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, p := range s.db.posts {
+		if p.Id == postID {
+			return entity.Post{Id: p.Id, UserID: p.UserID}, nil
+		}
+	}
+	return entity.Post{}, nil
+}
+
+func (s *Posts) AddComment(ctx context.Context, postID int, comment entity.CommentPerPost) (entity.CommentPerPost, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	comment.Creator = s.db.creator(comment.Creator.UserId)
+	s.db.lastCommentID++
+	comment.Id = s.db.lastCommentID
+	for _, p := range s.db.posts {
+		if p.Id == postID {
+			p.Comments = append(p.Comments, comment)
+			break
+		}
+	}
+	return comment, nil
+}
+
+// Get returns the feed of the user, their own and their friends' posts, newest first.
+func (s *Posts) Get(ctx context.Context, query entity.QueryGetPosts) ([]entity.Post, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	feed := s.feed(query)
+	if query.Offset >= len(feed) {
+		return []entity.Post{}, nil
+	}
+	feed = feed[query.Offset:]
+	if len(feed) > query.Limit {
+		feed = feed[:query.Limit]
+	}
+
+	posts := make([]entity.Post, 0, len(feed))
+	for _, p := range feed {
+		post := *p
+		post.Creator = s.db.creator(p.UserID)
+		post.Comments = make([]entity.CommentPerPost, 0, len(p.Comments))
+		for i := len(p.Comments) - 1; i >= 0; i-- {
+			if c := p.Comments[i]; !c.Hidden && !s.db.inactive(c.Creator.UserId) {
+				post.Comments = append(post.Comments, p.Comments[i])
+			}
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (s *Posts) Count(ctx context.Context, query entity.QueryGetPosts) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return len(s.feed(query)), nil
+}
+
+func (s *Posts) feed(query entity.QueryGetPosts) []*entity.Post {
+	var feed []*entity.Post
+	for i := len(s.db.posts) - 1; i >= 0; i-- {
+		p := s.db.posts[i]
+		if p.Hidden || s.db.inactive(p.UserID) {
+			continue
+		}
+		if _, friend := s.db.friends[query.UserId][p.UserID]; !friend && p.UserID != query.UserId {
+			continue
+		}
+		if query.Search != "" && !strings.Contains(strings.ToLower(p.PostInHtml), strings.ToLower(query.Search)) {
+			continue
+		}
+		if !hasTags(p.Tags, query.SearchTags) {
+			continue
+		}
+		feed = append(feed, p)
+	}
+	return feed
+}
+
+func hasTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, t := range tags {
+			if t == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
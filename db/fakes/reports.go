@@ -0,0 +1,245 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+)
+
+// Reports files reports and keeps the moderation queue like functions.Report, hiding content
+// past DB.HideThreshold.
+type Reports struct {
+	db *DB
+}
+
+// reportTarget returns the author of the reported content or the reported user, the post of a
+// comment and the post or comment itself.
+func (db *DB) reportTarget(targetType string, targetID int64) (int, *entity.Post, *entity.CommentPerPost, error) {
+	switch targetType {
+	case entity.ReportTargetPost:
+		for _, p := range db.posts {
+			if int64(p.Id) == targetID {
+				return p.UserID, p, nil, nil
+			}
+		}
+		return 0, nil, nil, functions.ErrPostNotFound
+	case entity.ReportTargetComment:
+		for _, p := range db.posts {
+			for i, c := range p.Comments {
+				if c.Id == targetID {
+					return c.Creator.UserId, p, &p.Comments[i], nil
+				}
+			}
+		}
+		return 0, nil, nil, functions.ErrCommentNotFound
+	case entity.ReportTargetUser:
+		if u := db.userByID(int(targetID)); u != nil {
+			return int(targetID), nil, nil, nil
+		}
+		return 0, nil, nil, functions.ErrUserNotFound
+	}
+	return 0, nil, nil, functions.ErrInvalidReportTarget
+}
+
+// reported is a reported post or comment.
+type reported struct {
+	targetType string
+	targetID   int64
+}
+
+// hide hides a post or comment, by its reports or by a moderator, what a moderator hid stays theirs.
+func (db *DB) hide(targetType string, targetID int64, by string) {
+	_, post, comment, err := db.reportTarget(targetType, targetID)
+	if err != nil {
+		return
+	}
+	switch {
+	case comment != nil:
+		comment.Hidden = true
+	case post != nil:
+		post.Hidden = true
+	}
+	if key := (reported{targetType, targetID}); db.hiddenBy[key] != "moderator" {
+		db.hiddenBy[key] = by
+	}
+}
+
+// unhide shows a post or comment its reports hid again.
+func (db *DB) unhide(targetType string, targetID int64) {
+	_, post, comment, err := db.reportTarget(targetType, targetID)
+	key := reported{targetType, targetID}
+	if err != nil || db.hiddenBy[key] != "reports" {
+		return
+	}
+	switch {
+	case comment != nil:
+		comment.Hidden = false
+	case post != nil:
+		post.Hidden = false
+	}
+	delete(db.hiddenBy, key)
+}
+
+func (db *DB) report(r *entity.Report) entity.Report {
+	report := *r
+	report.Reports = 0
+	for _, o := range db.reports {
+		if o.TargetType == r.TargetType && o.TargetID == r.TargetID && o.Status == entity.ReportOpen {
+			report.Reports++
+		}
+	}
+	if _, post, comment, err := db.reportTarget(r.TargetType, r.TargetID); err == nil {
+		report.Hidden = (comment != nil && comment.Hidden) || (comment == nil && post != nil && post.Hidden)
+	}
+	return report
+}
+
+func (s *Reports) Add(ctx context.Context, report entity.Report) (entity.Report, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	authorID, post, comment, err := s.db.reportTarget(report.TargetType, report.TargetID)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	// only whoever sees the post reports it or its comments
+	if post != nil && int64(post.UserID) != report.ReporterID {
+		if _, ok := s.db.friends[int(report.ReporterID)][post.UserID]; !ok {
+			if comment != nil {
+				return entity.Report{}, functions.ErrCommentNotFound
+			}
+			return entity.Report{}, functions.ErrPostNotFound
+		}
+	}
+	if int64(authorID) == report.ReporterID {
+		return entity.Report{}, functions.ErrCannotReportSelf
+	}
+	for _, o := range s.db.reports {
+		if o.ReporterID == report.ReporterID && o.TargetType == report.TargetType && o.TargetID == report.TargetID &&
+			o.Status == entity.ReportOpen {
+			return entity.Report{}, functions.ErrAlreadyReported
+		}
+	}
+	if comment != nil {
+		report.PostID = ptr(int64(post.Id))
+	}
+
+	report.Id = int64(len(s.db.reports) + 1)
+	report.Status = entity.ReportOpen
+	report.CreatedAt = time.Now()
+	stored := report
+	s.db.reports = append(s.db.reports, &stored)
+
+	report = s.db.report(&stored)
+	if s.db.HideThreshold > 0 && report.Reports >= s.db.HideThreshold && report.TargetType != entity.ReportTargetUser {
+		s.db.hide(report.TargetType, report.TargetID, "reports")
+		report.Hidden = true
+	}
+	return report, nil
+}
+
+func (s *Reports) Queue(ctx context.Context, q entity.QueryReports) (entity.ReportData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if q.Status == "" {
+		q.Status = entity.ReportOpen
+	}
+
+	var matched []entity.Report
+	for _, r := range s.db.reports {
+		if r.Status != q.Status || (q.TargetType != "" && r.TargetType != q.TargetType) {
+			continue
+		}
+		matched = append(matched, s.db.report(r))
+	}
+	if q.Status != entity.ReportOpen {
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Id > matched[j].Id })
+	}
+
+	result := entity.ReportData{
+		Data: []entity.Report{},
+		Meta: entity.Meta{Total: len(matched), Limit: q.Limit, Offset: q.Offset},
+	}
+	if q.Offset < len(matched) {
+		matched = matched[q.Offset:]
+		if len(matched) > q.Limit {
+			matched = matched[:q.Limit]
+		}
+		result.Data = matched
+	}
+	return result, nil
+}
+
+func (s *Reports) Resolve(ctx context.Context, actor entity.Actor, reportID int64, res entity.Resolution) (entity.Report, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if reportID < 1 || reportID > int64(len(s.db.reports)) {
+		return entity.Report{}, functions.ErrReportNotFound
+	}
+	r := s.db.reports[reportID-1]
+	if r.Status != entity.ReportOpen {
+		return entity.Report{}, functions.ErrReportResolved
+	}
+
+	details := map[string]interface{}{
+		"action":     res.Action,
+		"reason":     res.Reason,
+		"targetType": r.TargetType,
+		"targetId":   r.TargetID,
+	}
+
+	status := entity.ReportActioned
+	switch res.Action {
+	case entity.ResolveDismiss:
+		status = entity.ReportDismissed
+		s.db.unhide(r.TargetType, r.TargetID)
+	case entity.ResolveHide:
+		if r.TargetType == entity.ReportTargetUser {
+			return entity.Report{}, functions.ErrInvalidResolution
+		}
+		if _, _, _, err := s.db.reportTarget(r.TargetType, r.TargetID); err != nil {
+			return entity.Report{}, err
+		}
+		s.db.hide(r.TargetType, r.TargetID, "moderator")
+	case entity.ResolveSuspend:
+		authorID, _, _, err := s.db.reportTarget(r.TargetType, r.TargetID)
+		if err != nil {
+			return entity.Report{}, err
+		}
+		u, err := s.db.target(actor, strconv.Itoa(authorID))
+		if err != nil {
+			return entity.Report{}, err
+		}
+		s.db.suspend(actor, u, res.Until, res.Reason)
+		s.db.hide(r.TargetType, r.TargetID, "moderator")
+		details["userId"] = u.Id
+		details["until"] = res.Until
+	default:
+		return entity.Report{}, functions.ErrInvalidResolution
+	}
+
+	var (
+		resolved int
+		now      = time.Now()
+		by, _    = strconv.ParseInt(actor.UserID, 10, 64)
+	)
+	for _, o := range s.db.reports {
+		if o.TargetType == r.TargetType && o.TargetID == r.TargetID && o.Status == entity.ReportOpen {
+			o.Status, o.Resolution, o.ResolvedAt = status, ptr(res.Action), &now
+			if actor.UserID != "" {
+				o.ResolvedBy = ptr(by)
+			}
+			resolved++
+		}
+	}
+	details["reports"] = resolved
+
+	s.db.record(actor, entity.ActionReportResolve, "report", strconv.FormatInt(reportID, 10), details)
+	return s.db.report(r), nil
+}
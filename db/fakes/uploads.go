@@ -0,0 +1,15 @@
+package fakes
+
+import "context"
+
+type Uploads struct {
+	db *DB
+}
+
+func (s *Uploads) Add(ctx context.Context, userID, key string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.uploads[key] = userID
+	return nil
+}
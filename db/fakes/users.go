@@ -0,0 +1,198 @@
+package fakes
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Users struct {
+	db *DB
+}
+
+func (s *Users) Register(ctx context.Context, usr entity.User) (entity.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	existing, err := s.db.credential(usr.CredentialType, usr.CredentialValue)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if existing != nil {
+		return entity.User{}, functions.ErrExistingUsername
+	}
+
+	hashed, err := hash(usr.Password)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	s.db.lastUserID++
+	u := &user{
+		User: entity.User{
+			Id:              strconv.Itoa(s.db.lastUserID),
+			Name:            usr.Name,
+			Password:        hashed,
+			CredentialType:  usr.CredentialType,
+			CredentialValue: usr.CredentialValue,
+			Role:            entity.RoleUser,
+		},
+		createdAt: time.Now(),
+		status:    entity.StatusActive,
+	}
+	if usr.CredentialType == "phone" {
+		u.Phone = ptr(usr.CredentialValue)
+	} else {
+		u.Email = ptr(usr.CredentialValue)
+	}
+	s.db.users[u.Id] = u
+
+	return u.public(), nil
+}
+
+func (s *Users) Login(ctx context.Context, usr entity.User) (entity.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, err := s.db.credential(usr.CredentialType, usr.CredentialValue)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if u != nil && u.status == entity.StatusDeactivated && time.Since(*u.deactivatedAt) > s.db.Retention {
+		u = nil
+	}
+	if u == nil || bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(usr.Password)) != nil {
+		s.loginFailed(ctx, usr, u, "password")
+		return entity.User{}, functions.ErrInvalidCredentials
+	}
+	if session := u.session(); session.Suspended(time.Now()) {
+		s.loginFailed(ctx, usr, u, "suspended")
+		return entity.User{}, &functions.SuspendedError{Until: session.SuspendedUntil}
+	}
+	reactivated := u.status == entity.StatusDeactivated
+	if reactivated {
+		u.status, u.deactivatedAt = entity.StatusActive, nil
+	}
+	s.db.record(functions.OriginActor(ctx, u.Id), entity.ActionLogin, "user", u.Id, map[string]interface{}{
+		"credentialType": usr.CredentialType,
+		"reactivated":    reactivated,
+	})
+
+	result := u.public()
+	result.CredentialType, result.CredentialValue = usr.CredentialType, usr.CredentialValue
+	return result, nil
+}
+
+// loginFailed audits a refused login on u, or on the credential when it belongs to no one.
+func (s *Users) loginFailed(ctx context.Context, usr entity.User, u *user, reason string) {
+	targetType, targetID := "credential", usr.CredentialValue
+	if u != nil {
+		targetType, targetID = "user", u.Id
+	}
+	s.db.record(functions.OriginActor(ctx, ""), entity.ActionLoginFailed, targetType, targetID, map[string]interface{}{
+		"credentialType": usr.CredentialType,
+		"reason":         reason,
+	})
+}
+
+func (s *Users) Session(ctx context.Context, userID string) (entity.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.Session{}, functions.ErrUserNotFound
+	}
+	return u.session(), nil
+}
+
+func (s *Users) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) (entity.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.User{}, functions.ErrUserNotFound
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(currentPassword)) != nil {
+		return entity.User{}, functions.ErrWrongPassword
+	}
+
+	hashed, err := hash(newPassword)
+	if err != nil {
+		return entity.User{}, err
+	}
+	u.Password = hashed
+	u.TokenVersion++
+
+	for _, r := range s.db.resets {
+		if r.userID == userID {
+			r.used = true
+		}
+	}
+	s.db.record(functions.OriginActor(ctx, userID), entity.ActionPasswordChange, "user", userID, nil)
+
+	return u.public(), nil
+}
+
+func (s *Users) UpdateEmail(ctx context.Context, userID string, email string) (entity.User, error) {
+	return s.link(ctx, userID, "email", email, functions.ErrEmailExists, functions.ErrEmailAlreadySet)
+}
+
+func (s *Users) UpdatePhone(ctx context.Context, userID string, phone string) (entity.User, error) {
+	return s.link(ctx, userID, "phone", phone, functions.ErrPhoneExists, functions.ErrPhoneAlreadySet)
+}
+
+func (s *Users) link(ctx context.Context, userID, credentialType, value string, errExists, errAlreadySet error) (entity.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if holder, _ := s.db.credential(credentialType, value); holder != nil {
+		return entity.User{}, errExists
+	}
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.User{}, functions.ErrUserNotFound
+	}
+	old := u.credential(credentialType)
+	if old != nil {
+		return entity.User{}, errAlreadySet
+	}
+
+	action := entity.ActionEmailUpdate
+	if credentialType == "phone" {
+		u.Phone, u.PhoneVerifiedAt = ptr(value), nil
+		action = entity.ActionPhoneUpdate
+	} else {
+		u.Email, u.EmailVerifiedAt = ptr(value), nil
+	}
+	s.db.record(functions.OriginActor(ctx, userID), action, "user", userID, map[string]interface{}{
+		"before": map[string]interface{}{credentialType: old},
+		"after":  map[string]interface{}{credentialType: value},
+	})
+
+	return entity.User{Id: u.Id, Name: u.Name, Phone: u.Phone, Email: u.Email}, nil
+}
+
+func (s *Users) UpdateAccount(ctx context.Context, userID, name, imageURL string) (entity.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.User{}, functions.ErrUserNotFound
+	}
+	s.db.record(functions.OriginActor(ctx, userID), entity.ActionAccountUpdate, "user", userID, map[string]interface{}{
+		"before": map[string]interface{}{"name": u.Name, "imageUrl": u.ImageUrl},
+		"after":  map[string]interface{}{"name": name, "imageUrl": imageURL},
+	})
+	u.Name, u.ImageUrl = name, ptr(imageURL)
+
+	return entity.User{Id: u.Id, Phone: u.Phone, Email: u.Email}, nil
+}
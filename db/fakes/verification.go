@@ -0,0 +1,101 @@
+package fakes
+
+import (
+	"context"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/db/functions"
+)
+
+type Verification struct {
+	db *DB
+}
+
+func (s *Verification) Issue(ctx context.Context, userID string, credentialType string) (entity.Verification, error) {
+	if credentialType != "email" && credentialType != "phone" {
+		return entity.Verification{}, functions.ErrInvalidCredentialType
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.Verification{}, functions.ErrUserNotFound
+	}
+	value := u.credential(credentialType)
+	if value == nil {
+		return entity.Verification{}, functions.ErrCredentialNotSet
+	}
+	if u.verifiedAt(credentialType) != nil {
+		return entity.Verification{}, functions.ErrAlreadyVerified
+	}
+
+	plain, err := newCode()
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	// a new code replaces the pending one
+	c := &code{value: plain, credentialValue: *value, expiresAt: time.Now().Add(codeTTL)}
+	s.db.codes[codeKey{userID, credentialType}] = c
+
+	return entity.Verification{
+		UserID:          userID,
+		CredentialType:  credentialType,
+		CredentialValue: *value,
+		Code:            plain,
+		ExpiresAt:       c.expiresAt,
+	}, nil
+}
+
+func (s *Verification) Verify(ctx context.Context, userID string, credentialType string, plain string) (entity.Verification, error) {
+	if credentialType != "email" && credentialType != "phone" {
+		return entity.Verification{}, functions.ErrInvalidCredentialType
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	key := codeKey{userID, credentialType}
+	c, ok := s.db.codes[key]
+	if !ok {
+		return entity.Verification{}, functions.ErrInvalidCode
+	}
+	if c.attempts >= codeMaxAttempts {
+		return entity.Verification{}, functions.ErrTooManyAttempts
+	}
+	if c.expiresAt.Before(time.Now()) {
+		return entity.Verification{}, functions.ErrCodeExpired
+	}
+	if c.value != plain {
+		c.attempts++
+		return entity.Verification{}, functions.ErrInvalidCode
+	}
+	delete(s.db.codes, key)
+
+	// the code only verifies the value it was sent to, not one linked since
+	u, ok := s.db.users[userID]
+	if !ok {
+		return entity.Verification{}, functions.ErrInvalidCode
+	}
+	value := u.credential(credentialType)
+	if value == nil || *value != c.credentialValue {
+		return entity.Verification{}, functions.ErrInvalidCode
+	}
+
+	now := time.Now()
+	if credentialType == "phone" {
+		u.PhoneVerifiedAt = &now
+	} else {
+		u.EmailVerifiedAt = &now
+	}
+
+	return entity.Verification{
+		UserID:          userID,
+		CredentialType:  credentialType,
+		CredentialValue: c.credentialValue,
+		ExpiresAt:       c.expiresAt,
+	}, nil
+}
@@ -0,0 +1,423 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"segokuning/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Account struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+	cache  *feedCache
+}
+
+func NewAccount(dbPool *pgxpool.Pool, config configs.Config) *Account {
+	return &Account{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// WithCache drops the feeds, friend ids and creators a deactivated or erased account leaves from c.
+func (a *Account) WithCache(c cache.Cache) *Account {
+	a.cache = newFeedCache(c, a.config.CacheTTL)
+	return a
+}
+
+// invalidate drops what showed erased accounts: their friends' creators and friend ids, changed
+// with the friendships, and the feeds of stale, see erase.
+func (a *Account) invalidate(ctx context.Context, stale []int) {
+	a.cache.invalidateUser(ctx, stale...)
+	a.cache.invalidateFeeds(ctx, a.dbPool, stale...)
+}
+
+// Export collects everything the user created from a single snapshot.
+func (a *Account) Export(ctx context.Context, userID string) (entity.AccountExport, error) {
+	conn, err := a.dbPool.Acquire(ctx)
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	result := entity.AccountExport{
+		Posts:      []entity.ExportedPost{},
+		Comments:   []entity.ExportedComment{},
+		Friends:    []entity.ExportedFriend{},
+		ExportedAt: time.Now().UTC(),
+	}
+
+	err = tx.QueryRow(ctx, `SELECT id, name, email, phone, image_url, email_verified_at, phone_verified_at, created_at
+		FROM users WHERE id = $1`, userID).Scan(
+		&result.Account.Id, &result.Account.Name, &result.Account.Email, &result.Account.Phone, &result.Account.ImageUrl,
+		&result.Account.EmailVerifiedAt, &result.Account.PhoneVerifiedAt, &result.Account.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.AccountExport{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+
+	// the profile image goes in the archive only when the user uploaded it
+	if result.Account.ImageUrl != nil {
+		if key, ok := utils.ObjectKey(*result.Account.ImageUrl); ok {
+			err = tx.QueryRow(ctx, `SELECT object_key FROM uploads WHERE object_key = $1 AND user_id = $2`, key, userID).Scan(&result.ImageKey)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return entity.AccountExport{}, err
+			}
+		}
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, post_in_html, tags, created_at FROM posts WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+	for rows.Next() {
+		var post entity.ExportedPost
+		if err := rows.Scan(&post.Id, &post.PostInHtml, &post.Tags, &post.CreatedAt); err != nil {
+			rows.Close()
+			return entity.AccountExport{}, err
+		}
+		result.Posts = append(result.Posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return entity.AccountExport{}, err
+	}
+
+	// comments live inside posts.comments, with a copy of their creator
+	rows, err = tx.Query(ctx, `SELECT p.id, c->>'comment', (c->>'createdAt')::timestamptz
+		FROM posts p, jsonb_array_elements(p.comments) c
+		WHERE (c->'creator'->>'userId')::bigint = $1
+		ORDER BY 3`, userID)
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+	for rows.Next() {
+		var comment entity.ExportedComment
+		if err := rows.Scan(&comment.PostId, &comment.Comment, &comment.CreatedAt); err != nil {
+			rows.Close()
+			return entity.AccountExport{}, err
+		}
+		result.Comments = append(result.Comments, comment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return entity.AccountExport{}, err
+	}
+
+	rows, err = tx.Query(ctx, `SELECT u.id, u.name, f.created_at FROM friends f
+		JOIN users u ON u.id = f.friend_id
+		WHERE f.user_id = $1 ORDER BY f.created_at`, userID)
+	if err != nil {
+		return entity.AccountExport{}, err
+	}
+	for rows.Next() {
+		var friend entity.ExportedFriend
+		if err := rows.Scan(&friend.UserId, &friend.Name, &friend.Since); err != nil {
+			rows.Close()
+			return entity.AccountExport{}, err
+		}
+		result.Friends = append(result.Friends, friend)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return entity.AccountExport{}, err
+	}
+
+	return result, tx.Commit(ctx)
+}
+
+// Activity lists the account events of the user, newest first: what they did and the failed
+// logins on their account. What other users did to them isn't theirs to see.
+func (a *Account) Activity(ctx context.Context, userID string, limit, offset int) (entity.AuditLogData, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return entity.AuditLogData{}, ErrUserNotFound
+	}
+
+	where := ` WHERE action = ANY($1) AND (actor_id = $2 OR (actor_id IS NULL AND target_type = 'user' AND target_id = $3))`
+	return auditLog(ctx, a.dbPool, where, []interface{}{entity.AccountActions, id, userID}, limit, offset)
+}
+
+// Delete erases the account after checking its password, all in one transaction. A wrong password
+// counts toward the login lockout, see confirmPassword.
+func (a *Account) Delete(ctx context.Context, userID, password string) error {
+	err := a.delete(ctx, userID, password)
+	if errors.Is(err, ErrWrongPassword) {
+		return recordWrongPassword(ctx, a.dbPool, a.config, userID)
+	}
+	return err
+}
+
+func (a *Account) delete(ctx context.Context, userID, password string) error {
+	conn, err := a.dbPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var hash string
+	err = tx.QueryRow(ctx, `SELECT password FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(ctx, tx, userID, hash, password); err != nil {
+		return err
+	}
+
+	stale, err := erase(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// where it was deleted from goes with the account
+	err = audit(ctx, tx, entity.Actor{UserID: userID}, entity.ActionAccountDelete, "user", userID, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx, stale)
+	return nil
+}
+
+// Deactivate hides the account after checking its password and signs it out. Its data and
+// friendships are kept, logging in within DeactivationRetention brings it back. A wrong password
+// counts toward the login lockout, see confirmPassword.
+func (a *Account) Deactivate(ctx context.Context, userID, password string) error {
+	err := a.deactivate(ctx, userID, password)
+	if errors.Is(err, ErrWrongPassword) {
+		return recordWrongPassword(ctx, a.dbPool, a.config, userID)
+	}
+	return err
+}
+
+func (a *Account) deactivate(ctx context.Context, userID, password string) error {
+	conn, err := a.dbPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		hash    string
+		session entity.Session
+	)
+	err = tx.QueryRow(ctx, `SELECT password, account_status(status, suspended_until), suspended_until FROM users WHERE id = $1 FOR UPDATE`,
+		userID).Scan(&hash, &session.Status, &session.SuspendedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(ctx, tx, userID, hash, password); err != nil {
+		return err
+	}
+
+	// coming back by login must not lift a suspension
+	if session.Suspended(time.Now()) {
+		return &SuspendedError{Until: session.SuspendedUntil}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET status = 'deactivated', deactivated_at = now(), token_version = token_version + 1,
+		suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL
+		WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionDeactivate, "user", userID, nil)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	stale, err := a.cache.audience(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	a.cache.invalidateFeeds(ctx, a.dbPool, stale...)
+	return nil
+}
+
+// PurgeDeactivated erases up to batch accounts deactivated longer than DeactivationRetention ago,
+// the way Delete does, and returns how many it erased. Accounts locked by a login coming back are skipped.
+func (a *Account) PurgeDeactivated(ctx context.Context, batch int) (int, error) {
+	conn, err := a.dbPool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id::text FROM users
+		WHERE status = 'deactivated' AND deactivated_at < now() - make_interval(secs => $1)
+		ORDER BY deactivated_at LIMIT $2 FOR UPDATE SKIP LOCKED`, a.config.DeactivationRetention.Seconds(), batch)
+	if err != nil {
+		return 0, err
+	}
+	var accounts []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		accounts = append(accounts, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var stale []int
+	for _, id := range accounts {
+		shown, err := erase(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		stale = append(stale, shown...)
+		err = audit(ctx, tx, entity.Actor{}, entity.ActionAccountDelete, "user", id, map[string]interface{}{
+			"reason": "deactivation retention",
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	a.invalidate(ctx, stale)
+	return len(accounts), nil
+}
+
+// erase removes the locked account userID: friends' counters are corrected, its comments on other
+// users' posts removed, its login failures dropped, its audit entries redacted and the objects it
+// uploaded queued for deletion from storage. Posts, friendships, uploads and pending codes go with
+// the users row.
+// It returns the users whose cached feeds showed the account, its friends and the authors of the
+// posts it commented on.
+func erase(ctx context.Context, tx pgx.Tx, userID string) ([]int, error) {
+	friends, err := returnedIDs(tx.Query(ctx, `UPDATE friends_counter SET friend_count = friend_count - 1
+		WHERE user_id IN (SELECT friend_id FROM friends WHERE user_id = $1) RETURNING user_id`, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	authors, err := returnedIDs(tx.Query(ctx, `UPDATE posts SET comments = COALESCE((
+			SELECT jsonb_agg(c ORDER BY i) FROM jsonb_array_elements(comments) WITH ORDINALITY AS t(c, i)
+			WHERE (c->'creator'->>'userId')::bigint <> $1
+		), '[]'::jsonb)
+		WHERE comments @> jsonb_build_array(jsonb_build_object('creator', jsonb_build_object('userId', $1::bigint)))
+		RETURNING user_id`, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM login_failures lf USING users u WHERE u.id = $1
+		AND ((lf.credential_type = 'email' AND lf.credential_value = u.email)
+		OR (lf.credential_type = 'phone' AND lf.credential_value = u.phone))`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the log keeps what happened but not where the account connected from nor what it held, the
+	// only change audit_log_append_only lets through and only for the user set in the transaction
+	_, err = tx.Exec(ctx, `SELECT set_config('segokuning.redact_user', $1, true)`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE audit_log SET
+			ip = CASE WHEN actor_id = $1 THEN NULL ELSE ip END,
+			user_agent = CASE WHEN actor_id = $1 THEN NULL ELSE user_agent END,
+			details = CASE WHEN target_type = 'user' AND target_id = $2 THEN '{"redacted": true}'::jsonb ELSE details END
+		WHERE actor_id = $1 OR (target_type = 'user' AND target_id = $2)`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `SELECT set_config('segokuning.redact_user', '', true)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// only what it uploaded, its image URL may point at someone else's object
+	_, err = tx.Exec(ctx, `INSERT INTO storage_deletions (object_key) SELECT object_key FROM uploads WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return nil, err
+	}
+	return append(friends, authors...), nil
+}
+
+// returnedIDs reads the ids an UPDATE ... RETURNING gave back.
+func returnedIDs(rows pgx.Rows, err error) ([]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,476 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"strconv"
+	"testing"
+)
+
+func TestDeactivate(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := context.Background()
+
+	friends := NewFriend(dbPool, config)
+	if err := friends.AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	listed := func() int {
+		t.Helper()
+		got, err := friends.Get(ctx, entity.QueryGetFriends{UserID: ids[1], OnlyFriends: true, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Meta.Total
+	}
+
+	account := NewAccount(dbPool, config)
+	userID := strconv.Itoa(ids[0])
+	if err := account.Deactivate(ctx, userID, "wrong-password"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("Deactivate() with a wrong password error = %v, want %v", err, ErrWrongPassword)
+	}
+	if err := account.Deactivate(ctx, userID, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if total := listed(); total != 0 {
+		t.Fatalf("%d friends listed with the friend deactivated, want 0", total)
+	}
+	if err := friends.AddFriend(ctx, ids[1], ids[0]); !errors.Is(err, ErrFriendNotFound) {
+		t.Fatalf("AddFriend() of a deactivated user error = %v, want %v", err, ErrFriendNotFound)
+	}
+
+	// logging in comes back with the friendship intact
+	user := NewUser(dbPool, config)
+	login := entity.User{CredentialType: "email", CredentialValue: "user1@example.com", Password: "password123"}
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatalf("Login() of a deactivated user error = %v", err)
+	}
+	if session, err := user.Session(ctx, userID); err != nil || session.Status != entity.StatusActive {
+		t.Fatalf("Session() after coming back = %+v, %v", session, err)
+	}
+	if total := listed(); total != 1 {
+		t.Fatalf("%d friends listed after coming back, want 1", total)
+	}
+
+	// past the retention window login fails and the purge erases the account
+	if err := account.Deactivate(ctx, userID, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbPool.Exec(ctx, `UPDATE users SET deactivated_at = now() - make_interval(secs => $2) - interval '1 minute' WHERE id = $1`,
+		ids[0], config.DeactivationRetention.Seconds()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Login(ctx, login); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() past retention error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if n, err := account.PurgeDeactivated(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("PurgeDeactivated() = %d, %v, want 1", n, err)
+	}
+	if _, err := user.Session(ctx, userID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Session() of a purged user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestDeactivateLockout(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.LoginMaxFailures = 2
+	ids := register(t, dbPool, config, 1)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
+
+	account := NewAccount(dbPool, config)
+	for i := 0; i < config.LoginMaxFailures; i++ {
+		if err := account.Deactivate(ctx, userID, "wrong-password"); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("wrong password %d error = %v, want %v", i+1, err, ErrWrongPassword)
+		}
+	}
+	if err := account.Deactivate(ctx, userID, "password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Deactivate() while locked error = %v, want %v", err, ErrAccountLocked)
+	}
+	if err := account.Delete(ctx, userID, "password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Delete() while locked error = %v, want %v", err, ErrAccountLocked)
+	}
+}
+
+func TestUnfriendDeactivated(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := context.Background()
+
+	friends := NewFriend(dbPool, config)
+	if err := friends.AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewAccount(dbPool, config).Deactivate(ctx, strconv.Itoa(ids[1]), "password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	// hidden from adding, not from leaving
+	if err := friends.DeleteFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatalf("DeleteFriend() of a deactivated friend error = %v", err)
+	}
+	if err := friends.AddFriend(ctx, ids[0], ids[1]); !errors.Is(err, ErrFriendNotFound) {
+		t.Fatalf("AddFriend() of a deactivated user error = %v, want %v", err, ErrFriendNotFound)
+	}
+	if err := friends.DeleteFriend(ctx, ids[0], 0); !errors.Is(err, ErrFriendNotFound) {
+		t.Fatalf("DeleteFriend() of an unknown user error = %v, want %v", err, ErrFriendNotFound)
+	}
+}
+
+func TestActivity(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := WithOrigin(context.Background(), "10.0.0.7", "curl/8.0")
+	userID := strconv.Itoa(ids[0])
+
+	user := NewUser(dbPool, config)
+	login := entity.User{CredentialType: "email", CredentialValue: "user1@example.com", Password: "wrong-password"}
+	if _, err := user.Login(ctx, login); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	login.Password = "password123"
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.UpdateAccount(ctx, userID, "budi", "https://example.com/budi.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	// the other user befriending user1 is theirs to see
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[1], ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewAccount(dbPool, config).Activity(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Meta.Total != 3 || len(got.Data) != 3 {
+		t.Fatalf("Activity() = %+v, want 3 entries", got)
+	}
+	update, failed := got.Data[0], got.Data[2]
+	if update.Action != entity.ActionAccountUpdate || update.IP == nil || *update.IP != "10.0.0.7" {
+		t.Fatalf("newest entry = %+v", update)
+	}
+	if before := update.Details["before"].(map[string]interface{}); before["name"] != "user1" {
+		t.Fatalf("account update before = %v", before)
+	}
+	if failed.Action != entity.ActionLoginFailed || failed.ActorID != nil || failed.Details["reason"] != "password" {
+		t.Fatalf("oldest entry = %+v", failed)
+	}
+
+	search, err := NewAdmin(dbPool, config).AuditLog(ctx, entity.Actor{}, entity.QueryAuditLog{Action: entity.ActionFriendAdd, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Data) != 1 || search.Data[0].TargetID != userID {
+		t.Fatalf("AuditLog() of friend additions = %+v", search.Data)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPost(dbPool, config)
+	own, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>halo</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := posts.Add(ctx, entity.Post{UserID: ids[1], PostInHtml: "<p>apa kabar</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.AddComment(ctx, theirs.Id, entity.CommentPerPost{Comment: "baik", Creator: entity.Creator{UserId: ids[0]}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.AddComment(ctx, own.Id, entity.CommentPerPost{Comment: "mantap", Creator: entity.Creator{UserId: ids[1]}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewAccount(dbPool, config).Export(ctx, strconv.Itoa(ids[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Account.Name != "user1" || got.Account.Email == nil || *got.Account.Email != "user1@example.com" {
+		t.Fatalf("exported account = %+v", got.Account)
+	}
+	if len(got.Posts) != 1 || got.Posts[0].Id != own.Id || got.Posts[0].PostInHtml != "<p>halo</p>" {
+		t.Fatalf("exported posts = %+v", got.Posts)
+	}
+	// only their own comments, wherever they wrote them
+	if len(got.Comments) != 1 || got.Comments[0].PostId != theirs.Id || got.Comments[0].Comment != "baik" {
+		t.Fatalf("exported comments = %+v", got.Comments)
+	}
+	if len(got.Friends) != 1 || got.Friends[0].UserId != ids[1] || got.Friends[0].Name != "user2" {
+		t.Fatalf("exported friends = %+v", got.Friends)
+	}
+
+	if _, err := NewAccount(dbPool, config).Export(ctx, "0"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Export() of an unknown user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 3)
+	ctx := context.Background()
+
+	friends := NewFriend(dbPool, config)
+	for _, friend := range ids[1:] {
+		if err := friends.AddFriend(ctx, ids[0], friend); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := friends.AddFriend(ctx, ids[1], ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := NewPost(dbPool, config)
+	post, err := posts.Add(ctx, entity.Post{UserID: ids[1], PostInHtml: "<p>apa kabar</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, author := range []int{ids[0], ids[2], ids[0]} {
+		if _, err := posts.AddComment(ctx, post.Id, entity.CommentPerPost{Comment: "baik", Creator: entity.Creator{UserId: author}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	account := NewAccount(dbPool, config)
+	userID := strconv.Itoa(ids[0])
+	if err := account.Delete(ctx, userID, "wrong-password"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("Delete() with a wrong password error = %v, want %v", err, ErrWrongPassword)
+	}
+	if err := account.Delete(ctx, userID, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewUser(dbPool, config).Session(ctx, userID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Session() of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	for _, friend := range ids[1:] {
+		var count int
+		if err := dbPool.QueryRow(ctx, `SELECT friend_count FROM friends_counter WHERE user_id = $1`, friend).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("user %d: friend_count = %d after the deletion, want 1", friend, count)
+		}
+	}
+
+	// the comments by others stay on the post
+	var authors []int
+	err = dbPool.QueryRow(ctx, `SELECT COALESCE(jsonb_agg((c->'creator'->>'userId')::int), '[]')
+		FROM posts, jsonb_array_elements(comments) c WHERE id = $1`, post.Id).Scan(&authors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 1 || authors[0] != ids[2] {
+		t.Fatalf("comment authors after the deletion = %v, want [%d]", authors, ids[2])
+	}
+}
+
+func TestDeleteLeavesOthersUploads(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
+
+	uploads := NewUpload(dbPool, config)
+	if err := uploads.Add(ctx, userID, "own.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Add(ctx, strconv.Itoa(ids[1]), "theirs.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket is public, any user can put another's image URL on their profile
+	const bucketURL = "https://sprint-bucket-public-read.s3.ap-southeast-1.amazonaws.com/"
+	user := NewUser(dbPool, config)
+	account := NewAccount(dbPool, config)
+	for key, want := range map[string]string{"theirs.jpg": "", "own.jpg": "own.jpg"} {
+		if _, err := user.UpdateAccount(ctx, userID, "user1", bucketURL+key); err != nil {
+			t.Fatal(err)
+		}
+		got, err := account.Export(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ImageKey != want {
+			t.Errorf("exported image key with %s as the profile image = %q, want %q", key, got.ImageKey, want)
+		}
+	}
+
+	if _, err := user.UpdateAccount(ctx, userID, "user1", bucketURL+"theirs.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := account.Delete(ctx, userID, "password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	var queued []string
+	err := dbPool.QueryRow(ctx, `SELECT COALESCE(array_agg(object_key ORDER BY object_key), '{}') FROM storage_deletions`).Scan(&queued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0] != "own.jpg" {
+		t.Fatalf("queued for deletion = %v, want only the erased user's own.jpg", queued)
+	}
+}
+
+func TestAuditAccountEvents(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := WithOrigin(context.Background(), "10.0.0.7", "curl/8.0")
+	userID := strconv.Itoa(ids[0])
+
+	user := NewUser(dbPool, config)
+	if _, err := user.ChangePassword(ctx, userID, "password123", "password456"); err != nil {
+		t.Fatal(err)
+	}
+	// only a verified credential resets the password, unverified again below so it can be released
+	if _, err := dbPool.Exec(ctx, `UPDATE users SET email_verified_at = now() WHERE id = $1`, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	reset, err := NewPasswordReset(dbPool, config).Issue(ctx, "email", "user1@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPasswordReset(dbPool, config).Reset(ctx, reset.Token, "password789"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.UpdatePhone(ctx, userID, "+6281234567890"); err != nil {
+		t.Fatal(err)
+	}
+
+	// user1's unverified email, stale and no longer its only credential, goes to user2
+	_, err = dbPool.Exec(ctx, `UPDATE users SET email_verified_at = NULL, email_linked_at = now() - make_interval(secs => $2) - interval '1 minute' WHERE id = $1`,
+		ids[0], config.VerificationGracePeriod.Seconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbPool.Exec(ctx, `UPDATE users SET email = NULL, phone = '+6289876543210' WHERE id = $1`, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.UpdateEmail(ctx, strconv.Itoa(ids[1]), "user1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewAccount(dbPool, config).Deactivate(ctx, userID, "password789"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewAccount(dbPool, config).Activity(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range got.Data {
+		actions = append(actions, e.Action)
+	}
+	want := []string{entity.ActionDeactivate, entity.ActionCredentialReleased, entity.ActionPhoneUpdate, entity.ActionPasswordReset, entity.ActionPasswordChange}
+	if len(actions) != len(want) {
+		t.Fatalf("activity = %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("activity = %v, want %v", actions, want)
+		}
+	}
+
+	// the account that lost its email sees it went, not who took it nor from where
+	released := got.Data[1]
+	if released.ActorID != nil || released.IP != nil {
+		t.Errorf("released entry names the claimant: %+v", released)
+	}
+	if before := released.Details["before"].(map[string]interface{}); before["email"] != "user1@example.com" {
+		t.Errorf("released before = %v", before)
+	}
+	if before := got.Data[2].Details["before"].(map[string]interface{}); before["phone"] != nil {
+		t.Errorf("phone update before = %v, want the old value, none", before)
+	}
+}
+
+func TestDeleteRedactsAuditLog(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
+
+	user := NewUser(dbPool, config)
+	own := WithOrigin(ctx, "10.0.0.7", "curl/8.0")
+	if _, err := user.UpdateAccount(own, userID, "budi", "https://example.com/budi.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFriend(dbPool, config).AddFriend(own, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	other := WithOrigin(ctx, "10.0.0.8", "firefox")
+	if err := NewFriend(dbPool, config).DeleteFriend(other, ids[1], ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewAccount(dbPool, config).Delete(own, userID, "password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := dbPool.Query(ctx, `SELECT action, actor_id, ip, user_agent, details FROM audit_log
+		WHERE actor_id = $1 OR (target_type = 'user' AND target_id = $2) ORDER BY id`, ids[0], userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var (
+			action    string
+			actorID   *int64
+			ip, agent *string
+			details   map[string]interface{}
+		)
+		if err := rows.Scan(&action, &actorID, &ip, &agent, &details); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, action)
+
+		switch action {
+		case entity.ActionAccountUpdate:
+			if ip != nil || agent != nil || details["redacted"] != true {
+				t.Errorf("own update after the deletion = %v %v %v", ip, agent, details)
+			}
+		case entity.ActionFriendAdd:
+			// about the friend, only where the deleted user connected from goes
+			if ip != nil || agent != nil || details["redacted"] == true {
+				t.Errorf("friend add after the deletion = %v %v %v", ip, agent, details)
+			}
+		case entity.ActionFriendDelete:
+			// the friend's own address stays
+			if ip == nil || *ip != "10.0.0.8" || details["redacted"] != true {
+				t.Errorf("friend's entry after the deletion = %v %v", ip, details)
+			}
+		case entity.ActionAccountDelete:
+			if actorID == nil || *actorID != int64(ids[0]) || ip != nil {
+				t.Errorf("delete entry = %v %v", actorID, ip)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 4 || actions[3] != entity.ActionAccountDelete {
+		t.Fatalf("entries after the deletion = %v", actions)
+	}
+
+	// outside an erasing transaction the log stays append-only
+	if _, err := dbPool.Exec(ctx, `UPDATE audit_log SET ip = NULL WHERE actor_id = $1`, ids[1]); err == nil {
+		t.Error("updating audit_log succeeded, it is append-only")
+	}
+}
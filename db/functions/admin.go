@@ -0,0 +1,481 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Admin is what moderators and admins do to other users' accounts and content. Every action
+// is written to audit_log, changes in the same transaction as the entry.
+type Admin struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+	cache  *feedCache
+}
+
+func NewAdmin(dbPool *pgxpool.Pool, config configs.Config) *Admin {
+	return &Admin{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// WithCache drops the feeds a suspension or a removed post or comment changes from c.
+func (a *Admin) WithCache(c cache.Cache) *Admin {
+	a.cache = newFeedCache(c, a.config.CacheTTL)
+	return a
+}
+
+// queryRower is a transaction or a pool.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+const adminUserColumns = `u.id, u.name, u.email, u.phone, u.image_url, u.role, COALESCE(fc.friend_count, 0),
+	account_status(u.status, u.suspended_until), u.suspended_at, u.suspended_until, u.suspension_reason, u.created_at`
+
+func scanAdminUser(row pgx.Row) (entity.AdminUser, error) {
+	var (
+		usr entity.AdminUser
+		id  int
+	)
+	err := row.Scan(&id, &usr.Name, &usr.Email, &usr.Phone, &usr.ImageUrl, &usr.Role, &usr.FriendCount,
+		&usr.Status, &usr.SuspendedAt, &usr.SuspendedUntil, &usr.SuspensionReason, &usr.CreatedAt)
+	usr.Id = strconv.Itoa(id)
+	return usr, err
+}
+
+func adminUser(ctx context.Context, db queryRower, userID string) (entity.AdminUser, error) {
+	usr, err := scanAdminUser(db.QueryRow(ctx, `SELECT `+adminUserColumns+` FROM users u
+		LEFT JOIN friends_counter fc ON fc.user_id = u.id WHERE u.id = $1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.AdminUser{}, ErrUserNotFound
+	}
+	return usr, err
+}
+
+// ListUsers searches users by name, email or phone, oldest first.
+func (a *Admin) ListUsers(ctx context.Context, actor entity.Actor, q entity.QueryAdminUsers) (entity.AdminUserData, error) {
+	var (
+		where = ` WHERE 1 = 1`
+		args  []interface{}
+	)
+
+	if q.Search != "" {
+		where += fmt.Sprintf(` AND (u.name ILIKE '%%' || $%[1]d || '%%' OR u.email ILIKE '%%' || $%[1]d || '%%' OR u.phone ILIKE '%%' || $%[1]d || '%%')`, len(args)+1)
+		args = append(args, q.Search)
+	}
+	if q.Role != "" {
+		where += fmt.Sprintf(` AND u.role = $%d`, len(args)+1)
+		args = append(args, q.Role)
+	}
+	if q.Suspended {
+		where += ` AND account_status(u.status, u.suspended_until) = 'suspended'`
+	}
+
+	result := entity.AdminUserData{
+		Data: []entity.AdminUser{},
+		Meta: entity.Meta{Limit: q.Limit, Offset: q.Offset},
+	}
+
+	err := a.dbPool.QueryRow(ctx, `SELECT count(*) FROM users u`+where, args...).Scan(&result.Meta.Total)
+	if err != nil {
+		return entity.AdminUserData{}, err
+	}
+
+	sql := `SELECT ` + adminUserColumns + ` FROM users u LEFT JOIN friends_counter fc ON fc.user_id = u.id` + where +
+		fmt.Sprintf(` ORDER BY u.id LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	rows, err := a.dbPool.Query(ctx, sql, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return entity.AdminUserData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usr, err := scanAdminUser(rows)
+		if err != nil {
+			return entity.AdminUserData{}, err
+		}
+		result.Data = append(result.Data, usr)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.AdminUserData{}, err
+	}
+
+	err = audit(ctx, a.dbPool, actor, entity.ActionUserSearch, "user", "", map[string]interface{}{
+		"search":    q.Search,
+		"role":      q.Role,
+		"suspended": q.Suspended,
+	})
+	if err != nil {
+		return entity.AdminUserData{}, err
+	}
+
+	return result, nil
+}
+
+// AuditLog searches the audit log, newest first. The search is itself audited.
+func (a *Admin) AuditLog(ctx context.Context, actor entity.Actor, q entity.QueryAuditLog) (entity.AuditLogData, error) {
+	var (
+		where = ` WHERE 1 = 1`
+		args  []interface{}
+	)
+
+	if q.ActorID != "" {
+		id, err := strconv.ParseInt(q.ActorID, 10, 64)
+		if err != nil {
+			return entity.AuditLogData{Data: []entity.AuditEntry{}, Meta: entity.Meta{Limit: q.Limit, Offset: q.Offset}}, nil
+		}
+		where += fmt.Sprintf(` AND actor_id = $%d`, len(args)+1)
+		args = append(args, id)
+	}
+	if q.Action != "" {
+		where += fmt.Sprintf(` AND action = $%d`, len(args)+1)
+		args = append(args, q.Action)
+	}
+	if q.TargetType != "" {
+		where += fmt.Sprintf(` AND target_type = $%d`, len(args)+1)
+		args = append(args, q.TargetType)
+	}
+	if q.TargetID != "" {
+		where += fmt.Sprintf(` AND target_id = $%d`, len(args)+1)
+		args = append(args, q.TargetID)
+	}
+	if q.Since != nil {
+		where += fmt.Sprintf(` AND created_at >= $%d`, len(args)+1)
+		args = append(args, *q.Since)
+	}
+	if q.Until != nil {
+		where += fmt.Sprintf(` AND created_at < $%d`, len(args)+1)
+		args = append(args, *q.Until)
+	}
+
+	result, err := auditLog(ctx, a.dbPool, where, args, q.Limit, q.Offset)
+	if err != nil {
+		return entity.AuditLogData{}, err
+	}
+
+	err = audit(ctx, a.dbPool, actor, entity.ActionAuditSearch, "audit_log", "", map[string]interface{}{
+		"actorId":    q.ActorID,
+		"action":     q.Action,
+		"targetType": q.TargetType,
+		"targetId":   q.TargetID,
+	})
+	if err != nil {
+		return entity.AuditLogData{}, err
+	}
+
+	return result, nil
+}
+
+// UserByCredential finds the user holding value as their email or phone.
+func (a *Admin) UserByCredential(ctx context.Context, value string) (entity.AdminUser, error) {
+	usr, err := scanAdminUser(a.dbPool.QueryRow(ctx, `SELECT `+adminUserColumns+` FROM users u
+		LEFT JOIN friends_counter fc ON fc.user_id = u.id WHERE u.email = $1 OR u.phone = $1`, value))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.AdminUser{}, ErrUserNotFound
+	}
+	return usr, err
+}
+
+// target locks the user an action is taken on and checks the actor may take it. Nobody acts on
+// their own account and only admins act on moderators and admins.
+func target(ctx context.Context, tx pgx.Tx, actor entity.Actor, userID string) (entity.AdminUser, error) {
+	if actor.UserID != "" && actor.UserID == userID {
+		return entity.AdminUser{}, ErrCannotModerateSelf
+	}
+
+	var locked int
+	err := tx.QueryRow(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.AdminUser{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	usr, err := adminUser(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	// the command line has no user and no limits
+	if actor.UserID != "" && usr.Role != entity.RoleUser && actor.Role != entity.RoleAdmin {
+		return entity.AdminUser{}, ErrInsufficientRole
+	}
+	return usr, nil
+}
+
+// Suspend keeps the user from logging in until until, or until they are unsuspended when it is
+// nil, and signs out their sessions.
+func (a *Admin) Suspend(ctx context.Context, actor entity.Actor, userID string, until *time.Time, reason string) (entity.AdminUser, error) {
+	tx, err := a.dbPool.Begin(ctx)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := target(ctx, tx, actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	if err := suspend(ctx, tx, actor, before, until, reason); err != nil {
+		return entity.AdminUser{}, err
+	}
+	stale, err := a.audience(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	usr, err := adminUser(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	a.cache.invalidateFeeds(ctx, a.dbPool, stale...)
+	return usr, nil
+}
+
+// audience is what the cache shows of userID, see feedCache.audience.
+func (a *Admin) audience(ctx context.Context, tx pgx.Tx, userID string) ([]int, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return a.cache.audience(ctx, tx, id)
+}
+
+// suspend suspends usr, locked by target, in tx.
+func suspend(ctx context.Context, tx pgx.Tx, actor entity.Actor, usr entity.AdminUser, until *time.Time, reason string) error {
+	_, err := tx.Exec(ctx, `UPDATE users SET status = 'suspended', suspended_at = now(), suspended_until = $1, suspension_reason = $2,
+		token_version = token_version + 1 WHERE id = $3`, until, reason, usr.Id)
+	if err != nil {
+		return err
+	}
+
+	return audit(ctx, tx, actor, entity.ActionUserSuspend, "user", usr.Id, map[string]interface{}{
+		"until":         until,
+		"reason":        reason,
+		"previousUntil": usr.SuspendedUntil,
+	})
+}
+
+// Unsuspend lets a suspended user log in again, other accounts keep their status.
+func (a *Admin) Unsuspend(ctx context.Context, actor entity.Actor, userID string) (entity.AdminUser, error) {
+	tx, err := a.dbPool.Begin(ctx)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := target(ctx, tx, actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET status = 'active', suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL
+		WHERE id = $1 AND status = 'suspended'`, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	err = audit(ctx, tx, actor, entity.ActionUserUnsuspend, "user", userID, map[string]interface{}{
+		"suspendedAt":    before.SuspendedAt,
+		"suspendedUntil": before.SuspendedUntil,
+		"reason":         before.SuspensionReason,
+	})
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	stale, err := a.audience(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	usr, err := adminUser(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	a.cache.invalidateFeeds(ctx, a.dbPool, stale...)
+	return usr, nil
+}
+
+// SetRole changes the role of a user. Their tokens carry the old role, so they are signed out.
+func (a *Admin) SetRole(ctx context.Context, actor entity.Actor, userID, role string) (entity.AdminUser, error) {
+	if role != entity.RoleUser && role != entity.RoleModerator && role != entity.RoleAdmin {
+		return entity.AdminUser{}, ErrInvalidRole
+	}
+	if actor.UserID != "" && actor.Role != entity.RoleAdmin {
+		return entity.AdminUser{}, ErrInsufficientRole
+	}
+
+	tx, err := a.dbPool.Begin(ctx)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := target(ctx, tx, actor, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET role = $1, token_version = token_version + 1 WHERE id = $2`, role, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	err = audit(ctx, tx, actor, entity.ActionUserRole, "user", userID, map[string]interface{}{
+		"from": before.Role,
+		"to":   role,
+	})
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+
+	usr, err := adminUser(ctx, tx, userID)
+	if err != nil {
+		return entity.AdminUser{}, err
+	}
+	return usr, tx.Commit(ctx)
+}
+
+// GetPost returns any post with its creator and comments, whoever's friend wrote it and hidden
+// or not.
+func (a *Admin) GetPost(ctx context.Context, actor entity.Actor, postID int) (entity.Post, error) {
+	var post entity.Post
+	err := a.dbPool.QueryRow(ctx, `SELECT p.id, p.post_in_html, p.tags, p.user_id, p.created_at, p.comments,
+		p.hidden_at IS NOT NULL, u.name, u.image_url, COALESCE(fc.friend_count, 0)
+		FROM posts p JOIN users u ON u.id = p.user_id LEFT JOIN friends_counter fc ON fc.user_id = p.user_id
+		WHERE p.id = $1`, postID,
+	).Scan(&post.Id, &post.PostInHtml, &post.Tags, &post.UserID, &post.CreatedAt, &post.Comments,
+		&post.Hidden, &post.Creator.Name, &post.Creator.ImageUrl, &post.Creator.FriendCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return entity.Post{}, err
+	}
+	post.Creator.UserId = post.UserID
+
+	err = audit(ctx, a.dbPool, actor, entity.ActionPostView, "post", strconv.Itoa(postID), nil)
+	if err != nil {
+		return entity.Post{}, err
+	}
+	return post, nil
+}
+
+// DeletePost removes a post and its comments, the audit entry keeps what it said.
+func (a *Admin) DeletePost(ctx context.Context, actor entity.Actor, postID int, reason string) error {
+	tx, err := a.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		authorID int
+		html     string
+		tags     []string
+	)
+	err = tx.QueryRow(ctx, `DELETE FROM posts WHERE id = $1 RETURNING user_id, post_in_html, tags`, postID).Scan(&authorID, &html, &tags)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, actor, entity.ActionPostDelete, "post", strconv.Itoa(postID), map[string]interface{}{
+		"authorId":   authorID,
+		"postInHtml": html,
+		"tags":       tags,
+		"reason":     reason,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	a.cache.invalidateFeeds(ctx, a.dbPool, authorID)
+	return nil
+}
+
+// DeleteComment removes one comment from a post, the audit entry keeps what it said.
+func (a *Admin) DeleteComment(ctx context.Context, actor entity.Actor, postID int, commentID int64, reason string) error {
+	tx, err := a.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		authorID int
+		comments []entity.CommentPerPost
+	)
+	err = tx.QueryRow(ctx, `SELECT user_id, comments FROM posts WHERE id = $1 FOR UPDATE`, postID).Scan(&authorID, &comments)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var (
+		removed *entity.CommentPerPost
+		kept    = make([]entity.CommentPerPost, 0, len(comments))
+	)
+	for i, c := range comments {
+		if c.Id == commentID && removed == nil {
+			removed = &comments[i]
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if removed == nil {
+		return ErrCommentNotFound
+	}
+
+	keptJSON, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE posts SET comments = $1 WHERE id = $2`, keptJSON, postID); err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, actor, entity.ActionCommentDelete, "comment", strconv.FormatInt(commentID, 10), map[string]interface{}{
+		"postId":   postID,
+		"authorId": removed.Creator.UserId,
+		"comment":  removed.Comment,
+		"reason":   reason,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	a.cache.invalidateFeeds(ctx, a.dbPool, authorID)
+	return nil
+}
@@ -0,0 +1,195 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAdminSuspend(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 3)
+	admin := NewAdmin(dbPool, config)
+	ctx := context.Background()
+
+	mod := entity.Actor{UserID: strconv.Itoa(ids[0]), Role: entity.RoleModerator, IP: "10.0.0.1"}
+	if _, err := admin.SetRole(ctx, entity.Actor{}, mod.UserID, entity.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.SetRole(ctx, entity.Actor{}, strconv.Itoa(ids[2]), entity.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name    string
+		userID  int
+		until   *time.Time
+		wantErr error
+	}{
+		{"self", ids[0], nil, ErrCannotModerateSelf},
+		{"admin", ids[2], nil, ErrInsufficientRole},
+		{"unknown", ids[2] + 1000, nil, ErrUserNotFound},
+		{"until", ids[1], &future, nil},
+		{"indefinitely", ids[1], nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usr, err := admin.Suspend(ctx, mod, strconv.Itoa(tt.userID), tt.until, "spam")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Suspend() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (usr.SuspendedAt == nil || (usr.SuspendedUntil == nil) != (tt.until == nil)) {
+				t.Fatalf("Suspend() = %+v", usr)
+			}
+		})
+	}
+
+	user := NewUser(dbPool, config)
+	login := entity.User{CredentialType: "email", CredentialValue: "user2@example.com", Password: "password123"}
+	var suspended *SuspendedError
+	if _, err := user.Login(ctx, login); !errors.As(err, &suspended) || suspended.Until != nil {
+		t.Fatalf("Login() of a suspended user error = %v, want an indefinite %v", err, ErrAccountSuspended)
+	}
+	session, err := user.Session(ctx, strconv.Itoa(ids[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != entity.StatusSuspended {
+		t.Fatalf("Session() of a suspended user = %+v", session)
+	}
+
+	if _, err := admin.Unsuspend(ctx, mod, strconv.Itoa(ids[1])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatalf("Login() after unsuspend error = %v", err)
+	}
+
+	// a suspension past its end is over without anyone lifting it
+	if _, err := dbPool.Exec(ctx, `UPDATE users SET status = 'suspended', suspended_until = now() - interval '1 minute' WHERE id = $1`, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if session, err := user.Session(ctx, strconv.Itoa(ids[1])); err != nil || session.Status != entity.StatusActive {
+		t.Fatalf("Session() after the suspension ended = %+v, %v", session, err)
+	}
+
+	// only the successful actions are audited
+	var entries int
+	err = dbPool.QueryRow(ctx, `SELECT count(*) FROM audit_log WHERE actor_id = $1 AND ip = '10.0.0.1'`, ids[0]).Scan(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 3 {
+		t.Errorf("%d audit entries by the moderator, want 3", entries)
+	}
+
+	if _, err := dbPool.Exec(ctx, `DELETE FROM audit_log`); err == nil {
+		t.Error("deleting from audit_log succeeded, it is append-only")
+	}
+}
+
+func TestSuspendedDropOutOfFeeds(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPost(dbPool, config)
+	own, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>halo</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.Add(ctx, entity.Post{UserID: ids[1], PostInHtml: "<p>promo</p>", Tags: []string{"promo"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.AddComment(ctx, own.Id, entity.CommentPerPost{Comment: "beli dong", Creator: entity.Creator{UserId: ids[1]}}); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := func() ([]entity.Post, int) {
+		t.Helper()
+		query := entity.QueryGetPosts{UserId: ids[0], Limit: 10}
+		got, err := posts.Get(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := posts.Count(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got, count
+	}
+
+	if _, err := NewAdmin(dbPool, config).Suspend(ctx, entity.Actor{}, strconv.Itoa(ids[1]), nil, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	got, count := feed()
+	if len(got) != 1 || count != 1 || got[0].Id != own.Id || len(got[0].Comments) != 0 {
+		t.Fatalf("feed with a suspended friend = %+v, count %d", got, count)
+	}
+
+	if _, err := NewAdmin(dbPool, config).Unsuspend(ctx, entity.Actor{}, strconv.Itoa(ids[1])); err != nil {
+		t.Fatal(err)
+	}
+	got, count = feed()
+	if len(got) != 2 || count != 2 || len(got[1].Comments) != 1 {
+		t.Fatalf("feed after reinstating = %+v, count %d", got, count)
+	}
+}
+
+func TestAdminDeleteComment(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 3)
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPost(dbPool, config)
+	post, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>halo</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var comments []entity.CommentPerPost
+	for _, text := range []string{"pertama", "kedua", "ketiga"} {
+		c, err := posts.AddComment(ctx, post.Id, entity.CommentPerPost{Comment: text, Creator: entity.Creator{UserId: ids[1]}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		comments = append(comments, c)
+	}
+
+	admin := NewAdmin(dbPool, config)
+	mod := entity.Actor{UserID: strconv.Itoa(ids[2]), Role: entity.RoleModerator}
+
+	if err := admin.DeleteComment(ctx, mod, post.Id, comments[1].Id, "rude"); err != nil {
+		t.Fatalf("DeleteComment() error = %v", err)
+	}
+	if err := admin.DeleteComment(ctx, mod, post.Id, comments[1].Id, "rude"); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("DeleteComment() twice error = %v, want %v", err, ErrCommentNotFound)
+	}
+
+	got, err := admin.GetPost(ctx, mod, post.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Comments) != 2 || got.Comments[0].Id != comments[0].Id || got.Comments[1].Id != comments[2].Id {
+		t.Fatalf("comments after delete = %+v", got.Comments)
+	}
+
+	if err := admin.DeletePost(ctx, mod, post.Id, "spam"); err != nil {
+		t.Fatalf("DeletePost() error = %v", err)
+	}
+	if _, err := admin.GetPost(ctx, mod, post.Id); !errors.Is(err, ErrPostNotFound) {
+		t.Fatalf("GetPost() of a deleted post error = %v, want %v", err, ErrPostNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"segokuning/db/entity"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// execer is a transaction or a connection, audit entries are written in the transaction of the
+// change they record.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+type originKey struct{}
+
+type origin struct {
+	ip        string
+	userAgent string
+}
+
+// WithOrigin returns ctx carrying where the request came from, the account events it leads to
+// are audited with it.
+func WithOrigin(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin{ip: ip, userAgent: userAgent})
+}
+
+// OriginActor is userID acting from where WithOrigin says, an empty userID is someone not logged in.
+func OriginActor(ctx context.Context, userID string) entity.Actor {
+	o, _ := ctx.Value(originKey{}).(origin)
+	return entity.Actor{UserID: userID, IP: o.ip, UserAgent: o.userAgent}
+}
+
+// actorID is the user id of actor, nil for the command line.
+func actorID(actor entity.Actor) *int64 {
+	if id, err := strconv.ParseInt(actor.UserID, 10, 64); err == nil {
+		return &id
+	}
+	return nil
+}
+
+// audit appends an entry to audit_log.
+func audit(ctx context.Context, db execer, actor entity.Actor, action, targetType, targetID string, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `INSERT INTO audit_log (actor_id, action, target_type, target_id, ip, user_agent, details)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)`,
+		actorID(actor), action, targetType, targetID, actor.IP, actor.UserAgent, detailsJSON)
+	return err
+}
+
+// change is the details of an audited update, the values before and after it.
+func change(before, after map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"before": before, "after": after}
+}
+
+// auditLog lists the entries matching where, newest first.
+func auditLog(ctx context.Context, dbPool *pgxpool.Pool, where string, args []interface{}, limit, offset int) (entity.AuditLogData, error) {
+	result := entity.AuditLogData{
+		Data: []entity.AuditEntry{},
+		Meta: entity.Meta{Limit: limit, Offset: offset},
+	}
+
+	err := dbPool.QueryRow(ctx, `SELECT count(*) FROM audit_log`+where, args...).Scan(&result.Meta.Total)
+	if err != nil {
+		return entity.AuditLogData{}, err
+	}
+
+	sql := `SELECT id, actor_id, action, target_type, target_id, ip, user_agent, details, created_at FROM audit_log` + where +
+		fmt.Sprintf(` ORDER BY id DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	rows, err := dbPool.Query(ctx, sql, append(args, limit, offset)...)
+	if err != nil {
+		return entity.AuditLogData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e entity.AuditEntry
+		err := rows.Scan(&e.Id, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.IP, &e.UserAgent, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return entity.AuditLogData{}, err
+		}
+		result.Data = append(result.Data, e)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.AuditLogData{}, err
+	}
+
+	return result, nil
+}
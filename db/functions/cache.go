@@ -0,0 +1,224 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"segokuning/internal/logging"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// feedCache keeps what GET /v1/post is built from, under these keys:
+//
+//	creator:<userId>    the entity.Creator of a user, put on the comments they add
+//	friends:<userId>    the ids of the user's friends
+//	feed:<userId>       the first page of the user's feed without search or tags
+//	feedcount:<userId>  how many posts that feed has
+//
+// The writes that change them delete them after they commit, the ttl bounds what they miss. A nil
+// feedCache caches nothing and a failing cache falls back to the database.
+type feedCache struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// cachedFeed is a first page, it serves any limit up to the one it was queried with.
+type cachedFeed struct {
+	Limit int           `json:"limit"`
+	Posts []entity.Post `json:"posts"`
+}
+
+func newFeedCache(c cache.Cache, ttl time.Duration) *feedCache {
+	if c == nil {
+		return nil
+	}
+	return &feedCache{cache: c, ttl: ttl}
+}
+
+func (c *feedCache) get(ctx context.Context, key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	data, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed read cache", "key", key, "error", err)
+		return false
+	}
+	return ok && json.Unmarshal(data, v) == nil
+}
+
+func (c *feedCache) set(ctx context.Context, key string, v interface{}) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = c.cache.Set(ctx, key, data, c.ttl)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed write cache", "key", key, "error", err)
+	}
+}
+
+func (c *feedCache) delete(ctx context.Context, keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	if err := c.cache.Delete(ctx, keys...); err != nil {
+		logging.FromContext(ctx).Warn("failed invalidate cache", "keys", keys, "error", err)
+	}
+}
+
+// cacheable tells whether query asks for the plain feed, searches aren't cached.
+func cacheable(query entity.QueryGetPosts) bool {
+	return query.Search == "" && len(query.SearchTags) == 0
+}
+
+// feed returns the cached page query asks for, only the first page is cached.
+func (c *feedCache) feed(ctx context.Context, query entity.QueryGetPosts) ([]entity.Post, bool) {
+	if !cacheable(query) || query.Offset != 0 {
+		return nil, false
+	}
+	var page cachedFeed
+	if !c.get(ctx, fmt.Sprintf("feed:%d", query.UserId), &page) || page.Limit < query.Limit {
+		return nil, false
+	}
+	if len(page.Posts) > query.Limit {
+		page.Posts = page.Posts[:query.Limit]
+	}
+	return page.Posts, true
+}
+
+func (c *feedCache) setFeed(ctx context.Context, query entity.QueryGetPosts, posts []entity.Post) {
+	if cacheable(query) && query.Offset == 0 {
+		c.set(ctx, fmt.Sprintf("feed:%d", query.UserId), cachedFeed{Limit: query.Limit, Posts: posts})
+	}
+}
+
+func (c *feedCache) count(ctx context.Context, query entity.QueryGetPosts) (int, bool) {
+	var count int
+	return count, cacheable(query) && c.get(ctx, fmt.Sprintf("feedcount:%d", query.UserId), &count)
+}
+
+func (c *feedCache) setCount(ctx context.Context, query entity.QueryGetPosts, count int) {
+	if cacheable(query) {
+		c.set(ctx, fmt.Sprintf("feedcount:%d", query.UserId), count)
+	}
+}
+
+// creator returns the cached creator of userID, loading it on a miss.
+func (c *feedCache) creator(ctx context.Context, userID int, load func() (entity.Creator, error)) (entity.Creator, error) {
+	key := fmt.Sprintf("creator:%d", userID)
+	var creator entity.Creator
+	if c.get(ctx, key, &creator) {
+		return creator, nil
+	}
+	creator, err := load()
+	if err != nil {
+		return entity.Creator{}, err
+	}
+	c.set(ctx, key, creator)
+	return creator, nil
+}
+
+// friendIDs returns the ids of userID's friends, cached or read from dbPool.
+func (c *feedCache) friendIDs(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]int, error) {
+	key := fmt.Sprintf("friends:%d", userID)
+	ids := []int{}
+	if c.get(ctx, key, &ids) {
+		return ids, nil
+	}
+
+	rows, err := dbPool.Query(ctx, `SELECT friend_id FROM friends WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	c.set(ctx, key, ids)
+	return ids, nil
+}
+
+// invalidateFeeds drops the cached feeds of userIDs and of their friends, the ones a post or
+// profile of userIDs shows up in.
+func (c *feedCache) invalidateFeeds(ctx context.Context, dbPool *pgxpool.Pool, userIDs ...int) {
+	if c == nil {
+		return
+	}
+
+	seen := map[int]bool{}
+	var keys []string
+	drop := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			keys = append(keys, fmt.Sprintf("feed:%d", id), fmt.Sprintf("feedcount:%d", id))
+		}
+	}
+	for _, userID := range userIDs {
+		drop(userID)
+		friends, err := c.friendIDs(ctx, dbPool, userID)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed list friends to invalidate feeds", "user_id", userID, "error", err)
+			continue
+		}
+		for _, id := range friends {
+			drop(id)
+		}
+	}
+	c.delete(ctx, keys...)
+}
+
+// querier is a transaction or a pool.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// audience returns userID and the authors of the posts userID commented on. Their feeds and their
+// friends' show what userID wrote, invalidateFeeds of them drops every feed a user leaving them is in.
+// Without a cache there is nothing to drop and it returns nil.
+func (c *feedCache) audience(ctx context.Context, db querier, userID int) ([]int, error) {
+	if c == nil {
+		return nil, nil
+	}
+	rows, err := db.Query(ctx, `SELECT DISTINCT user_id FROM posts
+		WHERE comments @> jsonb_build_array(jsonb_build_object('creator', jsonb_build_object('userId', $1::bigint)))`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{userID}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// invalidateUser drops the cached profile and friend ids of userIDs.
+func (c *feedCache) invalidateUser(ctx context.Context, userIDs ...int) {
+	var keys []string
+	for _, id := range userIDs {
+		keys = append(keys, fmt.Sprintf("creator:%d", id), fmt.Sprintf("friends:%d", id))
+	}
+	c.delete(ctx, keys...)
+}
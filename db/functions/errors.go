@@ -1,6 +1,11 @@
 package functions
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
 	ErrNoRow                = errors.New("data not found")
@@ -8,3 +13,117 @@ var (
 	ErrUnauthorized         = errors.New("unauthorized")
 	ErrProductNameDuplicate = errors.New("product name already exists")
 )
+
+// Error is a domain error carrying a stable, machine-readable code.
+// Callers compare against the sentinels below with errors.Is.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// sentinels holds every Error newError made, in declaration order.
+var sentinels []*Error
+
+func newError(code, message string) *Error {
+	e := &Error{Code: code, Message: message}
+	sentinels = append(sentinels, e)
+	return e
+}
+
+// Errors returns every sentinel so callers mapping them can check none is left out.
+func Errors() []*Error {
+	return append([]*Error(nil), sentinels...)
+}
+
+// user errors
+var (
+	ErrExistingUsername = newError("EXISTING_USERNAME", "credential is already registered")
+	ErrUserNotFound     = newError("USER_NOT_FOUND", "user not found")
+	// unknown credential and wrong password share one error so accounts can't be enumerated
+	ErrInvalidCredentials = newError("INVALID_CREDENTIALS", "invalid credential or password")
+	ErrAccountLocked      = newError("ACCOUNT_LOCKED", "too many failed logins, try again later")
+	ErrEmailExists        = newError("EMAIL_EXISTS", "email is already used by another user")
+	ErrEmailAlreadySet    = newError("EMAIL_ALREADY_SET", "user already has an email")
+	ErrPhoneExists        = newError("PHONE_EXISTS", "phone is already used by another user")
+	ErrPhoneAlreadySet    = newError("PHONE_ALREADY_SET", "user already has a phone")
+	ErrWrongPassword      = newError("WRONG_PASSWORD", "current password is incorrect")
+	ErrAccountSuspended   = newError("ACCOUNT_SUSPENDED", "account is suspended")
+)
+
+// SuspendedError is ErrAccountSuspended telling when the suspension ends, a nil Until never does.
+type SuspendedError struct {
+	Until *time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	return ErrAccountSuspended.Error()
+}
+
+func (e *SuspendedError) Unwrap() error {
+	return ErrAccountSuspended
+}
+
+// Details is served with the error so the client can tell the user.
+func (e *SuspendedError) Details() interface{} {
+	return map[string]interface{}{"until": e.Until}
+}
+
+// admin errors
+var (
+	ErrInvalidRole        = newError("INVALID_ROLE", "role must be user, moderator or admin")
+	ErrCannotModerateSelf = newError("CANNOT_MODERATE_SELF", "cannot take this action on your own account")
+	ErrInsufficientRole   = newError("INSUFFICIENT_ROLE", "only admins can take this action")
+)
+
+// password reset errors
+var (
+	// unknown, used and expired tokens share one error so tokens can't be probed
+	ErrInvalidResetToken = newError("INVALID_RESET_TOKEN", "reset token is invalid or expired")
+)
+
+// verification errors
+var (
+	ErrInvalidCredentialType = newError("INVALID_CREDENTIAL_TYPE", "credential type must be email or phone")
+	ErrCredentialNotSet      = newError("CREDENTIAL_NOT_SET", "user has no credential of this type")
+	ErrAlreadyVerified       = newError("ALREADY_VERIFIED", "credential is already verified")
+	ErrCredentialNotVerified = newError("CREDENTIAL_NOT_VERIFIED", "credential must be verified before it can be used to login")
+	ErrInvalidCode           = newError("INVALID_CODE", "verification code is invalid")
+	ErrCodeExpired           = newError("CODE_EXPIRED", "verification code has expired, request a new one")
+	ErrTooManyAttempts       = newError("TOO_MANY_ATTEMPTS", "too many wrong codes, request a new one")
+)
+
+// friend errors
+var (
+	ErrNoAddSelf           = newError("NO_ADD_SELF", "cannot add self as friend")
+	ErrFriendNotFound      = newError("FRIEND_NOT_FOUND", "friend not found")
+	ErrFriendshipExists    = newError("FRIENDSHIP_EXISTS", "already friends with this user")
+	ErrFriendshipNotExists = newError("FRIENDSHIP_NOT_EXISTS", "not friends with this user")
+)
+
+// post errors
+var (
+	ErrPostNotFound    = newError("POST_NOT_FOUND", "post not found")
+	ErrNotFriendsPost  = newError("NOT_FRIENDS_POST", "you can only comment on your friend's post")
+	ErrCommentNotFound = newError("COMMENT_NOT_FOUND", "comment not found")
+)
+
+// report errors
+var (
+	ErrInvalidReportTarget = newError("INVALID_REPORT_TARGET", "target type must be post, comment or user")
+	ErrCannotReportSelf    = newError("CANNOT_REPORT_SELF", "cannot report your own account or content")
+	ErrAlreadyReported     = newError("ALREADY_REPORTED", "you already reported this, it is waiting for review")
+	ErrReportNotFound      = newError("REPORT_NOT_FOUND", "report not found")
+	ErrReportResolved      = newError("REPORT_RESOLVED", "report is already resolved")
+	ErrInvalidResolution   = newError("INVALID_RESOLUTION", "a reported user can be dismissed or suspended, not hidden")
+)
+
+// isUniqueViolation reports whether postgres refused a duplicate key, what a check-then-insert
+// racing another one runs into.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -6,23 +6,50 @@ import (
 	"fmt"
 	"segokuning/configs"
 	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"strconv"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Friend struct {
-	Config configs.Config
-	DBPool *pgxpool.Pool
+	Config   configs.Config
+	DBPool   *pgxpool.Pool
+	ReadPool *pgxpool.Pool
+
+	cache *feedCache
 }
 
 func NewFriend(dbPool *pgxpool.Pool, config configs.Config) *Friend {
 	return &Friend{
-		DBPool: dbPool,
-		Config: config,
+		DBPool:   dbPool,
+		ReadPool: dbPool,
+		Config:   config,
 	}
 }
 
+// WithReplica sends the friend listing queries to readPool, a nil pool keeps them on the primary.
+func (f *Friend) WithReplica(readPool *pgxpool.Pool) *Friend {
+	if readPool != nil {
+		f.ReadPool = readPool
+	}
+	return f
+}
+
+// WithCache drops the friend ids, creators and feeds a friendship change makes stale from c.
+func (f *Friend) WithCache(c cache.Cache) *Friend {
+	f.cache = newFeedCache(c, f.Config.CacheTTL)
+	return f
+}
+
+// invalidate drops what showed the friendship of userID and friendID, their feeds and the feeds
+// their friend count shows up in.
+func (f *Friend) invalidate(ctx context.Context, userID, friendID int) {
+	f.cache.invalidateUser(ctx, userID, friendID)
+	f.cache.invalidateFeeds(ctx, f.DBPool, userID, friendID)
+}
+
 func (f *Friend) IsFriend(ctx context.Context, userID, friendID int) (bool, error) {
 	conn, err := f.DBPool.Acquire(ctx)
 	if err != nil {
@@ -64,8 +91,22 @@ func (f *Friend) GetByID(ctx context.Context, friendID int) (entity.Friend, erro
 	return friend, nil
 }
 
+func (f *Friend) userExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := f.DBPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+	return exists, err
+}
+
+// befriendable tells whether a user can be befriended, deactivated users are hidden until they're
+// back. They can still be unfriended.
+func (f *Friend) befriendable(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := f.DBPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND status <> 'deactivated')`, userID).Scan(&exists)
+	return exists, err
+}
+
 func (f *Friend) Get(ctx context.Context, q entity.QueryGetFriends) (entity.FriendData, error) {
-	conn, err := f.DBPool.Acquire(ctx)
+	conn, err := f.ReadPool.Acquire(ctx)
 	if err != nil {
 		return entity.FriendData{}, err
 	}
@@ -74,7 +115,7 @@ func (f *Friend) Get(ctx context.Context, q entity.QueryGetFriends) (entity.Frie
 	var (
 		sql = `SELECT fs.friend_id AS id, fs.user_id AS userId, u.name, u.image_url, u.created_at FROM friends fs 
                       LEFT JOIN users u ON fs.friend_id = u.id 
-                      WHERE 1 = 1`
+                      WHERE u.status <> 'deactivated'`
 		args []interface{}
 	)
 
@@ -84,7 +125,7 @@ func (f *Friend) Get(ctx context.Context, q entity.QueryGetFriends) (entity.Frie
 	}
 
 	if q.Search != "" {
-		sql += fmt.Sprintf(" AND (u.name ILIKE '%' || $%d || '%' OR u.image_url ILIKE '%' || $%d || '%')", len(args)+1)
+		sql += fmt.Sprintf(" AND (u.name ILIKE '%%' || $%[1]d || '%%' OR u.image_url ILIKE '%%' || $%[1]d || '%%')", len(args)+1)
 		args = append(args, q.Search)
 	}
 
@@ -139,7 +180,7 @@ func (f *Friend) Get(ctx context.Context, q entity.QueryGetFriends) (entity.Frie
 }
 
 func (f *Friend) GetTotal(ctx context.Context, userID int, onlyFriend bool, search string) (int, error) {
-	conn, err := f.DBPool.Acquire(ctx)
+	conn, err := f.ReadPool.Acquire(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -148,7 +189,7 @@ func (f *Friend) GetTotal(ctx context.Context, userID int, onlyFriend bool, sear
 	var (
 		sql = `SELECT count(fs.id) FROM friends fs 
                       LEFT JOIN users u ON fs.friend_id = u.id 
-                      WHERE 1 = 1`
+                      WHERE u.status <> 'deactivated'`
 		total int
 		args  []interface{}
 	)
@@ -159,7 +200,7 @@ func (f *Friend) GetTotal(ctx context.Context, userID int, onlyFriend bool, sear
 	}
 
 	if search != "" {
-		sql += fmt.Sprintf(" AND (u.name ILIKE '%' || $%d || '%' OR u.image_url ILIKE '%' || $%d || '%')", len(args)+1)
+		sql += fmt.Sprintf(" AND (u.name ILIKE '%%' || $%[1]d || '%%' OR u.image_url ILIKE '%%' || $%[1]d || '%%')", len(args)+1)
 		args = append(args, search)
 	}
 
@@ -179,16 +220,15 @@ func (f *Friend) AddFriend(ctx context.Context, userID, friendID int) error {
 	defer conn.Release()
 
 	if userID == friendID {
-		return errors.New("NO_ADD_SELF")
+		return ErrNoAddSelf
 	}
 
-	getFriend, err := f.GetByID(ctx, friendID)
+	exists, err := f.befriendable(ctx, friendID)
 	if err != nil {
 		return err
 	}
-
-	if getFriend.ID == 0 {
-		return errors.New("FRIEND_NOT_FOUND")
+	if !exists {
+		return ErrFriendNotFound
 	}
 
 	// Check if the friendship already exists
@@ -197,7 +237,7 @@ func (f *Friend) AddFriend(ctx context.Context, userID, friendID int) error {
 		return err
 	}
 	if isFriend {
-		return errors.New("FRIENDSHIP_EXISTS")
+		return ErrFriendshipExists
 	}
 
 	tx, err := conn.Begin(ctx)
@@ -207,8 +247,17 @@ func (f *Friend) AddFriend(ctx context.Context, userID, friendID int) error {
 	}
 	defer tx.Rollback(ctx)
 
+	if timelineMode(f.Config) {
+		if err := lockTimelineUsers(ctx, tx, "FOR NO KEY UPDATE", userID, friendID); err != nil {
+			return err
+		}
+	}
+
 	sql := `INSERT INTO friends (user_id, friend_id) VALUES ($1, $2),($2, $1)`
 	_, err = tx.Exec(ctx, sql, userID, friendID)
+	if isUniqueViolation(err) {
+		return ErrFriendshipExists
+	}
 	if err != nil {
 		return err
 	}
@@ -219,6 +268,17 @@ func (f *Friend) AddFriend(ctx context.Context, userID, friendID int) error {
 	if err != nil {
 		return err
 	}
+
+	if timelineMode(f.Config) {
+		if err := linkTimelines(ctx, tx, userID, friendID, f.Config.TimelineBackfill); err != nil {
+			return err
+		}
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, strconv.Itoa(userID)), entity.ActionFriendAdd, "user", strconv.Itoa(friendID), nil)
+	if err != nil {
+		return err
+	}
 	// Commit the transaction
 	err = tx.Commit(ctx)
 	if err != nil {
@@ -226,6 +286,7 @@ func (f *Friend) AddFriend(ctx context.Context, userID, friendID int) error {
 		return err
 	}
 
+	f.invalidate(ctx, userID, friendID)
 	return nil
 }
 
@@ -236,18 +297,20 @@ func (f *Friend) DeleteFriend(ctx context.Context, userID, friendID int) error {
 	}
 	defer conn.Release()
 
-	getFriend, err := f.GetByID(ctx, friendID)
+	exists, err := f.userExists(ctx, friendID)
 	if err != nil {
 		return err
 	}
-
-	if getFriend.ID == 0 {
-		return errors.New("FRIEND_NOT_FOUND")
+	if !exists {
+		return ErrFriendNotFound
 	}
 
 	isFriend, err := f.IsFriend(ctx, userID, friendID)
+	if err != nil {
+		return err
+	}
 	if !isFriend {
-		return errors.New("FRIENDSHIP_NOT_EXISTS")
+		return ErrFriendshipNotExists
 	}
 
 	tx, err := conn.Begin(ctx)
@@ -257,6 +320,12 @@ func (f *Friend) DeleteFriend(ctx context.Context, userID, friendID int) error {
 	}
 	defer tx.Rollback(ctx)
 
+	if timelineMode(f.Config) {
+		if err := lockTimelineUsers(ctx, tx, "FOR NO KEY UPDATE", userID, friendID); err != nil {
+			return err
+		}
+	}
+
 	sql := `DELETE FROM friends WHERE (user_id = $1 AND friend_id = $2) or (user_id = $2 AND friend_id = $1)`
 	_, err = tx.Exec(ctx, sql, userID, friendID)
 	if err != nil {
@@ -269,6 +338,17 @@ func (f *Friend) DeleteFriend(ctx context.Context, userID, friendID int) error {
 	if err != nil {
 		return err
 	}
+
+	if timelineMode(f.Config) {
+		if err := unlinkTimelines(ctx, tx, userID, friendID); err != nil {
+			return err
+		}
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, strconv.Itoa(userID)), entity.ActionFriendDelete, "user", strconv.Itoa(friendID), nil)
+	if err != nil {
+		return err
+	}
 	// Commit the transaction
 	err = tx.Commit(ctx)
 	if err != nil {
@@ -276,5 +356,6 @@ func (f *Friend) DeleteFriend(ctx context.Context, userID, friendID int) error {
 		return err
 	}
 
+	f.invalidate(ctx, userID, friendID)
 	return nil
 }
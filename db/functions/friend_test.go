@@ -0,0 +1,120 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/db/dbtest"
+	"testing"
+)
+
+func TestFriendCounters(t *testing.T) {
+	type op struct {
+		add      bool
+		from, to int // indexes into the registered users
+		wantErr  error
+	}
+
+	tests := []struct {
+		name string
+		ops  []op
+		// friend_count expected per user index
+		want []int
+	}{
+		{
+			name: "add",
+			ops:  []op{{add: true, from: 0, to: 1}},
+			want: []int{1, 1, 0},
+		},
+		{
+			name: "add to several",
+			ops:  []op{{add: true, from: 0, to: 1}, {add: true, from: 0, to: 2}, {add: true, from: 2, to: 1}},
+			want: []int{2, 2, 2},
+		},
+		{
+			name: "add twice from either side",
+			ops:  []op{{add: true, from: 0, to: 1}, {add: true, from: 1, to: 0, wantErr: ErrFriendshipExists}},
+			want: []int{1, 1, 0},
+		},
+		{
+			name: "add self",
+			ops:  []op{{add: true, from: 0, to: 0, wantErr: ErrNoAddSelf}},
+			want: []int{0, 0, 0},
+		},
+		{
+			name: "add unknown user",
+			ops:  []op{{add: true, from: 0, to: -1, wantErr: ErrFriendNotFound}},
+			want: []int{0, 0, 0},
+		},
+		{
+			name: "delete from the other side",
+			ops:  []op{{add: true, from: 0, to: 1}, {add: true, from: 0, to: 2}, {from: 1, to: 0}},
+			want: []int{1, 0, 1},
+		},
+		{
+			name: "delete twice",
+			ops:  []op{{add: true, from: 0, to: 1}, {from: 0, to: 1}, {from: 0, to: 1, wantErr: ErrFriendshipNotExists}},
+			want: []int{0, 0, 0},
+		},
+		{
+			name: "delete without friendship",
+			ops:  []op{{from: 0, to: 2, wantErr: ErrFriendshipNotExists}},
+			want: []int{0, 0, 0},
+		},
+		{
+			name: "add again after delete",
+			ops:  []op{{add: true, from: 0, to: 1}, {from: 0, to: 1}, {add: true, from: 1, to: 0}},
+			want: []int{1, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPool, config := dbtest.DB(t)
+			ids := register(t, dbPool, config, len(tt.want))
+			friends := NewFriend(dbPool, config)
+			ctx := context.Background()
+
+			id := func(i int) int {
+				if i < 0 {
+					return ids[len(ids)-1] + 1000
+				}
+				return ids[i]
+			}
+
+			for _, o := range tt.ops {
+				var err error
+				if o.add {
+					err = friends.AddFriend(ctx, id(o.from), id(o.to))
+				} else {
+					err = friends.DeleteFriend(ctx, id(o.from), id(o.to))
+				}
+				if !errors.Is(err, o.wantErr) {
+					t.Fatalf("add=%v %d->%d: error = %v, want %v", o.add, o.from, o.to, err, o.wantErr)
+				}
+			}
+
+			for i, want := range tt.want {
+				var count, actual int
+				err := dbPool.QueryRow(ctx, `SELECT fc.friend_count, (SELECT count(*) FROM friends f WHERE f.user_id = fc.user_id)
+					FROM friends_counter fc WHERE fc.user_id = $1`, ids[i]).Scan(&count, &actual)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != want || actual != want {
+					t.Errorf("user %d: friend_count = %d, friendships = %d, want %d", i, count, actual, want)
+				}
+			}
+
+			// every friendship is stored in both directions
+			var oneWay int
+			err := dbPool.QueryRow(ctx, `SELECT count(*) FROM friends f WHERE NOT EXISTS
+				(SELECT 1 FROM friends r WHERE r.user_id = f.friend_id AND r.friend_id = f.user_id)`).Scan(&oneWay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oneWay != 0 {
+				t.Errorf("%d friendships are stored in one direction only", oneWay)
+			}
+		})
+	}
+}
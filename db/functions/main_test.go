@@ -0,0 +1,39 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"segokuning/configs"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(dbtest.Main(m))
+}
+
+// register creates users named user1, user2, ... and returns their ids.
+func register(t *testing.T, dbPool *pgxpool.Pool, config configs.Config, n int) []int {
+	t.Helper()
+
+	users := NewUser(dbPool, config)
+	ids := make([]int, n)
+	for i := range ids {
+		usr, err := users.Register(context.Background(), entity.User{
+			Name:            fmt.Sprintf("user%d", i+1),
+			CredentialType:  "email",
+			CredentialValue: fmt.Sprintf("user%d@example.com", i+1),
+			Password:        "password123",
+		})
+		if err != nil {
+			t.Fatalf("register user%d: %v", i+1, err)
+		}
+		ids[i], _ = strconv.Atoi(usr.Id)
+	}
+	return ids
+}
@@ -0,0 +1,163 @@
+package functions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordReset struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+}
+
+func NewPasswordReset(dbPool *pgxpool.Pool, config configs.Config) *PasswordReset {
+	return &PasswordReset{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// Issue creates a reset token for the account holding the verified credential, replacing any pending one.
+// The returned Token is the only place the plain token exists, only its hash is stored.
+func (p *PasswordReset) Issue(ctx context.Context, credentialType, credentialValue string) (entity.PasswordReset, error) {
+	column, err := credentialColumn(credentialType)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	conn, err := p.dbPool.Acquire(ctx)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+	defer conn.Release()
+
+	result := entity.PasswordReset{
+		CredentialType:  credentialType,
+		CredentialValue: credentialValue,
+	}
+
+	// an unverified credential may not belong to the account holder, so it can't reset the password
+	sql := fmt.Sprintf(`SELECT id FROM users WHERE %[1]s = $1 AND %[1]s_verified_at IS NOT NULL`, column)
+	err = conn.QueryRow(ctx, sql, credentialValue).Scan(&result.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.PasswordReset{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	result.Token, err = newResetToken()
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, result.UserID)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	err = tx.QueryRow(ctx, `INSERT INTO password_resets (user_id, credential_type, token_hash, expires_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4)) RETURNING expires_at`,
+		result.UserID, credentialType, hashCode(result.Token), p.config.PasswordResetTTL.Seconds(),
+	).Scan(&result.ExpiresAt)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return entity.PasswordReset{}, err
+	}
+
+	return result, nil
+}
+
+// Reset sets a new password with a pending token. The token is spent, every session is signed out
+// and login lockouts on the account's credentials are lifted.
+func (p *PasswordReset) Reset(ctx context.Context, token, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), p.config.BcryptSalt)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.dbPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		id        int64
+		userID    string
+		expiresAt time.Time
+		usedAt    *time.Time
+	)
+	err = tx.QueryRow(ctx, `SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = $1 FOR UPDATE`,
+		hashCode(token),
+	).Scan(&id, &userID, &expiresAt, &usedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if usedAt != nil || expiresAt.Before(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password = $1, password_changed_at = now(), token_version = token_version + 1
+		WHERE id = $2`, string(hashedPassword), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM login_failures lf USING users u WHERE u.id = $1
+		AND ((lf.credential_type = 'email' AND lf.credential_value = u.email)
+		OR (lf.credential_type = 'phone' AND lf.credential_value = u.phone))`, userID)
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionPasswordReset, "user", userID, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// newResetToken returns 32 random bytes, hex encoded.
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
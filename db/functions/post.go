@@ -7,25 +7,64 @@ import (
 	"fmt"
 	"segokuning/configs"
 	"segokuning/db/entity"
+	"segokuning/internal/cache"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/lib/pq"
 )
 
+// inactiveUsers selects the users whose posts and comments feeds leave out, it stays small and
+// uses the users_not_active index.
+const inactiveUsers = `SELECT id FROM users WHERE status <> 'active' AND account_status(status, suspended_until) <> 'active'`
+
 type Post struct {
-	config configs.Config
-	dbPool *pgxpool.Pool
+	config   configs.Config
+	dbPool   *pgxpool.Pool
+	readPool *pgxpool.Pool
+	cache    *feedCache
 }
 
 func NewPost(dbPool *pgxpool.Pool, config configs.Config) *Post {
 	return &Post{
-		dbPool: dbPool,
-		config: config,
+		dbPool:   dbPool,
+		readPool: dbPool,
+		config:   config,
+	}
+}
+
+// WithReplica sends the feed queries the cache doesn't keep to readPool, a nil pool keeps them on
+// the primary.
+func (p *Post) WithReplica(readPool *pgxpool.Pool) *Post {
+	if readPool != nil {
+		p.readPool = readPool
+	}
+	return p
+}
+
+// WithCache keeps feed first pages, friend ids and creators in c for CACHE_TTL, a nil cache
+// queries every time.
+func (p *Post) WithCache(c cache.Cache) *Post {
+	p.cache = newFeedCache(c, p.config.CacheTTL)
+	return p
+}
+
+// source is the pool a feed query reads from. What goes into the cache is read from the primary, a
+// lagging replica would refill it with what the write before just invalidated.
+func (p *Post) source(cached bool) *pgxpool.Pool {
+	if cached && p.cache != nil {
+		return p.dbPool
 	}
+	return p.readPool
 }
 
 func (f *Post) GetCreator(ctx context.Context, userId int) (entity.Creator, error) {
+	return f.cache.creator(ctx, userId, func() (entity.Creator, error) {
+		return f.getCreator(ctx, userId)
+	})
+}
+
+func (f *Post) getCreator(ctx context.Context, userId int) (entity.Creator, error) {
 	conn, err := f.dbPool.Acquire(ctx)
 	if err != nil {
 		return entity.Creator{}, err
@@ -54,12 +93,35 @@ func (p *Post) Add(ctx context.Context, post entity.Post) (entity.Post, error) {
 	}
 	defer conn.Release()
 
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.Post{}, err
+	}
+	defer tx.Rollback(ctx)
+
 	sql := `INSERT INTO posts (post_in_html, tags, user_id) VALUES ($1, $2, $3) RETURNING id,created_at`
-	err = conn.QueryRow(ctx, sql, post.PostInHtml, post.Tags, post.UserID).Scan(&post.Id, &post.CreatedAt)
+	err = tx.QueryRow(ctx, sql, post.PostInHtml, post.Tags, post.UserID).Scan(&post.Id, &post.CreatedAt)
 	if err != nil {
 		return entity.Post{}, err
 	}
 
+	// the author sees it right away, their friends once it's fanned out
+	if timelineMode(p.config) {
+		_, err = tx.Exec(ctx, `INSERT INTO timelines (owner_id, post_id, author_id, posted_at) VALUES ($1, $2, $1, $3)`,
+			post.UserID, post.Id, post.CreatedAt)
+		if err != nil {
+			return entity.Post{}, err
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO timeline_fanouts (post_id) VALUES ($1)`, post.Id); err != nil {
+			return entity.Post{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return entity.Post{}, err
+	}
+
+	p.cache.invalidateFeeds(ctx, p.dbPool, post.UserID)
 	return post, nil
 }
 
@@ -76,17 +138,24 @@ func (p *Post) AddComment(ctx context.Context, postID int, comment entity.Commen
 	}
 	comment.Creator = creator
 
+	// moderators remove a comment by its id
+	if err := conn.QueryRow(ctx, `SELECT nextval('comment_id_seq')`).Scan(&comment.Id); err != nil {
+		return entity.CommentPerPost{}, err
+	}
+
 	commentJSON, err := json.Marshal(comment)
 	if err != nil {
 		return entity.CommentPerPost{}, err
 	}
 
-	sql := `UPDATE posts SET comments = comments || $1 WHERE id = $2 RETURNING created_at`
-	err = conn.QueryRow(ctx, sql, commentJSON, postID).Scan(&comment.CreatedAt)
+	var authorID int
+	sql := `UPDATE posts SET comments = comments || $1 WHERE id = $2 RETURNING created_at, user_id`
+	err = conn.QueryRow(ctx, sql, commentJSON, postID).Scan(&comment.CreatedAt, &authorID)
 	if err != nil {
 		return entity.CommentPerPost{}, err
 	}
 
+	p.cache.invalidateFeeds(ctx, p.dbPool, authorID)
 	return comment, nil
 }
 
@@ -111,43 +180,80 @@ func (p *Post) GetByID(ctx context.Context, postID int) (entity.Post, error) {
 	return post, nil
 }
 
-func (p *Post) Get(ctx context.Context, query entity.QueryGetPosts) ([]entity.Post, error) {
-	conn, err := p.dbPool.Acquire(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Release()
-
+// feedFilter is the FROM and WHERE clauses Get and Count share, the posts of the user and their
+// friends that are neither hidden nor by inactive users, narrowed by the search. joins go between
+// them, the columns of posts are qualified so the joined tables can't make them ambiguous.
+func (p *Post) feedFilter(ctx context.Context, query entity.QueryGetPosts, joins string) (string, []any, error) {
 	var (
-		sql        = `SELECT id, post_in_html, tags, user_id, created_at, comments FROM posts where 1 = 1`
-		arg        = 1
+		sql        = ` FROM posts` + joins + ` WHERE 1 = 1`
 		args []any = []any{}
 	)
 
-	// only show post from friends join with friends table
-	sql = fmt.Sprintf("%s AND user_id IN (SELECT friend_id FROM friends WHERE user_id = $%d UNION SELECT $%d)", sql, arg, arg+1)
-	args = append(args, query.UserId, query.UserId)
-	arg += 2
+	// only show post from friends: the user's timeline holds them, or the cached friend ids, or the friends table
+	if timelineMode(p.config) {
+		sql = fmt.Sprintf(` FROM timelines t JOIN posts ON posts.id = t.post_id%s WHERE t.owner_id = $%d`, joins, len(args)+1)
+		args = append(args, query.UserId)
+	} else if p.cache != nil {
+		friends, err := p.cache.friendIDs(ctx, p.dbPool, query.UserId)
+		if err != nil {
+			return "", nil, err
+		}
+		sql = fmt.Sprintf("%s AND posts.user_id = ANY($%d)", sql, len(args)+1)
+		args = append(args, append(friends, query.UserId))
+	} else {
+		sql = fmt.Sprintf("%s AND posts.user_id IN (SELECT friend_id FROM friends WHERE user_id = $%d UNION SELECT $%d)", sql, len(args)+1, len(args)+2)
+		args = append(args, query.UserId, query.UserId)
+	}
+
+	// reported past the threshold or hidden by a moderator
+	sql = fmt.Sprintf("%s AND posts.hidden_at IS NULL", sql)
+
+	// suspended users drop out of feeds until they're reinstated
+	sql = fmt.Sprintf("%s AND posts.user_id NOT IN (%s)", sql, inactiveUsers)
 
 	if query.Search != "" {
-		sql = fmt.Sprintf("%s, AND post_in_html LIKE '%%%s%%'", sql, query.Search)
+		sql = fmt.Sprintf("%s AND posts.post_in_html ILIKE '%%' || $%d || '%%'", sql, len(args)+1)
+		args = append(args, query.Search)
 	}
 
 	if len(query.SearchTags) > 0 {
-		sql = fmt.Sprintf("%s AND $%v <@ tags", sql, arg)
+		sql = fmt.Sprintf("%s AND $%v <@ posts.tags", sql, len(args)+1)
 		args = append(args, pq.Array(query.SearchTags))
-		arg++
 	}
 
-	sql = fmt.Sprintf("%s ORDER BY created_at DESC", sql)
+	return sql, args, nil
+}
 
-	sql = fmt.Sprintf("%s LIMIT $%d", sql, arg)
-	args = append(args, query.Limit)
-	arg++
+func (p *Post) Get(ctx context.Context, query entity.QueryGetPosts) ([]entity.Post, error) {
+	if posts, ok := p.cache.feed(ctx, query); ok {
+		return posts, nil
+	}
 
-	sql = fmt.Sprintf("%s OFFSET $%d", sql, arg)
-	args = append(args, query.Offset)
-	arg++
+	dbPool := p.source(cacheable(query) && query.Offset == 0)
+	// the creators come along in the same query
+	where, args, err := p.feedFilter(ctx, query, ` JOIN users u ON u.id = posts.user_id LEFT JOIN friends_counter fc ON fc.user_id = posts.user_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbPool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// a timeline is read in the order of its index
+	order := "posts.created_at DESC"
+	if timelineMode(p.config) {
+		order = "t.posted_at DESC, t.post_id DESC"
+	}
+
+	sql := `SELECT posts.id, posts.post_in_html, posts.tags, posts.user_id, posts.created_at,
+			COALESCE((SELECT jsonb_agg(e.c ORDER BY e.ord) FROM jsonb_array_elements(posts.comments) WITH ORDINALITY AS e(c, ord)
+				WHERE (e.c->'creator'->>'userId')::bigint NOT IN (` + inactiveUsers + `)), '[]'::jsonb),
+			u.name, u.image_url, COALESCE(fc.friend_count, 0)` + where
+	sql = fmt.Sprintf("%s ORDER BY %s LIMIT $%d OFFSET $%d", sql, order, len(args)+1, len(args)+2)
+	args = append(args, query.Limit, query.Offset)
 
 	rows, err := conn.Query(ctx, sql, args...)
 	if err != nil {
@@ -158,61 +264,48 @@ func (p *Post) Get(ctx context.Context, query entity.QueryGetPosts) ([]entity.Po
 	posts := make([]entity.Post, 0)
 	for rows.Next() {
 		var post entity.Post
-		err = rows.Scan(&post.Id, &post.PostInHtml, &post.Tags, &post.UserID, &post.CreatedAt, &post.Comments)
+		err = rows.Scan(&post.Id, &post.PostInHtml, &post.Tags, &post.UserID, &post.CreatedAt, &post.Comments,
+			&post.Creator.Name, &post.Creator.ImageUrl, &post.Creator.FriendCount)
 		if err != nil {
 			return nil, err
 		}
 
-		//sort comments by created_at desc
-		for i, j := 0, len(post.Comments)-1; i < j; i, j = i+1, j-1 {
-			post.Comments[i], post.Comments[j] = post.Comments[j], post.Comments[i]
-		}
-
-		creator, err := p.GetCreator(ctx, post.UserID)
-		if err != nil {
-			return nil, err
+		//sort comments by created_at desc, leaving out hidden ones
+		comments := make([]entity.CommentPerPost, 0, len(post.Comments))
+		for i := len(post.Comments) - 1; i >= 0; i-- {
+			if !post.Comments[i].Hidden {
+				comments = append(comments, post.Comments[i])
+			}
 		}
-		post.Creator = creator
+		post.Comments = comments
+		post.Creator.UserId = post.UserID
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	p.cache.setFeed(ctx, query, posts)
 	return posts, nil
 }
 
 func (p *Post) Count(ctx context.Context, query entity.QueryGetPosts) (int, error) {
-	conn, err := p.dbPool.Acquire(ctx)
-	if err != nil {
-		return 0, err
-	}
-	defer conn.Release()
-
-	var (
-		sql        = `SELECT COUNT(*) FROM posts where 1 = 1`
-		arg        = 1
-		args []any = []any{}
-	)
-
-	// only show post from friends join with friends table
-	sql = fmt.Sprintf("%s AND user_id IN (SELECT friend_id FROM friends WHERE user_id = $%d UNION SELECT $%d)", sql, arg, arg+1)
-	args = append(args, query.UserId, query.UserId)
-	arg += 2
-
-	if query.Search != "" {
-		sql = fmt.Sprintf("%s, AND post_in_html LIKE '%%%s%%'", sql, query.Search)
+	if count, ok := p.cache.count(ctx, query); ok {
+		return count, nil
 	}
 
-	if len(query.SearchTags) > 0 {
-		sql = fmt.Sprintf("%s AND $%v <@ tags", sql, arg)
-		args = append(args, pq.Array(query.SearchTags))
-		arg++
+	dbPool := p.source(cacheable(query))
+	where, args, err := p.feedFilter(ctx, query, "")
+	if err != nil {
+		return 0, err
 	}
 
-	row := conn.QueryRow(ctx, sql, args...)
 	var count int
-	err = row.Scan(&count)
+	err = dbPool.QueryRow(ctx, `SELECT COUNT(*)`+where, args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
+	p.cache.setCount(ctx, query, count)
 	return count, nil
 }
@@ -0,0 +1,261 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPostVisibility(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 3)
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, alice, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := NewPost(dbPool, config)
+	byAuthor := map[int]string{
+		alice: "<p>Alice makes nasi goreng</p>",
+		bob:   "<p>Bob makes soto ayam</p>",
+		carol: "<p>Carol makes rendang</p>",
+	}
+	for _, author := range []int{alice, bob, carol} {
+		_, err := posts.Add(ctx, entity.Post{UserID: author, PostInHtml: byAuthor[author], Tags: []string{"food"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := posts.Add(ctx, entity.Post{UserID: bob, PostInHtml: "<p>Bob's soup</p>", Tags: []string{"food", "soup"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query entity.QueryGetPosts
+		want  []int // authors, newest first
+	}{
+		{"own and friends' posts", entity.QueryGetPosts{UserId: alice, Limit: 10}, []int{bob, bob, alice}},
+		{"friendship works both ways", entity.QueryGetPosts{UserId: bob, Limit: 10}, []int{bob, bob, alice}},
+		{"no friends", entity.QueryGetPosts{UserId: carol, Limit: 10}, []int{carol}},
+		{"paged", entity.QueryGetPosts{UserId: alice, Limit: 1, Offset: 1}, []int{bob}},
+		{"tags", entity.QueryGetPosts{UserId: alice, Limit: 10, SearchTags: []string{"soup"}}, []int{bob}},
+		{"search", entity.QueryGetPosts{UserId: alice, Limit: 10, Search: "nasi"}, []int{alice}},
+		{"search doesn't reach strangers", entity.QueryGetPosts{UserId: alice, Limit: 10, Search: "rendang"}, []int{}},
+		{"search is a value, not SQL", entity.QueryGetPosts{UserId: alice, Limit: 10, Search: "' OR '1'='1"}, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := posts.Get(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Get() returned %d posts, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, post := range got {
+				if post.UserID != tt.want[i] || post.Creator.UserId != tt.want[i] {
+					t.Errorf("post %d is by user %d, want %d", i, post.UserID, tt.want[i])
+				}
+			}
+
+			count, err := posts.Count(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			unpaged := tt.query
+			unpaged.Limit, unpaged.Offset = 100, 0
+			all, err := posts.Get(ctx, unpaged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(all) {
+				t.Errorf("Count() = %d, want %d", count, len(all))
+			}
+		})
+	}
+}
+
+func TestFeedCache(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 2)
+	alice, bob := ids[0], ids[1]
+	ctx := context.Background()
+
+	c := cache.NewLRU(100)
+	posts := NewPost(dbPool, config).WithCache(c)
+	friends := NewFriend(dbPool, config).WithCache(c)
+	users := NewUser(dbPool, config).WithCache(c)
+
+	add := func(author int, html string) {
+		t.Helper()
+		if _, err := posts.Add(ctx, entity.Post{UserID: author, PostInHtml: html, Tags: []string{"food"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feed := func(want ...string) []entity.Post {
+		t.Helper()
+		query := entity.QueryGetPosts{UserId: alice, Limit: 5}
+		got, err := posts.Get(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := posts.Count(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || count != len(want) {
+			t.Fatalf("feed has %d posts and counts %d, want %v: %+v", len(got), count, want, got)
+		}
+		for i, post := range got {
+			if post.PostInHtml != want[i] {
+				t.Fatalf("post %d = %q, want %q", i, post.PostInHtml, want[i])
+			}
+		}
+		return got
+	}
+
+	add(alice, "<p>nasi goreng</p>")
+	add(bob, "<p>soto ayam</p>")
+	feed("<p>nasi goreng</p>")
+
+	// written behind the cache's back, the cached page is served until it's invalidated
+	if _, err := dbPool.Exec(ctx, `INSERT INTO posts (post_in_html, tags, user_id) VALUES ('<p>rendang</p>', '{food}', $1)`, alice); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>nasi goreng</p>")
+
+	if err := friends.AddFriend(ctx, alice, bob); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>rendang</p>", "<p>soto ayam</p>", "<p>nasi goreng</p>")
+
+	add(bob, "<p>bakso</p>")
+	got := feed("<p>bakso</p>", "<p>rendang</p>", "<p>soto ayam</p>", "<p>nasi goreng</p>")
+	if got[0].Creator.FriendCount != 1 {
+		t.Fatalf("bob's friend count = %d, want 1", got[0].Creator.FriendCount)
+	}
+
+	if _, err := users.UpdateAccount(ctx, strconv.Itoa(bob), "Bobby", "https://example.com/bob.png"); err != nil {
+		t.Fatal(err)
+	}
+	if got := feed("<p>bakso</p>", "<p>rendang</p>", "<p>soto ayam</p>", "<p>nasi goreng</p>"); got[0].Creator.Name != "Bobby" {
+		t.Fatalf("bob's cached name = %q, want Bobby", got[0].Creator.Name)
+	}
+
+	if err := friends.DeleteFriend(ctx, bob, alice); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>rendang</p>", "<p>nasi goreng</p>")
+}
+
+func TestFeedCacheModeration(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.ReportHideThreshold = 1
+	ids := register(t, dbPool, config, 3)
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	ctx := context.Background()
+
+	c := cache.NewLRU(100)
+	posts := NewPost(dbPool, config).WithCache(c)
+	friends := NewFriend(dbPool, config).WithCache(c)
+	admin := NewAdmin(dbPool, config).WithCache(c)
+	reports := NewReport(dbPool, config).WithCache(c)
+	accounts := NewAccount(dbPool, config).WithCache(c)
+
+	// carol isn't alice's friend, alice sees carol's comment on bob's post
+	for _, pair := range [][2]int{{alice, bob}, {bob, carol}} {
+		if err := friends.AddFriend(ctx, pair[0], pair[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	own, err := posts.Add(ctx, entity.Post{UserID: alice, PostInHtml: "<p>nasi goreng</p>", Tags: []string{"food"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobs, err := posts.Add(ctx, entity.Post{UserID: bob, PostInHtml: "<p>soto ayam</p>", Tags: []string{"food"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.AddComment(ctx, bobs.Id, entity.CommentPerPost{Comment: "enak", Creator: entity.Creator{UserId: carol}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// feed checks alice's feed, each post as its html and how many comments it shows
+	feed := func(want ...string) []entity.Post {
+		t.Helper()
+		query := entity.QueryGetPosts{UserId: alice, Limit: 5}
+		got, err := posts.Get(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := posts.Count(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var shown []string
+		for _, post := range got {
+			shown = append(shown, fmt.Sprintf("%s %d", post.PostInHtml, len(post.Comments)))
+		}
+		if count != len(want) || strings.Join(shown, ", ") != strings.Join(want, ", ") {
+			t.Fatalf("feed = %v counting %d, want %v", shown, count, want)
+		}
+		return got
+	}
+
+	got := feed("<p>soto ayam</p> 1", "<p>nasi goreng</p> 0")
+	if got[0].Creator.FriendCount != 2 {
+		t.Fatalf("bob's friend count = %d, want 2", got[0].Creator.FriendCount)
+	}
+
+	if _, err := admin.Suspend(ctx, entity.Actor{}, strconv.Itoa(carol), nil, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>soto ayam</p> 0", "<p>nasi goreng</p> 0")
+	if _, err := admin.Unsuspend(ctx, entity.Actor{}, strconv.Itoa(carol)); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>soto ayam</p> 1", "<p>nasi goreng</p> 0")
+
+	report, err := reports.Add(ctx, entity.Report{
+		ReporterID: int64(alice),
+		TargetType: entity.ReportTargetPost,
+		TargetID:   int64(bobs.Id),
+		Reason:     entity.ReportReasonHarassment,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>nasi goreng</p> 0")
+	if _, err := reports.Resolve(ctx, entity.Actor{}, report.Id, entity.Resolution{Action: entity.ResolveDismiss}); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>soto ayam</p> 1", "<p>nasi goreng</p> 0")
+
+	// erasing carol takes the comment and one of bob's friends
+	if err := accounts.Delete(ctx, strconv.Itoa(carol), "password123"); err != nil {
+		t.Fatal(err)
+	}
+	got = feed("<p>soto ayam</p> 0", "<p>nasi goreng</p> 0")
+	if got[0].Creator.FriendCount != 1 {
+		t.Fatalf("bob's friend count after erasing carol = %d, want 1", got[0].Creator.FriendCount)
+	}
+
+	if err := admin.DeletePost(ctx, entity.Actor{}, own.Id, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	feed("<p>soto ayam</p> 0")
+
+	if err := accounts.Deactivate(ctx, strconv.Itoa(bob), "password123"); err != nil {
+		t.Fatal(err)
+	}
+	feed()
+}
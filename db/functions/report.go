@@ -0,0 +1,409 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Report files reports from users and keeps the moderation queue. A post or comment with
+// config.ReportHideThreshold open reports is hidden from feeds until a moderator resolves them.
+type Report struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+	cache  *feedCache
+}
+
+func NewReport(dbPool *pgxpool.Pool, config configs.Config) *Report {
+	return &Report{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// WithCache drops the feeds hiding, showing again or suspending changes from c.
+func (r *Report) WithCache(c cache.Cache) *Report {
+	r.cache = newFeedCache(c, r.config.CacheTTL)
+	return r
+}
+
+const reportColumns = `r.id, r.reporter_id, r.target_type, r.target_id, r.post_id, r.reason, r.text, r.status,
+	r.resolution, r.resolved_by, r.resolved_at, r.created_at,
+	(SELECT count(*) FROM reports o WHERE o.target_type = r.target_type AND o.target_id = r.target_id AND o.status = 'open'),
+	CASE r.target_type
+		WHEN 'post' THEN EXISTS (SELECT 1 FROM posts p WHERE p.id = r.target_id AND p.hidden_at IS NOT NULL)
+		WHEN 'comment' THEN EXISTS (SELECT 1 FROM posts p WHERE p.id = r.post_id
+			AND p.comments @> jsonb_build_array(jsonb_build_object('id', r.target_id, 'hidden', true)))
+		ELSE false
+	END`
+
+func scanReport(row pgx.Row) (entity.Report, error) {
+	var report entity.Report
+	err := row.Scan(&report.Id, &report.ReporterID, &report.TargetType, &report.TargetID, &report.PostID,
+		&report.Reason, &report.Text, &report.Status, &report.Resolution, &report.ResolvedBy, &report.ResolvedAt,
+		&report.CreatedAt, &report.Reports, &report.Hidden)
+	return report, err
+}
+
+func report(ctx context.Context, db queryRower, reportID int64) (entity.Report, error) {
+	r, err := scanReport(db.QueryRow(ctx, `SELECT `+reportColumns+` FROM reports r WHERE r.id = $1`, reportID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Report{}, ErrReportNotFound
+	}
+	return r, err
+}
+
+// reportTarget returns who wrote the reported content, or the reported user, and the post holding
+// a reported comment. Posts are locked so concurrent reports count one after the other.
+func reportTarget(ctx context.Context, tx pgx.Tx, targetType string, targetID int64) (int64, *int64, error) {
+	var (
+		authorID int64
+		postID   int64
+		err      error
+	)
+
+	switch targetType {
+	case entity.ReportTargetPost:
+		err = tx.QueryRow(ctx, `SELECT user_id FROM posts WHERE id = $1 FOR UPDATE`, targetID).Scan(&authorID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrPostNotFound
+		}
+		return authorID, nil, err
+	case entity.ReportTargetComment:
+		err = tx.QueryRow(ctx, `SELECT p.id, (c->'creator'->>'userId')::bigint
+			FROM posts p CROSS JOIN LATERAL jsonb_array_elements(p.comments) c
+			WHERE p.comments @> jsonb_build_array(jsonb_build_object('id', $1::bigint)) AND (c->>'id')::bigint = $1
+			FOR UPDATE OF p`, targetID).Scan(&postID, &authorID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrCommentNotFound
+		}
+		return authorID, &postID, err
+	case entity.ReportTargetUser:
+		err = tx.QueryRow(ctx, `SELECT id FROM users WHERE id = $1`, targetID).Scan(&authorID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrUserNotFound
+		}
+		return authorID, nil, err
+	}
+	return 0, nil, ErrInvalidReportTarget
+}
+
+// Why a post or comment is hidden, in posts.hidden_by or the "hiddenBy" of a comment.
+const (
+	hiddenByReports   = "reports"
+	hiddenByModerator = "moderator"
+)
+
+// hide hides a reported post or comment from feeds, by its reports past the threshold or by a
+// moderator. What a moderator hid stays theirs. Users aren't hidden.
+func hide(ctx context.Context, tx pgx.Tx, targetType string, targetID int64, postID *int64, by string) error {
+	var err error
+	switch targetType {
+	case entity.ReportTargetPost:
+		_, err = tx.Exec(ctx, `UPDATE posts SET hidden_at = COALESCE(hidden_at, now()),
+			hidden_by = CASE WHEN hidden_by = 'moderator' THEN hidden_by ELSE $2 END
+			WHERE id = $1`, targetID, by)
+	case entity.ReportTargetComment:
+		_, err = tx.Exec(ctx, `UPDATE posts SET comments = (
+				SELECT jsonb_agg(CASE WHEN (e.c->>'id')::bigint <> $2 THEN e.c
+					ELSE e.c || jsonb_build_object('hidden', true,
+						'hiddenBy', CASE WHEN e.c->>'hiddenBy' = 'moderator' THEN 'moderator' ELSE $3 END)
+					END ORDER BY e.ord)
+				FROM jsonb_array_elements(comments) WITH ORDINALITY AS e(c, ord)
+			)
+			WHERE id = $1 AND jsonb_array_length(comments) > 0`, postID, targetID, by)
+	}
+	return err
+}
+
+// unhide shows a post or comment its reports hid again, what a moderator hid stays hidden.
+func unhide(ctx context.Context, tx pgx.Tx, targetType string, targetID int64, postID *int64) error {
+	var err error
+	switch targetType {
+	case entity.ReportTargetPost:
+		_, err = tx.Exec(ctx, `UPDATE posts SET hidden_at = NULL, hidden_by = NULL WHERE id = $1 AND hidden_by = 'reports'`,
+			targetID)
+	case entity.ReportTargetComment:
+		_, err = tx.Exec(ctx, `UPDATE posts SET comments = (
+				SELECT jsonb_agg(CASE WHEN (e.c->>'id')::bigint = $2 AND e.c->>'hiddenBy' = 'reports'
+					THEN e.c - 'hidden' - 'hiddenBy' ELSE e.c END ORDER BY e.ord)
+				FROM jsonb_array_elements(comments) WITH ORDINALITY AS e(c, ord)
+			)
+			WHERE id = $1 AND jsonb_array_length(comments) > 0`, postID, targetID)
+	}
+	return err
+}
+
+// postAuthor returns who wrote the post a reported post or comment is in, 0 for a user or a post
+// that is gone.
+func postAuthor(ctx context.Context, db queryRower, targetType string, targetID int64, postID *int64) (int, error) {
+	if targetType == entity.ReportTargetUser {
+		return 0, nil
+	}
+	if postID != nil {
+		targetID = *postID
+	}
+	var authorID int
+	err := db.QueryRow(ctx, `SELECT user_id FROM posts WHERE id = $1`, targetID).Scan(&authorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return authorID, err
+}
+
+// seesPostsOf tells whether userID sees the posts of authorID: their own and their friends', the
+// same rule commenting follows.
+func seesPostsOf(ctx context.Context, db queryRower, userID, authorID int64) (bool, error) {
+	if userID == authorID {
+		return true, nil
+	}
+	var friends bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM friends
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1))`, userID, authorID).Scan(&friends)
+	return friends, err
+}
+
+// Add files a report by report.ReporterID. Nobody reports themselves or their own content, and
+// a target is reported once by each user until it's reviewed. Posts and comments are reported by
+// whoever sees the post, others are told it doesn't exist.
+func (r *Report) Add(ctx context.Context, report entity.Report) (entity.Report, error) {
+	tx, err := r.dbPool.Begin(ctx)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	authorID, postID, err := reportTarget(ctx, tx, report.TargetType, report.TargetID)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	postAuthorID := authorID
+	if report.TargetType != entity.ReportTargetUser {
+		if postID != nil {
+			if err := tx.QueryRow(ctx, `SELECT user_id FROM posts WHERE id = $1`, *postID).Scan(&postAuthorID); err != nil {
+				return entity.Report{}, err
+			}
+		}
+		sees, err := seesPostsOf(ctx, tx, report.ReporterID, postAuthorID)
+		if err != nil {
+			return entity.Report{}, err
+		}
+		if !sees && report.TargetType == entity.ReportTargetComment {
+			return entity.Report{}, ErrCommentNotFound
+		}
+		if !sees {
+			return entity.Report{}, ErrPostNotFound
+		}
+	}
+	if authorID == report.ReporterID {
+		return entity.Report{}, ErrCannotReportSelf
+	}
+	report.PostID = postID
+
+	err = tx.QueryRow(ctx, `INSERT INTO reports (reporter_id, target_type, target_id, post_id, reason, text)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, status, created_at`,
+		report.ReporterID, report.TargetType, report.TargetID, report.PostID, report.Reason, report.Text,
+	).Scan(&report.Id, &report.Status, &report.CreatedAt)
+	if isUniqueViolation(err) {
+		return entity.Report{}, ErrAlreadyReported
+	}
+	if err != nil {
+		return entity.Report{}, err
+	}
+
+	err = tx.QueryRow(ctx, `SELECT count(*) FROM reports WHERE target_type = $1 AND target_id = $2 AND status = 'open'`,
+		report.TargetType, report.TargetID).Scan(&report.Reports)
+	if err != nil {
+		return entity.Report{}, err
+	}
+
+	if threshold := r.config.ReportHideThreshold; threshold > 0 && report.Reports >= threshold &&
+		report.TargetType != entity.ReportTargetUser {
+		if err := hide(ctx, tx, report.TargetType, report.TargetID, report.PostID, hiddenByReports); err != nil {
+			return entity.Report{}, err
+		}
+		report.Hidden = true
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return entity.Report{}, err
+	}
+
+	if report.Hidden {
+		r.cache.invalidateFeeds(ctx, r.dbPool, int(postAuthorID))
+	}
+	return report, nil
+}
+
+// Queue lists reports with q.Status, open ones by default. Open reports come oldest first,
+// resolved ones most recently resolved first.
+func (r *Report) Queue(ctx context.Context, q entity.QueryReports) (entity.ReportData, error) {
+	if q.Status == "" {
+		q.Status = entity.ReportOpen
+	}
+
+	var (
+		where = ` WHERE r.status = $1`
+		args  = []interface{}{q.Status}
+		order = ` ORDER BY r.created_at, r.id`
+	)
+	if q.TargetType != "" {
+		where += fmt.Sprintf(` AND r.target_type = $%d`, len(args)+1)
+		args = append(args, q.TargetType)
+	}
+	if q.Status != entity.ReportOpen {
+		order = ` ORDER BY r.resolved_at DESC, r.id DESC`
+	}
+
+	result := entity.ReportData{
+		Data: []entity.Report{},
+		Meta: entity.Meta{Limit: q.Limit, Offset: q.Offset},
+	}
+
+	err := r.dbPool.QueryRow(ctx, `SELECT count(*) FROM reports r`+where, args...).Scan(&result.Meta.Total)
+	if err != nil {
+		return entity.ReportData{}, err
+	}
+
+	sql := `SELECT ` + reportColumns + ` FROM reports r` + where + order +
+		fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	rows, err := r.dbPool.Query(ctx, sql, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return entity.ReportData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return entity.ReportData{}, err
+		}
+		result.Data = append(result.Data, report)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.ReportData{}, err
+	}
+
+	return result, nil
+}
+
+// Resolve closes every open report on the target of reportID. Dismissing shows content its reports
+// hid again, hiding keeps it out of feeds for good and suspending also suspends its author, with
+// the same checks as Admin.Suspend.
+func (r *Report) Resolve(ctx context.Context, actor entity.Actor, reportID int64, res entity.Resolution) (entity.Report, error) {
+	tx, err := r.dbPool.Begin(ctx)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		targetType string
+		targetID   int64
+		postID     *int64
+		status     string
+	)
+	err = tx.QueryRow(ctx, `SELECT target_type, target_id, post_id, status FROM reports WHERE id = $1 FOR UPDATE`,
+		reportID).Scan(&targetType, &targetID, &postID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Report{}, ErrReportNotFound
+	}
+	if err != nil {
+		return entity.Report{}, err
+	}
+	if status != entity.ReportOpen {
+		return entity.Report{}, ErrReportResolved
+	}
+
+	details := map[string]interface{}{
+		"action":     res.Action,
+		"reason":     res.Reason,
+		"targetType": targetType,
+		"targetId":   targetID,
+	}
+
+	// the feeds showing the post the content is in, and with a suspension everything its author wrote
+	owner, err := postAuthor(ctx, tx, targetType, targetID, postID)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	var stale []int
+	if owner != 0 {
+		stale = append(stale, owner)
+	}
+
+	status = entity.ReportActioned
+	switch res.Action {
+	case entity.ResolveDismiss:
+		// the content may be gone already, dismissing its reports still works
+		status = entity.ReportDismissed
+		if err := unhide(ctx, tx, targetType, targetID, postID); err != nil {
+			return entity.Report{}, err
+		}
+	case entity.ResolveHide:
+		if targetType == entity.ReportTargetUser {
+			return entity.Report{}, ErrInvalidResolution
+		}
+		if _, _, err := reportTarget(ctx, tx, targetType, targetID); err != nil {
+			return entity.Report{}, err
+		}
+		if err := hide(ctx, tx, targetType, targetID, postID, hiddenByModerator); err != nil {
+			return entity.Report{}, err
+		}
+	case entity.ResolveSuspend:
+		authorID, _, err := reportTarget(ctx, tx, targetType, targetID)
+		if err != nil {
+			return entity.Report{}, err
+		}
+		usr, err := target(ctx, tx, actor, strconv.FormatInt(authorID, 10))
+		if err != nil {
+			return entity.Report{}, err
+		}
+		if err := suspend(ctx, tx, actor, usr, res.Until, res.Reason); err != nil {
+			return entity.Report{}, err
+		}
+		if err := hide(ctx, tx, targetType, targetID, postID, hiddenByModerator); err != nil {
+			return entity.Report{}, err
+		}
+		shown, err := r.cache.audience(ctx, tx, int(authorID))
+		if err != nil {
+			return entity.Report{}, err
+		}
+		stale = append(stale, shown...)
+		details["userId"] = usr.Id
+		details["until"] = res.Until
+	default:
+		return entity.Report{}, ErrInvalidResolution
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE reports SET status = $1, resolution = $2, resolved_by = $3, resolved_at = now()
+		WHERE target_type = $4 AND target_id = $5 AND status = 'open'`,
+		status, res.Action, actorID(actor), targetType, targetID)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	details["reports"] = tag.RowsAffected()
+
+	err = audit(ctx, tx, actor, entity.ActionReportResolve, "report", strconv.FormatInt(reportID, 10), details)
+	if err != nil {
+		return entity.Report{}, err
+	}
+
+	resolved, err := report(ctx, tx, reportID)
+	if err != nil {
+		return entity.Report{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return entity.Report{}, err
+	}
+
+	r.cache.invalidateFeeds(ctx, r.dbPool, stale...)
+	return resolved, nil
+}
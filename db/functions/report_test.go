@@ -0,0 +1,230 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"strconv"
+	"testing"
+)
+
+func TestReportHidesPastThreshold(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.ReportHideThreshold = 2
+	ids := register(t, dbPool, config, 5)
+	ctx := context.Background()
+
+	friends := NewFriend(dbPool, config)
+	for _, friend := range ids[1:3] {
+		if err := friends.AddFriend(ctx, ids[0], friend); err != nil {
+			t.Fatal(err)
+		}
+	}
+	posts := NewPost(dbPool, config)
+	post, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>halo</p>", Tags: []string{"hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := posts.AddComment(ctx, post.Id, entity.CommentPerPost{Comment: "dasar bodoh", Creator: entity.Creator{UserId: ids[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports := NewReport(dbPool, config)
+	add := func(reporter int, targetType string, targetID int64) (entity.Report, error) {
+		return reports.Add(ctx, entity.Report{
+			ReporterID: int64(reporter),
+			TargetType: targetType,
+			TargetID:   targetID,
+			Reason:     entity.ReportReasonHarassment,
+		})
+	}
+	feed := func() entity.Post {
+		t.Helper()
+		got, err := posts.Get(ctx, entity.QueryGetPosts{UserId: ids[0], Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("feed has %d posts, want 1", len(got))
+		}
+		return got[0]
+	}
+
+	tests := []struct {
+		name     string
+		reporter int
+		target   string
+		targetID int64
+		wantErr  error
+	}{
+		{"own comment", ids[1], entity.ReportTargetComment, comment.Id, ErrCannotReportSelf},
+		{"unknown comment", ids[0], entity.ReportTargetComment, comment.Id + 1000, ErrCommentNotFound},
+		{"unknown post", ids[1], entity.ReportTargetPost, int64(post.Id) + 1000, ErrPostNotFound},
+		{"unknown target", ids[1], "page", 1, ErrInvalidReportTarget},
+		// ids[4] isn't a friend of the author, the post and its comments don't exist for them
+		{"post of a stranger", ids[4], entity.ReportTargetPost, int64(post.Id), ErrPostNotFound},
+		{"comment on a stranger's post", ids[4], entity.ReportTargetComment, comment.Id, ErrCommentNotFound},
+		{"comment", ids[0], entity.ReportTargetComment, comment.Id, nil},
+		{"twice", ids[0], entity.ReportTargetComment, comment.Id, ErrAlreadyReported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := add(tt.reporter, tt.target, tt.targetID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := feed(); len(got.Comments) != 1 {
+		t.Fatalf("one report hid the comment: %+v", got.Comments)
+	}
+
+	report, err := add(ids[2], entity.ReportTargetComment, comment.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reports != 2 || !report.Hidden || report.PostID == nil || *report.PostID != int64(post.Id) {
+		t.Fatalf("Add() past the threshold = %+v", report)
+	}
+	if got := feed(); len(got.Comments) != 0 {
+		t.Fatalf("hidden comment in the feed: %+v", got.Comments)
+	}
+
+	mod := entity.Actor{UserID: strconv.Itoa(ids[3]), Role: entity.RoleModerator}
+	resolved, err := reports.Resolve(ctx, mod, report.Id, entity.Resolution{Action: entity.ResolveDismiss, Reason: "banter"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resolved.Status != entity.ReportDismissed || resolved.Hidden || resolved.ResolvedBy == nil || *resolved.ResolvedBy != int64(ids[3]) {
+		t.Fatalf("Resolve() = %+v", resolved)
+	}
+	if got := feed(); len(got.Comments) != 1 {
+		t.Fatalf("dismissed comment still hidden: %+v", got.Comments)
+	}
+
+	queue, err := reports.Queue(ctx, entity.QueryReports{Status: entity.ReportDismissed, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Meta.Total != 2 {
+		t.Fatalf("Queue() of dismissed reports = %+v", queue)
+	}
+}
+
+func TestReportSuspend(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 3)
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPost(dbPool, config)
+	post, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>beli sekarang</p>", Tags: []string{"promo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports := NewReport(dbPool, config)
+	report, err := reports.Add(ctx, entity.Report{ReporterID: int64(ids[1]), TargetType: entity.ReportTargetPost, TargetID: int64(post.Id), Reason: entity.ReportReasonSpam})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mod := entity.Actor{UserID: strconv.Itoa(ids[2]), Role: entity.RoleModerator}
+	resolve := entity.Resolution{Action: entity.ResolveSuspend, Reason: "spam"}
+	if _, err := reports.Resolve(ctx, mod, report.Id, resolve); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if _, err := reports.Resolve(ctx, mod, report.Id, resolve); !errors.Is(err, ErrReportResolved) {
+		t.Fatalf("Resolve() twice error = %v, want %v", err, ErrReportResolved)
+	}
+
+	usr, err := NewAdmin(dbPool, config).UserByCredential(ctx, "user1@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.SuspendedAt == nil {
+		t.Fatalf("author not suspended: %+v", usr)
+	}
+
+	got, err := posts.Get(ctx, entity.QueryGetPosts{UserId: ids[0], Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("feed has the post of a suspended report: %+v", got)
+	}
+
+	var entries int
+	err = dbPool.QueryRow(ctx, `SELECT count(*) FROM audit_log WHERE actor_id = $1 AND action IN ($2, $3)`,
+		ids[2], entity.ActionUserSuspend, entity.ActionReportResolve).Scan(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 2 {
+		t.Errorf("%d audit entries for the resolution, want 2", entries)
+	}
+}
+
+func TestReportDismissKeepsModeratorHide(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.ReportHideThreshold = 1
+	ids := register(t, dbPool, config, 3)
+	ctx := context.Background()
+
+	if err := NewFriend(dbPool, config).AddFriend(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPost(dbPool, config)
+	post, err := posts.Add(ctx, entity.Post{UserID: ids[0], PostInHtml: "<p>beli sekarang</p>", Tags: []string{"promo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports := NewReport(dbPool, config)
+	mod := entity.Actor{UserID: strconv.Itoa(ids[2]), Role: entity.RoleModerator}
+	resolve := func(action string) entity.Report {
+		t.Helper()
+		report, err := reports.Add(ctx, entity.Report{ReporterID: int64(ids[1]), TargetType: entity.ReportTargetPost, TargetID: int64(post.Id), Reason: entity.ReportReasonSpam})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Hidden {
+			t.Fatalf("Add() past the threshold = %+v", report)
+		}
+		resolved, err := reports.Resolve(ctx, mod, report.Id, entity.Resolution{Action: action, Reason: "reviewed"})
+		if err != nil {
+			t.Fatalf("Resolve(%s) error = %v", action, err)
+		}
+		return resolved
+	}
+	hiddenBy := func() *string {
+		t.Helper()
+		var by *string
+		if err := dbPool.QueryRow(ctx, `SELECT hidden_by FROM posts WHERE id = $1`, post.Id).Scan(&by); err != nil {
+			t.Fatal(err)
+		}
+		return by
+	}
+
+	// hidden by its reports, dismissing them shows it again
+	if by := hiddenBy(); by != nil {
+		t.Fatalf("hidden_by before any report = %s", *by)
+	}
+	if resolved := resolve(entity.ResolveDismiss); resolved.Hidden {
+		t.Fatalf("dismissed post still hidden: %+v", resolved)
+	}
+
+	// hidden by a moderator, a later dismissal leaves it hidden
+	resolve(entity.ResolveHide)
+	if by := hiddenBy(); by == nil || *by != hiddenByModerator {
+		t.Fatalf("hidden_by after a moderator hid it = %v", by)
+	}
+	if resolved := resolve(entity.ResolveDismiss); !resolved.Hidden {
+		t.Fatalf("dismissing a report showed what a moderator hid: %+v", resolved)
+	}
+}
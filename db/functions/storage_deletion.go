@@ -0,0 +1,58 @@
+package functions
+
+import (
+	"context"
+	"segokuning/configs"
+	"segokuning/db/entity"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StorageDeletion is the queue of storage objects left behind by deleted accounts.
+type StorageDeletion struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+}
+
+func NewStorageDeletion(dbPool *pgxpool.Pool, config configs.Config) *StorageDeletion {
+	return &StorageDeletion{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// Due returns up to limit objects whose deletion is pending and not backing off.
+func (s *StorageDeletion) Due(ctx context.Context, limit int) ([]entity.StorageDeletion, error) {
+	rows, err := s.dbPool.Query(ctx, `SELECT id, object_key, attempts FROM storage_deletions
+		WHERE deleted_at IS NULL AND not_before <= now()
+		ORDER BY not_before LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []entity.StorageDeletion
+	for rows.Next() {
+		var item entity.StorageDeletion
+		if err := rows.Scan(&item.Id, &item.ObjectKey, &item.Attempts); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func (s *StorageDeletion) MarkDeleted(ctx context.Context, id int64) error {
+	_, err := s.dbPool.Exec(ctx, `UPDATE storage_deletions SET deleted_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// MarkFailed records the error and backs off exponentially, up to an hour between attempts.
+func (s *StorageDeletion) MarkFailed(ctx context.Context, id int64, cause error) error {
+	_, err := s.dbPool.Exec(ctx, `UPDATE storage_deletions SET
+			attempts = attempts + 1,
+			last_error = $2,
+			not_before = now() + make_interval(mins => least(power(2, attempts), 60)::int)
+		WHERE id = $1`, id, cause.Error())
+	return err
+}
@@ -0,0 +1,240 @@
+package functions
+
+import (
+	"context"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"segokuning/internal/cache"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// timelineMode tells whether feeds are read from timelines rather than queried from friendships.
+func timelineMode(config configs.Config) bool {
+	return config.FeedMode == "timeline"
+}
+
+// Timeline keeps the timelines feeds are read from under FEED_MODE=timeline. A post lands in its
+// author's timeline when it's made and in their friends' once FanOut gets to it.
+type Timeline struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+	cache  *feedCache
+}
+
+func NewTimeline(dbPool *pgxpool.Pool, config configs.Config) *Timeline {
+	return &Timeline{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// WithCache drops the cached feeds a fan-out adds posts to from c.
+func (t *Timeline) WithCache(c cache.Cache) *Timeline {
+	t.cache = newFeedCache(c, t.config.CacheTTL)
+	return t
+}
+
+// lockTimelineUsers orders fan-outs and friendship changes: a fan-out holds its authors FOR SHARE
+// and a friendship change both friends FOR NO KEY UPDATE, so a post reaches exactly the friends
+// its author has when it's fanned out and backfills never miss it.
+func lockTimelineUsers(ctx context.Context, tx pgx.Tx, lock string, userIDs ...int) error {
+	_, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = ANY($1) ORDER BY id `+lock, userIDs)
+	return err
+}
+
+// linkTimelines copies the TIMELINE_BACKFILL most recent posts of each of the new friends into the
+// other's timeline.
+func linkTimelines(ctx context.Context, tx pgx.Tx, userID, friendID, backfill int) error {
+	_, err := tx.Exec(ctx, `INSERT INTO timelines (owner_id, post_id, author_id, posted_at)
+		SELECT o.owner_id, p.id, p.user_id, p.created_at
+		FROM (VALUES ($1::bigint, $2::bigint), ($2, $1)) o(owner_id, author_id)
+		CROSS JOIN LATERAL (SELECT id, user_id, created_at FROM posts WHERE user_id = o.author_id
+			ORDER BY created_at DESC LIMIT $3) p
+		ON CONFLICT DO NOTHING`, userID, friendID, backfill)
+	return err
+}
+
+// unlinkTimelines removes the posts of two former friends from each other's timeline.
+func unlinkTimelines(ctx context.Context, tx pgx.Tx, userID, friendID int) error {
+	_, err := tx.Exec(ctx, `DELETE FROM timelines
+		WHERE (owner_id = $1 AND author_id = $2) OR (owner_id = $2 AND author_id = $1)`, userID, friendID)
+	return err
+}
+
+// FanOut writes up to batch queued posts into the timelines of their authors' friends and
+// returns how many it wrote.
+func (t *Timeline) FanOut(ctx context.Context, batch int) (int, error) {
+	conn, err := t.dbPool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT f.post_id, p.user_id FROM timeline_fanouts f
+		JOIN posts p ON p.id = f.post_id
+		ORDER BY f.created_at LIMIT $1 FOR UPDATE OF f SKIP LOCKED`, batch)
+	if err != nil {
+		return 0, err
+	}
+	var postIDs, authors []int
+	for rows.Next() {
+		var postID, author int
+		if err := rows.Scan(&postID, &author); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		postIDs = append(postIDs, postID)
+		authors = append(authors, author)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(postIDs) == 0 {
+		return 0, nil
+	}
+
+	if err := lockTimelineUsers(ctx, tx, "FOR SHARE", authors...); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO timelines (owner_id, post_id, author_id, posted_at)
+		SELECT o.owner_id, p.id, p.user_id, p.created_at FROM posts p
+		CROSS JOIN LATERAL (SELECT p.user_id AS owner_id UNION SELECT friend_id FROM friends WHERE user_id = p.user_id) o
+		WHERE p.id = ANY($1)
+		ON CONFLICT DO NOTHING`, postIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM timeline_fanouts WHERE post_id = ANY($1)`, postIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	t.cache.invalidateFeeds(ctx, t.dbPool, authors...)
+	return len(postIDs), nil
+}
+
+// Rebuild rewrites the timelines of up to batch users with ids after after from their own posts
+// and the TIMELINE_BACKFILL most recent posts of each friend. It returns the last user id it
+// rebuilt, after itself once every user is done.
+func (t *Timeline) Rebuild(ctx context.Context, after, batch int) (int, error) {
+	conn, err := t.dbPool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// locked like a friendship change, the users' friends stay put until they're rebuilt
+	rows, err := tx.Query(ctx, `SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT $2 FOR NO KEY UPDATE`, after, batch)
+	if err != nil {
+		return 0, err
+	}
+	var owners []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		owners = append(owners, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(owners) == 0 {
+		return after, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM timelines WHERE owner_id = ANY($1)`, owners); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO timelines (owner_id, post_id, author_id, posted_at)
+		SELECT o.id, p.id, p.user_id, p.created_at FROM unnest($1::bigint[]) o(id)
+		CROSS JOIN LATERAL (SELECT id, user_id, created_at FROM posts WHERE user_id = o.id
+			UNION ALL
+			SELECT fp.id, fp.user_id, fp.created_at FROM friends f
+			CROSS JOIN LATERAL (SELECT id, user_id, created_at FROM posts WHERE user_id = f.friend_id
+				ORDER BY created_at DESC LIMIT $2) fp
+			WHERE f.user_id = o.id) p`, owners, t.config.TimelineBackfill)
+	if err != nil {
+		return 0, err
+	}
+
+	return owners[len(owners)-1], tx.Commit(ctx)
+}
+
+// Check compares the newest depth posts of the timelines of up to batch users with ids after
+// after against the feed their friendships give, leaving out posts still queued for fan-out. It
+// returns the users whose timeline differs and the last user id it checked, after itself once
+// every user is done. Posts beyond TIMELINE_BACKFILL of a friend may be missing from a timeline
+// by design, depth should not exceed it.
+func (t *Timeline) Check(ctx context.Context, after, batch, depth int) ([]entity.TimelineDrift, int, error) {
+	rows, err := t.dbPool.Query(ctx, `SELECT u.id,
+			ARRAY(SELECT id FROM posts
+				WHERE (user_id = u.id OR user_id IN (SELECT friend_id FROM friends WHERE user_id = u.id))
+				AND id NOT IN (SELECT post_id FROM timeline_fanouts)
+				ORDER BY created_at DESC, id DESC LIMIT $3),
+			ARRAY(SELECT post_id FROM timelines
+				WHERE owner_id = u.id AND post_id NOT IN (SELECT post_id FROM timeline_fanouts)
+				ORDER BY posted_at DESC, post_id DESC LIMIT $3)
+		FROM users u WHERE u.id > $1 ORDER BY u.id LIMIT $2`, after, batch, depth)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var drifts []entity.TimelineDrift
+	last := after
+	for rows.Next() {
+		var (
+			userID         int
+			feed, timeline []int
+		)
+		if err := rows.Scan(&userID, &feed, &timeline); err != nil {
+			return nil, 0, err
+		}
+		last = userID
+
+		drift := entity.TimelineDrift{UserID: userID, Missing: difference(feed, timeline), Extra: difference(timeline, feed)}
+		if len(drift.Missing) > 0 || len(drift.Extra) > 0 {
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, last, rows.Err()
+}
+
+// difference returns the ids of a that aren't in b.
+func difference(a, b []int) []int {
+	in := make(map[int]bool, len(b))
+	for _, id := range b {
+		in[id] = true
+	}
+	var result []int
+	for _, id := range a {
+		if !in[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+package functions
+
+import (
+	"context"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.FeedMode, config.TimelineBackfill = "timeline", 2
+	ids := register(t, dbPool, config, 3)
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	ctx := context.Background()
+
+	posts := NewPost(dbPool, config)
+	friends := NewFriend(dbPool, config)
+	timelines := NewTimeline(dbPool, config)
+
+	add := func(author int, html string) int {
+		t.Helper()
+		post, err := posts.Add(ctx, entity.Post{UserID: author, PostInHtml: html, Tags: []string{"food"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post.Id
+	}
+	feed := func(userID int, want ...int) {
+		t.Helper()
+		query := entity.QueryGetPosts{UserId: userID, Limit: 10}
+		got, err := posts.Get(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := posts.Count(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || count != len(want) {
+			t.Fatalf("feed of %d has %d posts and counts %d, want %v", userID, len(got), count, want)
+		}
+		for i, post := range got {
+			if post.Id != want[i] {
+				t.Fatalf("feed of %d: post %d is %d, want %v", userID, i, post.Id, want)
+			}
+		}
+	}
+	fanOut := func(want int) {
+		t.Helper()
+		n, err := timelines.FanOut(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("FanOut() = %d, want %d", n, want)
+		}
+	}
+	check := func(wantDrifted ...int) {
+		t.Helper()
+		drifts, _, err := timelines.Check(ctx, 0, 10, config.TimelineBackfill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != len(wantDrifted) {
+			t.Fatalf("Check() = %+v, want drift for %v", drifts, wantDrifted)
+		}
+		for i, d := range drifts {
+			if d.UserID != wantDrifted[i] {
+				t.Fatalf("Check() = %+v, want drift for %v", drifts, wantDrifted)
+			}
+		}
+	}
+
+	bob1, bob2, bob3 := add(bob, "<p>soto ayam</p>"), add(bob, "<p>bakso</p>"), add(bob, "<p>rendang</p>")
+	fanOut(3)
+
+	if err := friends.AddFriend(ctx, alice, bob); err != nil {
+		t.Fatal(err)
+	}
+	// backfilled with bob's two most recent posts
+	feed(alice, bob3, bob2)
+	feed(bob, bob3, bob2, bob1)
+
+	alice1 := add(alice, "<p>nasi goreng</p>")
+	feed(alice, alice1, bob3, bob2)
+	feed(bob, bob3, bob2, bob1)
+	fanOut(1)
+	feed(bob, alice1, bob3, bob2, bob1)
+	check()
+
+	if err := friends.AddFriend(ctx, carol, bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbPool.Exec(ctx, `DELETE FROM timelines WHERE owner_id = $1`, carol); err != nil {
+		t.Fatal(err)
+	}
+	check(carol)
+
+	last, err := timelines.Rebuild(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != carol {
+		t.Fatalf("Rebuild() = %d, want the last user %d", last, carol)
+	}
+	if last, err := timelines.Rebuild(ctx, last, 10); err != nil || last != carol {
+		t.Fatalf("Rebuild() past the last user = %d, %v", last, err)
+	}
+	check()
+	feed(carol, bob3, bob2)
+
+	if err := friends.DeleteFriend(ctx, bob, alice); err != nil {
+		t.Fatal(err)
+	}
+	feed(alice, alice1)
+	feed(bob, bob3, bob2, bob1)
+	check()
+}
@@ -0,0 +1,28 @@
+package functions
+
+import (
+	"context"
+	"segokuning/configs"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Upload records who uploaded each storage object, account erasure and export only touch the
+// objects of the account.
+type Upload struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+}
+
+func NewUpload(dbPool *pgxpool.Pool, config configs.Config) *Upload {
+	return &Upload{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// Add records that userID uploaded the object stored under key.
+func (u *Upload) Add(ctx context.Context, userID, key string) error {
+	_, err := u.dbPool.Exec(ctx, `INSERT INTO uploads (object_key, user_id) VALUES ($1, $2)`, key, userID)
+	return err
+}
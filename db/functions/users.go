@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"segokuning/configs"
 	"segokuning/db/entity"
+	"segokuning/internal/cache"
+	"segokuning/internal/logging"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,6 +20,10 @@ import (
 type User struct {
 	config configs.Config
 	dbPool *pgxpool.Pool
+	cache  *feedCache
+
+	dummyOnce sync.Once
+	dummy     string
 }
 
 func NewUser(dbPool *pgxpool.Pool, config configs.Config) *User {
@@ -24,6 +33,13 @@ func NewUser(dbPool *pgxpool.Pool, config configs.Config) *User {
 	}
 }
 
+// WithCache drops a user's cached creator and the feeds showing it from c when they update
+// their account.
+func (u *User) WithCache(c cache.Cache) *User {
+	u.cache = newFeedCache(c, u.config.CacheTTL)
+	return u
+}
+
 func (u *User) Register(ctx context.Context, usr entity.User) (entity.User, error) {
 	conn, err := u.dbPool.Acquire(ctx)
 	if err != nil {
@@ -37,14 +53,9 @@ func (u *User) Register(ctx context.Context, usr entity.User) (entity.User, erro
 		return entity.User{}, err
 	}
 
-	var existingId string
-	var sql string
-
-	sql = fmt.Sprintf(`SELECT id FROM users WHERE %s = $1`, usr.CredentialType)
-
-	err = conn.QueryRow(ctx, sql, usr.CredentialValue).Scan(&existingId)
-	if existingId != "" {
-		return entity.User{}, errors.New("EXISTING_USERNAME")
+	column, err := credentialColumn(usr.CredentialType)
+	if err != nil {
+		return entity.User{}, err
 	}
 
 	tx, err := conn.Begin(ctx)
@@ -54,12 +65,31 @@ func (u *User) Register(ctx context.Context, usr entity.User) (entity.User, erro
 	}
 	defer tx.Rollback(ctx)
 
-	sql = fmt.Sprintf(`INSERT INTO users (name, %s, password) VALUES ($1, $2, $3) RETURNING id, name, phone, email`, usr.CredentialType)
+	// a value left unverified past the grace period no longer holds its claim
+	if err := releaseStaleClaim(ctx, tx, column, usr.CredentialValue, u.config.VerificationGracePeriod); err != nil {
+		return entity.User{}, err
+	}
+
+	var existingId string
+	var sql string
+
+	sql = fmt.Sprintf(`SELECT id FROM users WHERE %s = $1`, column)
 
-	err = tx.QueryRow(ctx, sql, usr.Name, usr.CredentialValue, string(hashedPassword)).Scan(&usr.Id, &usr.Name, &usr.Phone, &usr.Email)
+	err = tx.QueryRow(ctx, sql, usr.CredentialValue).Scan(&existingId)
+	if existingId != "" {
+		return entity.User{}, ErrExistingUsername
+	}
+
+	sql = fmt.Sprintf(`INSERT INTO users (name, %[1]s, %[1]s_linked_at, password) VALUES ($1, $2, now(), $3) RETURNING id, name, phone, email, token_version, role`, column)
+
+	err = tx.QueryRow(ctx, sql, usr.Name, usr.CredentialValue, string(hashedPassword)).Scan(&usr.Id, &usr.Name, &usr.Phone, &usr.Email, &usr.TokenVersion, &usr.Role)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return entity.User{}, errors.New("USER_NOT_FOUND")
+			return entity.User{}, ErrUserNotFound
+		}
+		// registered concurrently since the check above
+		if isUniqueViolation(err) {
+			return entity.User{}, ErrExistingUsername
 		}
 		return entity.User{}, err
 	}
@@ -90,25 +120,286 @@ func (u *User) Login(ctx context.Context, usr entity.User) (entity.User, error)
 	var result entity.User
 	var sql string
 
-	sql = fmt.Sprintf(`SELECT id, name, phone, email name, password FROM users WHERE %s = $1`, usr.CredentialType)
+	column, err := credentialColumn(usr.CredentialType)
+	if err != nil {
+		return result, err
+	}
+
+	var (
+		linkedAt      *time.Time
+		deactivatedAt *time.Time
+		session       entity.Session
+	)
+	sql = fmt.Sprintf(`SELECT id, name, phone, email, password, token_version, role, email_verified_at, phone_verified_at, %s_linked_at,
+		account_status(status, suspended_until), suspended_until, deactivated_at FROM users WHERE %s = $1`, column, column)
 	err = conn.QueryRow(ctx, sql, usr.CredentialValue).Scan(
-		&result.Id, &result.Name, &result.Phone, &result.Email, &result.Password,
+		&result.Id, &result.Name, &result.Phone, &result.Email, &result.Password, &result.TokenVersion, &result.Role,
+		&result.EmailVerifiedAt, &result.PhoneVerifiedAt, &linkedAt, &session.Status, &session.SuspendedUntil, &deactivatedAt,
 	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return result, errors.New("USER_NOT_FOUND")
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return result, err
+	}
+
+	// past the retention window the account is as good as erased, the purge just hasn't run yet
+	userFound := err == nil && !(session.Status == entity.StatusDeactivated && u.pastRetention(deactivatedAt))
+	if !userFound {
+		result.Id = ""
+	}
+
+	// a locked credential is refused before the password is even checked
+	var lockedUntil *time.Time
+	err = conn.QueryRow(ctx, `SELECT locked_until FROM login_failures WHERE credential_type = $1 AND credential_value = $2`,
+		usr.CredentialType, usr.CredentialValue).Scan(&lockedUntil)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return entity.User{}, err
+	}
+	if lockedUntil != nil && lockedUntil.After(time.Now()) {
+		if err := loginFailed(ctx, conn, usr, result.Id, "locked"); err != nil {
+			return entity.User{}, err
+		}
+		return entity.User{}, ErrAccountLocked
+	}
+
+	// Compare the provided password with the hashed password from the database,
+	// unknown users are compared against a dummy hash so both cases take as long
+	hash := result.Password
+	if !userFound {
+		hash = u.dummyHash()
+	}
+	passwordErr := bcrypt.CompareHashAndPassword([]byte(hash), []byte(usr.Password))
+	if !userFound || passwordErr != nil {
+		if err := u.wrongPassword(ctx, conn, usr, result.Id); err != nil {
+			return entity.User{}, err
+		}
+		return entity.User{}, ErrInvalidCredentials
 	}
+
+	_, err = conn.Exec(ctx, `DELETE FROM login_failures WHERE credential_type = $1 AND credential_value = $2`,
+		usr.CredentialType, usr.CredentialValue)
 	if err != nil {
-		return result, err
+		return entity.User{}, err
+	}
+
+	u.upgradeHash(ctx, conn, result.Id, result.Password, usr.Password)
+
+	verifiedAt := result.EmailVerifiedAt
+	if column == "phone" {
+		verifiedAt = result.PhoneVerifiedAt
+	}
+	if verifiedAt == nil && u.pastGracePeriod(linkedAt) {
+		if err := loginFailed(ctx, conn, usr, result.Id, "unverified"); err != nil {
+			return entity.User{}, err
+		}
+		return entity.User{}, ErrCredentialNotVerified
+	}
+
+	// only told after the password is right, strangers learn nothing about the account
+	if session.Suspended(time.Now()) {
+		if err := loginFailed(ctx, conn, usr, result.Id, "suspended"); err != nil {
+			return entity.User{}, err
+		}
+		return entity.User{}, &SuspendedError{Until: session.SuspendedUntil}
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.User{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// logging in within the retention window brings a deactivated account back
+	reactivated := session.Status == entity.StatusDeactivated
+	if reactivated {
+		_, err = tx.Exec(ctx, `UPDATE users SET status = 'active', deactivated_at = NULL WHERE id = $1 AND status = 'deactivated'`, result.Id)
+		if err != nil {
+			return entity.User{}, err
+		}
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, result.Id), entity.ActionLogin, "user", result.Id, map[string]interface{}{
+		"credentialType": usr.CredentialType,
+		"reactivated":    reactivated,
+	})
+	if err != nil {
+		return entity.User{}, err
 	}
 
-	// Compare the provided password with the hashed password from the database
-	if err := bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(usr.Password)); err != nil {
-		return result, errors.New("INVALID_PASSWORD")
+	if err := tx.Commit(ctx); err != nil {
+		return entity.User{}, err
 	}
 
 	return result, nil
 }
 
+// wrongPassword counts and audits a login with a wrong password or an unknown credential.
+func (u *User) wrongPassword(ctx context.Context, conn *pgxpool.Conn, usr entity.User, userID string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := recordLoginFailure(ctx, tx, u.config, usr); err != nil {
+		return err
+	}
+	if err := loginFailed(ctx, tx, usr, userID, "password"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// loginFailed audits a refused login on the account userID, or on the credential when it
+// belongs to no account.
+func loginFailed(ctx context.Context, db execer, usr entity.User, userID, reason string) error {
+	targetType, targetID := "user", userID
+	if userID == "" {
+		targetType, targetID = "credential", usr.CredentialValue
+	}
+	return audit(ctx, db, OriginActor(ctx, ""), entity.ActionLoginFailed, targetType, targetID, map[string]interface{}{
+		"credentialType": usr.CredentialType,
+		"reason":         reason,
+	})
+}
+
+// recordLoginFailure counts a failed login and locks the credential once it reaches LoginMaxFailures
+// within LoginLockout. Older failures fall out of the window and restart the count.
+func recordLoginFailure(ctx context.Context, tx pgx.Tx, config configs.Config, usr entity.User) error {
+	window := config.LoginLockout.Seconds()
+
+	var failedCount int
+	err := tx.QueryRow(ctx, `INSERT INTO login_failures AS lf (credential_type, credential_value, failed_count, last_failed_at)
+		VALUES ($1, $2, 1, now())
+		ON CONFLICT (credential_type, credential_value) DO UPDATE SET
+			failed_count = CASE WHEN lf.last_failed_at < now() - make_interval(secs => $3) THEN 1 ELSE lf.failed_count + 1 END,
+			last_failed_at = now()
+		RETURNING failed_count`, usr.CredentialType, usr.CredentialValue, window).Scan(&failedCount)
+	if err != nil {
+		return err
+	}
+
+	if config.LoginMaxFailures <= 0 || failedCount < config.LoginMaxFailures {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE login_failures SET failed_count = 0, locked_until = now() + make_interval(secs => $3)
+		WHERE credential_type = $1 AND credential_value = $2`, usr.CredentialType, usr.CredentialValue, window)
+	return err
+}
+
+// confirmPassword checks in tx the password a logged in user gives again before changing it or
+// giving up the account, hash being what's stored for userID. A stolen token must not guess it for
+// free: a locked account is refused before the password is checked, and a wrong one returns
+// ErrWrongPassword for the caller to roll back and count with recordWrongPassword.
+func confirmPassword(ctx context.Context, tx pgx.Tx, userID, hash, password string) error {
+	var locked bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM login_failures lf JOIN users u ON u.id = $1
+		WHERE lf.locked_until > now()
+		AND ((lf.credential_type = 'email' AND lf.credential_value = u.email)
+		OR (lf.credential_type = 'phone' AND lf.credential_value = u.phone)))`, userID).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrAccountLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// recordWrongPassword counts a wrong password confirmPassword refused as a failed login on every
+// credential of userID and returns ErrWrongPassword. It takes a connection of its own, callers
+// release theirs first so a request never holds two and a full pool can't deadlock.
+func recordWrongPassword(ctx context.Context, dbPool *pgxpool.Pool, config configs.Config, userID string) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var email, phone *string
+	if err := tx.QueryRow(ctx, `SELECT email, phone FROM users WHERE id = $1`, userID).Scan(&email, &phone); err != nil {
+		return err
+	}
+	for credentialType, value := range map[string]*string{"email": email, "phone": phone} {
+		if value == nil {
+			continue
+		}
+		if err := recordLoginFailure(ctx, tx, config, entity.User{CredentialType: credentialType, CredentialValue: *value}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return ErrWrongPassword
+}
+
+// releaseStaleClaim frees value from an account that linked it but never verified it within
+// gracePeriod, in the tx that goes on to claim it. An account keeps a value that is its only
+// credential, without it the account could neither log in nor reset its password.
+func releaseStaleClaim(ctx context.Context, tx pgx.Tx, column, value string, gracePeriod time.Duration) error {
+	other := "phone"
+	if column == "phone" {
+		other = "email"
+	}
+	sql := fmt.Sprintf(`UPDATE users SET %[1]s = NULL, %[1]s_linked_at = NULL
+		WHERE %[1]s = $1 AND %[1]s_verified_at IS NULL AND %[1]s_linked_at < now() - make_interval(secs => $2)
+		AND %[2]s IS NOT NULL
+		RETURNING id::text`, column, other)
+	var released string
+	err := tx.QueryRow(ctx, sql, value, gracePeriod.Seconds()).Scan(&released)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the account losing the value sees it on its activity, not who claimed it nor from where
+	return audit(ctx, tx, entity.Actor{}, entity.ActionCredentialReleased, "user", released,
+		change(map[string]interface{}{column: value}, map[string]interface{}{column: nil}))
+}
+
+func (u *User) pastRetention(deactivatedAt *time.Time) bool {
+	return deactivatedAt != nil && time.Since(*deactivatedAt) > u.config.DeactivationRetention
+}
+
+func (u *User) pastGracePeriod(linkedAt *time.Time) bool {
+	return linkedAt != nil && time.Since(*linkedAt) > u.config.VerificationGracePeriod
+}
+
+// upgradeHash rehashes a password stored below the configured cost. It runs after a successful login,
+// the only time the plain password is known, and a failure leaves the old hash in place.
+func (u *User) upgradeHash(ctx context.Context, conn *pgxpool.Conn, userID, hash, password string) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost >= u.config.BcryptSalt {
+		return
+	}
+
+	upgraded, err := bcrypt.GenerateFromPassword([]byte(password), u.config.BcryptSalt)
+	if err == nil {
+		// matching the old hash keeps a concurrent password change from being overwritten
+		_, err = conn.Exec(ctx, `UPDATE users SET password = $1 WHERE id = $2 AND password = $3`, string(upgraded), userID, hash)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed upgrade password hash", "user_id", userID, "error", err)
+	}
+}
+
+// dummyHash is compared against when the credential is unknown, hashed once at the configured cost.
+func (u *User) dummyHash() string {
+	u.dummyOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("segokuning-dummy-password"), u.config.BcryptSalt)
+		if err == nil {
+			u.dummy = string(hash)
+		}
+	})
+	return u.dummy
+}
+
 func (u *User) GetUserById(ctx context.Context, userID string) (entity.User, error) {
 	conn, err := u.dbPool.Acquire(ctx)
 	if err != nil {
@@ -129,6 +420,93 @@ func (u *User) GetUserById(ctx context.Context, userID string) (entity.User, err
 	return result, nil
 }
 
+// Session returns the token version the user's access tokens must carry and the status of the account.
+func (u *User) Session(ctx context.Context, userID string) (entity.Session, error) {
+	var session entity.Session
+	err := u.dbPool.QueryRow(ctx, `SELECT token_version, account_status(status, suspended_until), suspended_until
+		FROM users WHERE id = $1`, userID).Scan(&session.TokenVersion, &session.Status, &session.SuspendedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Session{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.Session{}, err
+	}
+	return session, nil
+}
+
+// ChangePassword replaces the password after checking the current one. Bumping the token version
+// signs out every other session, the caller issues a fresh token from the returned user, whose
+// credential is the email or, without one, the phone. A wrong password counts toward the login
+// lockout, see confirmPassword.
+func (u *User) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) (entity.User, error) {
+	result, err := u.changePassword(ctx, userID, currentPassword, newPassword)
+	if errors.Is(err, ErrWrongPassword) {
+		return entity.User{}, recordWrongPassword(ctx, u.dbPool, u.config, userID)
+	}
+	return result, err
+}
+
+func (u *User) changePassword(ctx context.Context, userID, currentPassword, newPassword string) (entity.User, error) {
+	conn, err := u.dbPool.Acquire(ctx)
+	if err != nil {
+		return entity.User{}, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.User{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// locked so a concurrent change checks the current password against what this one leaves
+	var hash string
+	err = tx.QueryRow(ctx, `SELECT password FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if err := confirmPassword(ctx, tx, userID, hash, currentPassword); err != nil {
+		return entity.User{}, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), u.config.BcryptSalt)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	var result entity.User
+	err = tx.QueryRow(ctx, `UPDATE users SET password = $1, password_changed_at = now(), token_version = token_version + 1
+		WHERE id = $2 RETURNING id, name, phone, email, token_version, role,
+			CASE WHEN email IS NOT NULL THEN 'email' ELSE 'phone' END, COALESCE(email, phone)`, string(hashedPassword), userID,
+	).Scan(&result.Id, &result.Name, &result.Phone, &result.Email, &result.TokenVersion, &result.Role,
+		&result.CredentialType, &result.CredentialValue)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	// a pending reset would otherwise undo the change
+	_, err = tx.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionPasswordChange, "user", userID, nil)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return result, nil
+}
+
 func (u *User) UpdateEmail(ctx context.Context, userID string, email string) (entity.User, error) {
 	conn, err := u.dbPool.Acquire(ctx)
 	if err != nil {
@@ -138,26 +516,59 @@ func (u *User) UpdateEmail(ctx context.Context, userID string, email string) (en
 
 	var result entity.User
 
-	// Check if the email already exists
-	var existingEmail *string
-	err = conn.QueryRow(ctx, `SELECT email FROM users WHERE email = $1`, email).Scan(&existingEmail)
-	if existingEmail != nil {
-		return result, errors.New("EMAIL_EXISTS")
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return result, err
 	}
-	// Check if the user already has an email
-	err = conn.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&existingEmail)
-	if existingEmail != nil {
-		return result, errors.New("EMAIL_ALREADY_SET")
+	defer tx.Rollback(ctx)
+
+	// the user's row is locked first, the audit entry keeps what was replaced
+	var oldEmail *string
+	err = tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&oldEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, ErrUserNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+	if oldEmail != nil {
+		return result, ErrEmailAlreadySet
+	}
+
+	if err := releaseStaleClaim(ctx, tx, "email", email, u.config.VerificationGracePeriod); err != nil {
+		return result, err
+	}
+
+	var taken bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&taken); err != nil {
+		return result, err
+	}
+	if taken {
+		return result, ErrEmailExists
 	}
 
 	// If no errors, proceed to update the email
-	err = conn.QueryRow(ctx, `UPDATE users SET email = $1 WHERE id = $2 RETURNING id, name, phone, email`, email, userID).Scan(&result.Id, &result.Name, &result.CredentialType, &result.CredentialValue)
+	err = tx.QueryRow(ctx, `UPDATE users SET email = $1, email_linked_at = now(), email_verified_at = NULL WHERE id = $2 RETURNING id, name, phone, email`, email, userID).Scan(&result.Id, &result.Name, &result.Phone, &result.Email)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return result, errors.New("USER_NOT_FOUND")
+		return result, ErrUserNotFound
+	}
+	// linked concurrently since the check above
+	if isUniqueViolation(err) {
+		return result, ErrEmailExists
 	}
 	if err != nil {
 		return result, err
 	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionEmailUpdate, "user", userID,
+		change(map[string]interface{}{"email": oldEmail}, map[string]interface{}{"email": email}))
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return entity.User{}, err
+	}
 	return result, nil
 }
 
@@ -170,27 +581,59 @@ func (u *User) UpdatePhone(ctx context.Context, userID string, phone string) (en
 
 	var result entity.User
 
-	// Check if the phone already exists
-	var existingPhone string
-	err = conn.QueryRow(ctx, `SELECT phone FROM users WHERE phone = $1`, phone).Scan(&existingPhone)
-	if err == nil {
-		return result, errors.New("PHONE_EXISTS") // Returning 409 error
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return result, err
 	}
+	defer tx.Rollback(ctx)
 
-	// Check if the user already has a phone
-	err = conn.QueryRow(ctx, `SELECT phone FROM users WHERE id = $1`, userID).Scan(&existingPhone)
-	if err == nil {
-		return result, errors.New("PHONE_ALREADY_SET") // Returning 400 error
+	// the user's row is locked first, the audit entry keeps what was replaced
+	var oldPhone *string
+	err = tx.QueryRow(ctx, `SELECT phone FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&oldPhone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, ErrUserNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+	if oldPhone != nil {
+		return result, ErrPhoneAlreadySet // Returning 400 error
+	}
+
+	if err := releaseStaleClaim(ctx, tx, "phone", phone, u.config.VerificationGracePeriod); err != nil {
+		return result, err
+	}
+
+	var taken bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE phone = $1)`, phone).Scan(&taken); err != nil {
+		return result, err
+	}
+	if taken {
+		return result, ErrPhoneExists // Returning 409 error
 	}
 
 	// If no errors, proceed to update the phone
-	err = conn.QueryRow(ctx, `UPDATE users SET phone = $1 WHERE id = $2 RETURNING id, name, phone, email`, phone, userID).Scan(&result.Id, &result.Name, &result.CredentialType, &result.CredentialValue)
+	err = tx.QueryRow(ctx, `UPDATE users SET phone = $1, phone_linked_at = now(), phone_verified_at = NULL WHERE id = $2 RETURNING id, name, phone, email`, phone, userID).Scan(&result.Id, &result.Name, &result.Phone, &result.Email)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return result, errors.New("USER_NOT_FOUND")
+		return result, ErrUserNotFound
+	}
+	// linked concurrently since the check above
+	if isUniqueViolation(err) {
+		return result, ErrPhoneExists
 	}
 	if err != nil {
 		return result, err
 	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionPhoneUpdate, "user", userID,
+		change(map[string]interface{}{"phone": oldPhone}, map[string]interface{}{"phone": phone}))
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return entity.User{}, err
+	}
 	return result, nil
 }
 
@@ -201,14 +644,45 @@ func (u *User) UpdateAccount(ctx context.Context, userID, name, imageURL string)
 	}
 	defer conn.Release()
 
-	var result entity.User
+	var (
+		result      entity.User
+		oldName     string
+		oldImageURL *string
+	)
 
-	err = conn.QueryRow(ctx, `UPDATE users SET name = $1, image_url = $2 WHERE id = $3 RETURNING id, phone, email`, name, imageURL, userID).Scan(&result.Id, &result.Phone, &result.Email)
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	// old is read before the update, the audit entry keeps what was replaced
+	err = tx.QueryRow(ctx, `UPDATE users u SET name = $1, image_url = $2
+		FROM (SELECT name, image_url FROM users WHERE id = $3 FOR UPDATE) old
+		WHERE u.id = $3 RETURNING u.id, u.phone, u.email, old.name, old.image_url`, name, imageURL, userID,
+	).Scan(&result.Id, &result.Phone, &result.Email, &oldName, &oldImageURL)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return result, errors.New("USER_NOT_FOUND")
+		return result, ErrUserNotFound
 	}
 	if err != nil {
 		return result, err
 	}
+
+	err = audit(ctx, tx, OriginActor(ctx, userID), entity.ActionAccountUpdate, "user", userID, change(
+		map[string]interface{}{"name": oldName, "imageUrl": oldImageURL},
+		map[string]interface{}{"name": name, "imageUrl": imageURL},
+	))
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return entity.User{}, err
+	}
+
+	if id, err := strconv.Atoi(userID); err == nil {
+		u.cache.invalidateUser(ctx, id)
+		u.cache.invalidateFeeds(ctx, u.dbPool, id)
+	}
 	return result, nil
 }
@@ -3,126 +3,319 @@ package functions
 import (
 	"context"
 	"errors"
-	"log"
-	"segokuning/configs"
-	"segokuning/db/connections"
+	"fmt"
+	"segokuning/db/dbtest"
 	"segokuning/db/entity"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// MockPool implements pgxpool.Pool interface for testing purposes.
-type MockPool struct{}
+func TestRegister(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	user := NewUser(dbPool, config)
+
+	usr := entity.User{
+		Name:            "John Doe",
+		CredentialType:  "email",
+		CredentialValue: "john@example.com",
+		Password:        "password123",
+	}
+
+	tests := []struct {
+		name    string
+		usr     entity.User
+		wantErr error
+	}{
+		{"new user", usr, nil},
+		{"same email", entity.User{Name: "Jane Doe", CredentialType: "email", CredentialValue: usr.CredentialValue, Password: "password123"}, ErrExistingUsername},
+		{"same name, other email", entity.User{Name: usr.Name, CredentialType: "email", CredentialValue: "john.doe@example.com", Password: "password123"}, nil},
+		{"unknown credential type", entity.User{Name: "Jane Doe", CredentialType: "fax", CredentialValue: "123", Password: "password123"}, ErrInvalidCredentialType},
+	}
 
-func (mp *MockPool) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
-	return nil, nil // Implement this if needed for your tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := user.Register(context.Background(), tt.usr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && created.Id == "" {
+				t.Error("Expected user ID to be set, got an empty string")
+			}
+		})
+	}
 }
 
-func (mp *MockPool) Close() {}
+func TestRegisterConcurrently(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	user := NewUser(dbPool, config)
 
-func TestRegister(t *testing.T) {
-	// Mocking dependencies
-	config, err := configs.LoadConfig()
-	if err != nil {
-		log.Fatal("Cannot load config:", err)
+	const attempts = 8
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, attempts)
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = user.Register(context.Background(), entity.User{
+				Name:            fmt.Sprintf("racer%d", i),
+				CredentialType:  "email",
+				CredentialValue: "race@example.com",
+				Password:        "password123",
+			})
+		}(i)
 	}
+	wg.Wait()
 
-	mockPool, err := connections.NewPgConn(config)
-	if err != nil {
-		t.Fatalf("Failed to connect to the database: %v", err)
+	registered := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			registered++
+		case !errors.Is(err, ErrExistingUsername):
+			t.Errorf("Register() error = %v, want nil or %v", err, ErrExistingUsername)
+		}
+	}
+	if registered != 1 {
+		t.Fatalf("%d registrations succeeded, want exactly 1", registered)
 	}
-	defer mockPool.Close()
 
-	mockConfig := configs.Config{} // You might need to fill this with necessary fields for testing
+	var count int
+	if err := dbPool.QueryRow(context.Background(), `SELECT count(*) FROM users WHERE email = 'race@example.com'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("%d users hold the email, want 1", count)
+	}
+}
 
-	// Creating user instance
-	user := NewUser(mockPool, mockConfig)
+func TestLogin(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	user := NewUser(dbPool, config)
 
-	// Test case 1: Registering a new user successfully
-	usr := entity.User{
+	registered := entity.User{
 		Name:            "John Doe",
 		CredentialType:  "email",
 		CredentialValue: "john@example.com",
 		Password:        "password123",
 	}
-	createdUser, err := user.Register(context.Background(), usr)
-	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
+	if _, err := user.Register(context.Background(), registered); err != nil {
+		t.Fatalf("Failed to register: %v", err)
 	}
-	if createdUser.Id == "" {
-		t.Error("Expected user ID to be set, got an empty string")
+
+	tests := []struct {
+		name     string
+		value    string
+		password string
+		wantErr  error
+	}{
+		{"correct password", registered.CredentialValue, registered.Password, nil},
+		{"unknown user", "nonexisting@example.com", "password123", ErrInvalidCredentials},
+		{"wrong password", registered.CredentialValue, "incorrectpassword", ErrInvalidCredentials},
 	}
 
-	// Test case 2: Registering with an existing username
-	existingUser := entity.User{
-		Name:            "Jane Doe",
-		CredentialType:  "email",
-		CredentialValue: "jane@example.com",
-		Password:        "password123",
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := user.Login(context.Background(), entity.User{
+				CredentialType:  "email",
+				CredentialValue: tt.value,
+				Password:        tt.password,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.Id == "" {
+				t.Error("Expected user ID to be set, got an empty string")
+			}
+		})
 	}
-	_, err = user.Register(context.Background(), existingUser)
-	if !errors.Is(err, errors.New("EXISTING_USERNAME")) {
-		t.Errorf("Expected error 'EXISTING_USERNAME', got %v", err)
+}
+
+func TestLoginLockout(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.LoginMaxFailures = 3
+	user := NewUser(dbPool, config)
+	ctx := context.Background()
+
+	register(t, dbPool, config, 1)
+	login := func(value, password string) error {
+		_, err := user.Login(ctx, entity.User{CredentialType: "email", CredentialValue: value, Password: password})
+		return err
 	}
+	failures := func(value string) (count int, locked bool) {
+		t.Helper()
+		err := dbPool.QueryRow(ctx, `SELECT failed_count, COALESCE(locked_until > now(), false) FROM login_failures
+			WHERE credential_type = 'email' AND credential_value = $1`, value).Scan(&count, &locked)
+		if err != nil {
+			t.Fatalf("read login failures of %s: %v", value, err)
+		}
+		return count, locked
+	}
+
+	t.Run("locks after max failures", func(t *testing.T) {
+		for i := 0; i < config.LoginMaxFailures; i++ {
+			if err := login("user1@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("failure %d error = %v, want %v", i+1, err, ErrInvalidCredentials)
+			}
+		}
+		if _, locked := failures("user1@example.com"); !locked {
+			t.Fatal("credential not locked after max failures")
+		}
+		// the right password doesn't get through a lock
+		if err := login("user1@example.com", "password123"); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("Login() while locked error = %v, want %v", err, ErrAccountLocked)
+		}
+
+		if _, err := dbPool.Exec(ctx, `UPDATE login_failures SET locked_until = now() - interval '1 second'`); err != nil {
+			t.Fatal(err)
+		}
+		if err := login("user1@example.com", "password123"); err != nil {
+			t.Fatalf("Login() after the lock ran out error = %v", err)
+		}
+		var rows int
+		if err := dbPool.QueryRow(ctx, `SELECT count(*) FROM login_failures`).Scan(&rows); err != nil || rows != 0 {
+			t.Fatalf("%d login failures left after a successful login, %v", rows, err)
+		}
+	})
+
+	t.Run("window reset", func(t *testing.T) {
+		for i := 0; i < config.LoginMaxFailures-1; i++ {
+			if err := login("user1@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatal(err)
+			}
+		}
+		_, err := dbPool.Exec(ctx, `UPDATE login_failures SET last_failed_at = now() - make_interval(secs => $1) - interval '1 minute'`,
+			config.LoginLockout.Seconds())
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	// Additional test cases can be added as needed
+		// failures older than the window don't count towards the lock
+		if err := login("user1@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal(err)
+		}
+		if count, locked := failures("user1@example.com"); count != 1 || locked {
+			t.Fatalf("after the window failed_count = %d locked = %v, want 1 and unlocked", count, locked)
+		}
+		if err := login("user1@example.com", "password123"); err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		for i := 0; i < config.LoginMaxFailures; i++ {
+			if err := login("nobody@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("failure %d error = %v, want %v", i+1, err, ErrInvalidCredentials)
+			}
+		}
+		// locked like a real account, so a lock doesn't tell which credentials exist
+		if err := login("nobody@example.com", "password123"); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("Login() error = %v, want %v", err, ErrAccountLocked)
+		}
+
+		var entries int
+		err := dbPool.QueryRow(ctx, `SELECT count(*) FROM audit_log WHERE action = $1 AND target_type = 'credential' AND target_id = $2`,
+			entity.ActionLoginFailed, "nobody@example.com").Scan(&entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries != config.LoginMaxFailures+1 {
+			t.Fatalf("%d failed logins audited on the credential, want %d", entries, config.LoginMaxFailures+1)
+		}
+	})
 }
 
-func TestLogin(t *testing.T) {
-	// Mocking dependencies
-	config, err := configs.LoadConfig()
-	if err != nil {
-		log.Fatal("Cannot load config:", err)
-	}
+func TestChangePasswordLockout(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.LoginMaxFailures = 2
+	ids := register(t, dbPool, config, 1)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
 
-	mockPool, err := connections.NewPgConn(config)
+	// counting a wrong password must not need a second connection while the first is held
+	poolConfig := dbPool.Config()
+	poolConfig.MaxConns = 1
+	single, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		t.Fatalf("Failed to connect to the database: %v", err)
+		t.Fatal(err)
 	}
-	defer mockPool.Close()
+	defer single.Close()
+	user := NewUser(single, config)
 
-	mockConfig := configs.Config{} // You might need to fill this with necessary fields for testing
+	for i := 0; i < config.LoginMaxFailures; i++ {
+		if _, err := user.ChangePassword(ctx, userID, "wrong-password", "new-password123"); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("wrong password %d error = %v, want %v", i+1, err, ErrWrongPassword)
+		}
+	}
 
-	// Creating user instance
-	user := NewUser(mockPool, mockConfig)
+	// a stolen token can't keep guessing, and the account's logins are locked along with it
+	if _, err := user.ChangePassword(ctx, userID, "password123", "new-password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("ChangePassword() while locked error = %v, want %v", err, ErrAccountLocked)
+	}
+	login := entity.User{CredentialType: "email", CredentialValue: "user1@example.com", Password: "password123"}
+	if _, err := user.Login(ctx, login); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Login() while locked error = %v, want %v", err, ErrAccountLocked)
+	}
 
-	// Test case 1: Logging in with existing user and correct password
-	existingUser := entity.User{
-		CredentialType:  "email",
-		CredentialValue: "john@example.com",
-		Password:        "password123",
+	if _, err := dbPool.Exec(ctx, `UPDATE login_failures SET locked_until = now() - interval '1 second'`); err != nil {
+		t.Fatal(err)
 	}
-	result, err := user.Login(context.Background(), existingUser)
+	changed, err := user.ChangePassword(ctx, userID, "password123", "new-password123")
 	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
+		t.Fatalf("ChangePassword() after the lock ran out error = %v", err)
 	}
-
-	if result.Id == "" {
-		t.Error("Expected user ID to be set, got an empty string")
+	// the fresh token is issued for this credential
+	if changed.CredentialType != "email" || changed.CredentialValue != "user1@example.com" {
+		t.Errorf("ChangePassword() credential = %s %q, want email user1@example.com", changed.CredentialType, changed.CredentialValue)
 	}
+}
 
-	// Test case 2: Logging in with non-existing user
-	nonExistingUser := entity.User{
-		CredentialType:  "email",
-		CredentialValue: "nonexisting@example.com",
-		Password:        "password123",
+func TestLoginUpgradesHash(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 1)
+	ctx := context.Background()
+
+	cost := func() int {
+		t.Helper()
+		var hash string
+		if err := dbPool.QueryRow(ctx, `SELECT password FROM users WHERE id = $1`, ids[0]).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		c, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
 	}
-	_, err = user.Login(context.Background(), nonExistingUser)
-	if !errors.Is(err, errors.New("USER_NOT_FOUND")) {
-		t.Errorf("Expected error 'USER_NOT_FOUND', got %v", err)
+	if got := cost(); got != 4 {
+		t.Fatalf("registered at cost %d, want 4", got)
 	}
 
-	// Test case 3: Logging in with existing user and incorrect password
-	incorrectPasswordUser := entity.User{
-		CredentialType:  "email",
-		CredentialValue: "john@example.com",
-		Password:        "incorrectpassword",
+	// the configured cost was raised since the user registered
+	config.BcryptSalt = 5
+	user := NewUser(dbPool, config)
+	login := entity.User{CredentialType: "email", CredentialValue: "user1@example.com", Password: "wrong-password"}
+
+	if _, err := user.Login(ctx, login); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal(err)
 	}
-	_, err = user.Login(context.Background(), incorrectPasswordUser)
-	if !errors.Is(err, errors.New("INVALID_PASSWORD")) {
-		t.Errorf("Expected error 'INVALID_PASSWORD', got %v", err)
+	if got := cost(); got != 4 {
+		t.Fatalf("a failed login rehashed to cost %d", got)
 	}
 
-	// Additional test cases can be added as needed
+	login.Password = "password123"
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatal(err)
+	}
+	if got := cost(); got != 5 {
+		t.Fatalf("cost after login = %d, want 5", got)
+	}
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatalf("Login() with the upgraded hash error = %v", err)
+	}
 }
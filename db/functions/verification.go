@@ -0,0 +1,204 @@
+package functions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"segokuning/configs"
+	"segokuning/db/entity"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Verification struct {
+	config configs.Config
+	dbPool *pgxpool.Pool
+}
+
+func NewVerification(dbPool *pgxpool.Pool, config configs.Config) *Verification {
+	return &Verification{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+// credentialColumn guards the credential type before it is used as a column name.
+func credentialColumn(credentialType string) (string, error) {
+	switch credentialType {
+	case "email", "phone":
+		return credentialType, nil
+	}
+	return "", ErrInvalidCredentialType
+}
+
+// Issue creates a one-time code for the user's current email or phone, replacing any pending one.
+// The returned Code is the only place the plain code exists, only its hash is stored.
+func (v *Verification) Issue(ctx context.Context, userID string, credentialType string) (entity.Verification, error) {
+	column, err := credentialColumn(credentialType)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	conn, err := v.dbPool.Acquire(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	defer conn.Release()
+
+	var (
+		value      *string
+		verifiedAt *time.Time
+	)
+	sql := fmt.Sprintf(`SELECT %[1]s, %[1]s_verified_at FROM users WHERE id = $1`, column)
+	err = conn.QueryRow(ctx, sql, userID).Scan(&value, &verifiedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Verification{}, ErrUserNotFound
+	}
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	if value == nil {
+		return entity.Verification{}, ErrCredentialNotSet
+	}
+	if verifiedAt != nil {
+		return entity.Verification{}, ErrAlreadyVerified
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	result := entity.Verification{
+		UserID:          userID,
+		CredentialType:  credentialType,
+		CredentialValue: *value,
+		Code:            code,
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE verification_codes SET consumed_at = now()
+		WHERE user_id = $1 AND credential_type = $2 AND consumed_at IS NULL`, userID, credentialType)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	err = tx.QueryRow(ctx, `INSERT INTO verification_codes (user_id, credential_type, credential_value, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, now() + make_interval(secs => $5)) RETURNING expires_at`,
+		userID, credentialType, *value, hashCode(code), v.config.VerificationCodeTTL.Seconds(),
+	).Scan(&result.ExpiresAt)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	return result, nil
+}
+
+// Verify checks code against the latest pending code and marks the credential as verified.
+// Every wrong code counts toward VerificationMaxAttempts.
+func (v *Verification) Verify(ctx context.Context, userID string, credentialType string, code string) (entity.Verification, error) {
+	column, err := credentialColumn(credentialType)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	conn, err := v.dbPool.Acquire(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		id       int64
+		codeHash string
+		attempts int
+		result   = entity.Verification{UserID: userID, CredentialType: credentialType}
+	)
+	err = tx.QueryRow(ctx, `SELECT id, credential_value, code_hash, attempts, expires_at FROM verification_codes
+		WHERE user_id = $1 AND credential_type = $2 AND consumed_at IS NULL
+		ORDER BY id DESC LIMIT 1 FOR UPDATE`, userID, credentialType,
+	).Scan(&id, &result.CredentialValue, &codeHash, &attempts, &result.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Verification{}, ErrInvalidCode
+	}
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	if attempts >= v.config.VerificationMaxAttempts {
+		return entity.Verification{}, ErrTooManyAttempts
+	}
+	if result.ExpiresAt.Before(time.Now()) {
+		return entity.Verification{}, ErrCodeExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashCode(code))) != 1 {
+		_, err = tx.Exec(ctx, `UPDATE verification_codes SET attempts = attempts + 1 WHERE id = $1`, id)
+		if err != nil {
+			return entity.Verification{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return entity.Verification{}, err
+		}
+		return entity.Verification{}, ErrInvalidCode
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE verification_codes SET consumed_at = now() WHERE id = $1`, id)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	// the code only verifies the value it was sent to, not one linked since
+	sql := fmt.Sprintf(`UPDATE users SET %[1]s_verified_at = now() WHERE id = $1 AND %[1]s = $2`, column)
+	tag, err := tx.Exec(ctx, sql, userID, result.CredentialValue)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return entity.Verification{}, ErrInvalidCode
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return entity.Verification{}, err
+	}
+
+	return result, nil
+}
+
+// newCode returns a random 6 digit code.
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"segokuning/db/dbtest"
+	"segokuning/db/entity"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyAttemptCap(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	config.VerificationMaxAttempts = 3
+	ids := register(t, dbPool, config, 1)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
+
+	verification := NewVerification(dbPool, config)
+	issued, err := verification.Issue(ctx, userID, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := "000000"
+	if issued.Code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < config.VerificationMaxAttempts; i++ {
+		if _, err := verification.Verify(ctx, userID, "email", wrong); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("wrong code %d error = %v, want %v", i+1, err, ErrInvalidCode)
+		}
+	}
+	// past the cap even the right code is refused until a new one is issued
+	if _, err := verification.Verify(ctx, userID, "email", issued.Code); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("Verify() past the cap error = %v, want %v", err, ErrTooManyAttempts)
+	}
+
+	issued, err = verification.Issue(ctx, userID, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verification.Verify(ctx, userID, "email", issued.Code); err != nil {
+		t.Fatalf("Verify() of a new code error = %v", err)
+	}
+	if _, err := verification.Issue(ctx, userID, "email"); !errors.Is(err, ErrAlreadyVerified) {
+		t.Fatalf("Issue() once verified error = %v, want %v", err, ErrAlreadyVerified)
+	}
+}
+
+func TestVerificationGracePeriod(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ids := register(t, dbPool, config, 1)
+	userID := strconv.Itoa(ids[0])
+	ctx := context.Background()
+	user := NewUser(dbPool, config)
+
+	expire := func(column string) {
+		t.Helper()
+		_, err := dbPool.Exec(ctx, `UPDATE users SET `+column+`_linked_at = now() - make_interval(secs => $2) - interval '1 minute'
+			WHERE id = $1`, ids[0], config.VerificationGracePeriod.Seconds())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	claim := entity.User{Name: "squatter", CredentialType: "email", CredentialValue: "user1@example.com", Password: "password123"}
+
+	// within the grace period an unverified credential logs in and holds its value
+	login := entity.User{CredentialType: "email", CredentialValue: "user1@example.com", Password: "password123"}
+	if _, err := user.Login(ctx, login); err != nil {
+		t.Fatalf("Login() within the grace period error = %v", err)
+	}
+	if _, err := user.Register(ctx, claim); !errors.Is(err, ErrExistingUsername) {
+		t.Fatalf("Register() of a value within the grace period error = %v, want %v", err, ErrExistingUsername)
+	}
+
+	expire("email")
+	if _, err := user.Login(ctx, login); !errors.Is(err, ErrCredentialNotVerified) {
+		t.Fatalf("Login() past the grace period error = %v, want %v", err, ErrCredentialNotVerified)
+	}
+	// the only credential of an account is never released, the account would be lost
+	if _, err := user.Register(ctx, claim); !errors.Is(err, ErrExistingUsername) {
+		t.Fatalf("Register() of an only credential error = %v, want %v", err, ErrExistingUsername)
+	}
+
+	if _, err := user.UpdatePhone(ctx, userID, "+6281234567890"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Register(ctx, claim); err != nil {
+		t.Fatalf("Register() of a stale value error = %v", err)
+	}
+
+	var email *string
+	if err := dbPool.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, ids[0]).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != nil {
+		t.Fatalf("stale email still held: %s", *email)
+	}
+
+	// the phone is its only credential now, stale or not it stays
+	expire("phone")
+	phone := entity.User{Name: "squatter2", CredentialType: "phone", CredentialValue: "+6281234567890", Password: "password123"}
+	if _, err := user.Register(ctx, phone); !errors.Is(err, ErrExistingUsername) {
+		t.Fatalf("Register() of the last credential error = %v, want %v", err, ErrExistingUsername)
+	}
+}
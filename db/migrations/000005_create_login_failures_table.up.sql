@@ -0,0 +1,8 @@
+create table if not exists login_failures(
+    credential_type varchar not null,
+    credential_value varchar not null,
+    failed_count int not null default 0,
+    last_failed_at timestamptz not null default current_timestamp,
+    locked_until timestamptz null default null,
+    primary key (credential_type, credential_value)
+);
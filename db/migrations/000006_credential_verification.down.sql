@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS verification_codes;
+
+alter table users
+    drop column if exists email_verified_at,
+    drop column if exists phone_verified_at,
+    drop column if exists email_linked_at,
+    drop column if exists phone_linked_at;
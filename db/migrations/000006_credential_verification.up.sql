@@ -0,0 +1,23 @@
+alter table users
+    add column if not exists email_verified_at timestamptz null default null,
+    add column if not exists phone_verified_at timestamptz null default null,
+    add column if not exists email_linked_at timestamptz null default null,
+    add column if not exists phone_linked_at timestamptz null default null;
+
+-- credentials linked before verification existed are trusted as verified
+update users set email_linked_at = created_at, email_verified_at = created_at where email is not null;
+update users set phone_linked_at = created_at, phone_verified_at = created_at where phone is not null;
+
+create table if not exists verification_codes(
+    id BIGSERIAL primary key,
+    user_id BIGINT not null references users(id) on delete cascade,
+    credential_type varchar not null,
+    credential_value varchar not null,
+    code_hash varchar not null,
+    attempts int not null default 0,
+    expires_at timestamptz not null,
+    consumed_at timestamptz null default null,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index on verification_codes(user_id, credential_type);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS password_resets;
+
+alter table users
+    drop column if exists token_version,
+    drop column if exists password_changed_at;
@@ -0,0 +1,16 @@
+-- bumped on every password change, access tokens carrying an older version are rejected
+alter table users
+    add column if not exists token_version int not null default 0,
+    add column if not exists password_changed_at timestamptz null default null;
+
+create table if not exists password_resets(
+    id BIGSERIAL primary key,
+    user_id BIGINT not null references users(id) on delete cascade,
+    credential_type varchar not null,
+    token_hash varchar not null unique,
+    expires_at timestamptz not null,
+    used_at timestamptz null default null,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index on password_resets(user_id);
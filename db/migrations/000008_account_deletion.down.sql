@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS storage_deletions;
+
+alter table friends_counter
+    drop constraint if exists friends_counter_user_id_fkey,
+    add constraint friends_counter_user_id_fkey foreign key (user_id) references users(id);
+
+alter table friends
+    drop constraint if exists friends_user_id_fkey,
+    drop constraint if exists friends_friend_id_fkey,
+    add constraint friends_user_id_fkey foreign key (user_id) references users(id),
+    add constraint friends_friend_id_fkey foreign key (friend_id) references users(id);
@@ -0,0 +1,23 @@
+-- let a users row be deleted, its friendships and counter go with it
+alter table friends
+    drop constraint if exists friends_user_id_fkey,
+    drop constraint if exists friends_friend_id_fkey,
+    add constraint friends_user_id_fkey foreign key (user_id) references users(id) on delete cascade,
+    add constraint friends_friend_id_fkey foreign key (friend_id) references users(id) on delete cascade;
+
+alter table friends_counter
+    drop constraint if exists friends_counter_user_id_fkey,
+    add constraint friends_counter_user_id_fkey foreign key (user_id) references users(id) on delete cascade;
+
+-- storage objects of deleted accounts, removed in the background
+create table if not exists storage_deletions(
+    id BIGSERIAL primary key,
+    object_key varchar not null,
+    attempts int not null default 0,
+    last_error varchar null default null,
+    not_before timestamptz not null default current_timestamp,
+    deleted_at timestamptz null default null,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index on storage_deletions(not_before) where deleted_at is null;
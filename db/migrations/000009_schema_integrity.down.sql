@@ -0,0 +1,22 @@
+-- the data repairs are not reverted
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+DROP FUNCTION IF EXISTS set_updated_at();
+
+create index if not exists friends_user_id_idx1 on friends(user_id);
+
+alter table friends_counter drop constraint if exists friends_counter_friend_count_not_negative;
+alter table friends drop constraint if exists friends_not_self;
+
+create sequence if not exists posts_user_id_seq owned by posts.user_id;
+create sequence if not exists friends_user_id_seq owned by friends.user_id;
+create sequence if not exists friends_friend_id_seq owned by friends.friend_id;
+create sequence if not exists friends_counter_user_id_seq owned by friends_counter.user_id;
+create sequence if not exists friends_counter_friend_count_seq owned by friends_counter.friend_count;
+
+alter table posts alter column user_id set default nextval('posts_user_id_seq');
+alter table friends
+    alter column user_id set default nextval('friends_user_id_seq'),
+    alter column friend_id set default nextval('friends_friend_id_seq');
+alter table friends_counter
+    alter column user_id set default nextval('friends_counter_user_id_seq'),
+    alter column friend_count set default nextval('friends_counter_friend_count_seq');
@@ -0,0 +1,53 @@
+-- `migrate verify` reports the rows the repairs below change.
+
+-- repair: a user can't be their own friend
+delete from friends where user_id = friend_id;
+
+-- repair: friendships are stored in both directions
+insert into friends (user_id, friend_id, created_at)
+select f.friend_id, f.user_id, f.created_at from friends f
+where not exists (select 1 from friends r where r.user_id = f.friend_id and r.friend_id = f.user_id)
+on conflict do nothing;
+
+-- repair: every user has a counter and it matches their friendships
+insert into friends_counter (user_id, friend_count)
+select u.id, 0 from users u
+where not exists (select 1 from friends_counter fc where fc.user_id = u.id);
+
+update friends_counter fc set friend_count = counted.total
+from (
+    select u.id as user_id, count(f.id) as total from users u
+    left join friends f on f.user_id = u.id
+    group by u.id
+) counted
+where counted.user_id = fc.user_id and counted.total <> fc.friend_count;
+
+-- foreign keys and counters were BIGSERIAL, which gave each of them a default from a sequence
+alter table posts alter column user_id drop default;
+alter table friends alter column user_id drop default, alter column friend_id drop default;
+alter table friends_counter alter column user_id drop default, alter column friend_count drop default;
+
+drop sequence if exists posts_user_id_seq;
+drop sequence if exists friends_user_id_seq;
+drop sequence if exists friends_friend_id_seq;
+drop sequence if exists friends_counter_user_id_seq;
+drop sequence if exists friends_counter_friend_count_seq;
+
+alter table friends_counter alter column friend_count set default 0;
+
+alter table friends add constraint friends_not_self check (user_id <> friend_id);
+alter table friends_counter add constraint friends_counter_friend_count_not_negative check (friend_count >= 0);
+
+-- 000004 meant to index friends_counter but indexed friends(user_id) a second time,
+-- friends_counter(user_id) is already covered by its primary key
+drop index if exists friends_user_id_idx1;
+
+create or replace function set_updated_at() returns trigger as $$
+begin
+    new.updated_at = current_timestamp;
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger users_set_updated_at before update on users
+    for each row execute function set_updated_at();
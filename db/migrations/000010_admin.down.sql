@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+
+update posts set comments = (
+    select coalesce(jsonb_agg(e.c - 'id' order by e.ord), '[]'::jsonb)
+    from jsonb_array_elements(posts.comments) with ordinality as e(c, ord)
+)
+where jsonb_array_length(comments) > 0;
+
+DROP SEQUENCE IF EXISTS comment_id_seq;
+
+alter table users drop constraint if exists users_role_valid;
+alter table users
+    drop column if exists suspension_reason,
+    drop column if exists suspended_until,
+    drop column if exists suspended_at,
+    drop column if exists role;
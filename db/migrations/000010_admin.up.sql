@@ -0,0 +1,42 @@
+alter table users
+    add column if not exists role varchar not null default 'user',
+    add column if not exists suspended_at timestamptz null default null,
+    -- null while suspended_at is set is a suspension without an end
+    add column if not exists suspended_until timestamptz null default null,
+    add column if not exists suspension_reason varchar null default null;
+
+alter table users add constraint users_role_valid check (role in ('user', 'moderator', 'admin'));
+
+-- comments live in posts.comments, an id lets moderators remove one of them
+create sequence if not exists comment_id_seq;
+
+update posts set comments = (
+    select coalesce(jsonb_agg(e.c || jsonb_build_object('id', nextval('comment_id_seq')) order by e.ord), '[]'::jsonb)
+    from jsonb_array_elements(posts.comments) with ordinality as e(c, ord)
+)
+where jsonb_array_length(comments) > 0;
+
+-- actor_id has no foreign key, entries outlive the accounts they mention
+create table if not exists audit_log(
+    id BIGSERIAL primary key,
+    actor_id BIGINT null,
+    action varchar not null,
+    target_type varchar not null,
+    target_id varchar not null,
+    ip varchar null default null,
+    user_agent varchar null default null,
+    details jsonb not null default '{}'::jsonb,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index on audit_log(target_type, target_id);
+create index on audit_log(actor_id);
+
+create or replace function audit_log_append_only() returns trigger as $$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_append_only before update or delete on audit_log
+    for each row execute function audit_log_append_only();
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS reports;
+
+update posts set comments = (
+    select coalesce(jsonb_agg(e.c - 'hidden' order by e.ord), '[]'::jsonb)
+    from jsonb_array_elements(posts.comments) with ordinality as e(c, ord)
+)
+where jsonb_array_length(comments) > 0;
+
+DROP INDEX IF EXISTS posts_comments;
+alter table posts drop column if exists hidden_at;
@@ -0,0 +1,28 @@
+-- a post past the report threshold is hidden from feeds until a moderator reviews it, a hidden
+-- comment carries "hidden": true in posts.comments
+alter table posts add column if not exists hidden_at timestamptz null default null;
+
+-- finds the post holding a comment by its id
+create index if not exists posts_comments on posts using gin (comments jsonb_path_ops);
+
+create table if not exists reports(
+    id BIGSERIAL primary key,
+    reporter_id BIGINT not null references users(id) on delete cascade,
+    target_type varchar not null check (target_type in ('post', 'comment', 'user')),
+    -- no foreign key, the report outlives the content it is about
+    target_id BIGINT not null,
+    -- the post holding a reported comment
+    post_id BIGINT null default null,
+    reason varchar not null,
+    text varchar null default null,
+    status varchar not null default 'open' check (status in ('open', 'dismissed', 'actioned')),
+    resolution varchar null default null,
+    resolved_by BIGINT null default null,
+    resolved_at timestamptz null default null,
+    created_at timestamptz not null default current_timestamp
+);
+
+-- a user reports the same target once until it's reviewed
+create unique index if not exists reports_open_once on reports(reporter_id, target_type, target_id) where status = 'open';
+create index if not exists reports_open_target on reports(target_type, target_id) where status = 'open';
+create index if not exists reports_queue on reports(status, created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_not_active;
+DROP FUNCTION IF EXISTS account_status(varchar, timestamptz);
+
+alter table users drop constraint if exists users_status_valid;
+alter table users drop column if exists status;
@@ -0,0 +1,18 @@
+-- suspended_at, suspended_until and suspension_reason describe the suspension while status is
+-- suspended, deactivated accounts are kept but hidden
+alter table users add column if not exists status varchar not null default 'active';
+alter table users add constraint users_status_valid check (status in ('active', 'suspended', 'deactivated'));
+
+update users set status = 'suspended'
+where suspended_at is not null and (suspended_until is null or suspended_until > now());
+
+update users set suspended_at = null, suspended_until = null, suspension_reason = null
+where status = 'active' and suspended_at is not null;
+
+-- a suspension with an end is over once it passes, nothing has to flip the status back
+create or replace function account_status(status varchar, suspended_until timestamptz) returns varchar as $$
+    select case when status = 'suspended' and suspended_until <= now() then 'active' else status end
+$$ language sql stable;
+
+-- feeds leave out the few users that aren't active
+create index if not exists users_not_active on users(id) where status <> 'active';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_deactivated;
+
+alter table users drop column if exists deactivated_at;
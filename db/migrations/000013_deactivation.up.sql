@@ -0,0 +1,6 @@
+-- deactivated accounts are erased once deactivated_at is older than the retention window
+alter table users add column if not exists deactivated_at timestamptz null;
+
+update users set deactivated_at = now() where status = 'deactivated' and deactivated_at is null;
+
+create index if not exists users_deactivated on users(deactivated_at) where status = 'deactivated';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS timeline_fanouts;
+
+DROP TABLE IF EXISTS timelines;
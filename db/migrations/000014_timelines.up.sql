@@ -0,0 +1,18 @@
+-- the feed of each user under FEED_MODE=timeline, written when a post is made instead of queried
+create table if not exists timelines(
+    owner_id BIGINT not null references users(id) on delete cascade,
+    post_id BIGINT not null references posts(id) on delete cascade,
+    -- the author of the post, a removed friendship purges their posts by it
+    author_id BIGINT not null,
+    posted_at timestamptz not null,
+    primary key (owner_id, post_id)
+);
+
+create index if not exists timelines_feed on timelines(owner_id, posted_at desc, post_id desc);
+create index if not exists timelines_author on timelines(owner_id, author_id);
+
+-- posts waiting to be fanned out to the timelines of their author and the author's friends
+create table if not exists timeline_fanouts(
+    post_id BIGINT primary key references posts(id) on delete cascade,
+    created_at timestamptz not null default current_timestamp
+);
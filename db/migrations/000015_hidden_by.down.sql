@@ -0,0 +1,9 @@
+alter table posts drop constraint if exists posts_hidden_by_valid;
+
+update posts set comments = (
+    select jsonb_agg(e.c - 'hiddenBy' order by e.ord)
+    from jsonb_array_elements(posts.comments) with ordinality as e(c, ord)
+)
+where comments @> '[{"hidden": true}]';
+
+alter table posts drop column if exists hidden_by;
@@ -0,0 +1,23 @@
+-- why a post is hidden: 'reports' past the threshold, which dismissing them undoes, or a
+-- 'moderator', which it doesn't. A hidden comment carries the same in "hiddenBy".
+alter table posts add column if not exists hidden_by varchar null default null;
+
+-- content still reported was hidden by its reports, resolving them as hidden would have closed them
+update posts set hidden_by = case when exists (
+        select 1 from reports r where r.target_type = 'post' and r.target_id = posts.id and r.status = 'open'
+    ) then 'reports' else 'moderator' end
+where hidden_at is not null;
+
+update posts set comments = (
+    select jsonb_agg(case when e.c->>'hidden' = 'true' then e.c || jsonb_build_object('hiddenBy',
+            case when exists (
+                select 1 from reports r where r.target_type = 'comment' and r.target_id = (e.c->>'id')::bigint and r.status = 'open'
+            ) then 'reports' else 'moderator' end)
+        else e.c end order by e.ord)
+    from jsonb_array_elements(posts.comments) with ordinality as e(c, ord)
+)
+where comments @> '[{"hidden": true}]';
+
+alter table posts add constraint posts_hidden_by_valid check (
+    hidden_by in ('reports', 'moderator') and hidden_at is not null or hidden_by is null and hidden_at is null
+);
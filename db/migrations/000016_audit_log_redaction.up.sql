@@ -0,0 +1,20 @@
+-- audit_log stays append-only except for erasing an account: in a transaction that set
+-- segokuning.redact_user to its id, the ip and user agent of its own entries are cleared and the
+-- details of the entries about it replaced by {"redacted": true}. Nothing else changes, nothing is deleted.
+create or replace function audit_log_append_only() returns trigger as $$
+declare
+    redact_user text := nullif(current_setting('segokuning.redact_user', true), '');
+begin
+    if tg_op = 'UPDATE' and redact_user is not null
+        and (old.actor_id::text = redact_user or (old.target_type = 'user' and old.target_id = redact_user))
+        and new.id = old.id and new.actor_id is not distinct from old.actor_id and new.action = old.action
+        and new.target_type = old.target_type and new.target_id = old.target_id and new.created_at = old.created_at
+        and (new.ip is null or new.ip = old.ip)
+        and (new.user_agent is null or new.user_agent = old.user_agent)
+        and (new.details = old.details or new.details = '{"redacted": true}'::jsonb)
+    then
+        return new;
+    end if;
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
@@ -0,0 +1,10 @@
+-- who uploaded each storage object through /v1/image. Only these are exported with and removed
+-- along with an account, an image URL alone can point at anyone's object. Objects uploaded before
+-- this table have no owner and stay in storage.
+create table if not exists uploads(
+    object_key varchar primary key,
+    user_id bigint not null references users(id) on delete cascade,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index if not exists uploads_user_id on uploads(user_id);
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for i, mig := range migrations {
+		if mig.Version != uint(i+1) {
+			t.Errorf("migration %d_%s: expected version %d, versions must be sequential", mig.Version, mig.Name, i+1)
+		}
+	}
+}
+
+func TestLoadNeedsUpAndDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_users.up.sql":   {Data: []byte("create table users();")},
+		"000001_users.down.sql": {Data: []byte("drop table users;")},
+		"000002_posts.up.sql":   {Data: []byte("create table posts();")},
+	}
+
+	if _, err := load(fsys); err == nil {
+		t.Fatal("expected an error for a migration without a down file")
+	}
+
+	delete(fsys, "000002_posts.up.sql")
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) != 1 || Latest(migrations) != 1 {
+		t.Fatalf("expected one migration at version 1, got %+v", migrations)
+	}
+}
@@ -0,0 +1,219 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockID is the pg_advisory_lock key migrations run under, any other process migrating
+// the same database waits for the lock instead of racing.
+const lockID int64 = 0x7365676f6b756e69 // "segokuni", the app name cut to 8 bytes
+
+var ErrDirty = errors.New("schema_migrations is dirty, a migration failed halfway: fix the schema by hand and correct the version row")
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+func New(pool *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func (m *Migrator) Latest() uint {
+	return Latest(m.migrations)
+}
+
+// Version returns the applied version, 0 on a database that was never migrated.
+func (m *Migrator) Version(ctx context.Context) (uint, bool, error) {
+	var exists bool
+	err := m.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+	return version(ctx, m.pool)
+}
+
+// Check refuses a schema that is dirty or behind the embedded migrations. A schema ahead is
+// accepted so an older replica keeps serving while a newer one rolls out.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrDirty
+	}
+	if latest := m.Latest(); current < latest {
+		return fmt.Errorf("database schema is at version %d but this build needs %d, run `migrate up` first", current, latest)
+	}
+	return nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.migrate(ctx, func(uint) (uint, error) {
+		return m.Latest(), nil
+	})
+}
+
+// Down reverts the last applied migration only.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.migrate(ctx, func(current uint) (uint, error) {
+		if current == 0 {
+			return 0, errors.New("no migration to revert")
+		}
+		return m.previous(current), nil
+	})
+}
+
+// To migrates up or down to target, 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, target uint) error {
+	return m.migrate(ctx, func(uint) (uint, error) {
+		if target != 0 && m.index(target) < 0 {
+			return 0, fmt.Errorf("unknown migration version %d", target)
+		}
+		return target, nil
+	})
+}
+
+// migrate resolves the target and applies the steps to it while holding the advisory lock,
+// so the version it starts from can't change underneath it.
+func (m *Migrator) migrate(ctx context.Context, target func(current uint) (uint, error)) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed acquire migration lock %w", err)
+	}
+	defer func() {
+		// unlock even when ctx is done, or the lock lives as long as the pooled connection
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			slog.Error("failed release migration lock", "error", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	current, dirty, err := version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrDirty
+	}
+
+	to, err := target(current)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version <= current || mig.Version > to {
+			continue
+		}
+		if err := step(ctx, conn, mig.Up, mig.Version); err != nil {
+			return fmt.Errorf("failed apply migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		slog.Info("applied migration", "version", mig.Version, "name", mig.Name)
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > current || mig.Version <= to {
+			continue
+		}
+		if err := step(ctx, conn, mig.Down, m.previous(mig.Version)); err != nil {
+			return fmt.Errorf("failed revert migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		slog.Info("reverted migration", "version", mig.Version, "name", mig.Name)
+	}
+
+	return nil
+}
+
+// step runs one migration file and records the resulting version in the same transaction,
+// so a failing migration leaves neither its changes nor a dirty version behind.
+func step(ctx context.Context, conn *pgxpool.Conn, sql string, version uint) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `TRUNCATE schema_migrations`); err != nil {
+		return err
+	}
+	// golang-migrate leaves the table empty once everything is reverted
+	if version > 0 {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, int64(version))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func version(ctx context.Context, q querier) (uint, bool, error) {
+	var (
+		v     int64
+		dirty bool
+	)
+	err := q.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(v), dirty, nil
+}
+
+func (m *Migrator) index(version uint) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// previous returns the version before the given one, 0 before the first migration.
+func (m *Migrator) previous(version uint) uint {
+	var prev uint
+	for _, mig := range m.migrations {
+		if mig.Version >= version {
+			break
+		}
+		prev = mig.Version
+	}
+	return prev
+}
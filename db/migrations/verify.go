@@ -0,0 +1,64 @@
+package migrations
+
+import "context"
+
+// Check is an integrity rule the schema enforces, or will once the pending migrations run.
+type Check struct {
+	Name        string
+	Description string
+	// Query counts the rows breaking the rule.
+	Query string
+}
+
+// Checks mirror the constraints and repairs of 000009_schema_integrity, so running them
+// before that migration shows what it is about to change.
+var Checks = []Check{
+	{
+		Name:        "friends_not_self",
+		Description: "friendships of a user with themselves, deleted",
+		Query:       `SELECT count(*) FROM friends WHERE user_id = friend_id`,
+	},
+	{
+		Name:        "friends_symmetric",
+		Description: "friendships stored in one direction only, the other direction is added",
+		Query: `SELECT count(*) FROM friends f
+			WHERE NOT EXISTS (SELECT 1 FROM friends r WHERE r.user_id = f.friend_id AND r.friend_id = f.user_id)`,
+	},
+	{
+		Name:        "friends_counter_missing",
+		Description: "users without a friends_counter row, created",
+		Query: `SELECT count(*) FROM users u
+			WHERE NOT EXISTS (SELECT 1 FROM friends_counter fc WHERE fc.user_id = u.id)`,
+	},
+	{
+		Name:        "friends_counter_not_negative",
+		Description: "negative friend counts, recounted",
+		Query:       `SELECT count(*) FROM friends_counter WHERE friend_count < 0`,
+	},
+	{
+		Name:        "friends_counter_matches",
+		Description: "friend counts that differ from the friendships stored, recounted",
+		Query: `SELECT count(*) FROM friends_counter fc
+			WHERE fc.friend_count <> (SELECT count(*) FROM friends f WHERE f.user_id = fc.user_id)`,
+	},
+}
+
+type Violation struct {
+	Check Check
+	Rows  int64
+}
+
+// Verify runs every check and returns the ones with rows breaking them.
+func (m *Migrator) Verify(ctx context.Context) ([]Violation, error) {
+	var violations []Violation
+	for _, check := range Checks {
+		var rows int64
+		if err := m.pool.QueryRow(ctx, check.Query).Scan(&rows); err != nil {
+			return nil, err
+		}
+		if rows > 0 {
+			violations = append(violations, Violation{Check: check, Rows: rows})
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,314 @@
+// Package seed fills a database with a generated dataset for local work and load tests. The same
+// Options and seed always produce the same users, friendships, posts and comments, only the
+// timestamps move with the time of the run.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"segokuning/configs"
+	"segokuning/db/entity"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const avatarURL = "https://sprint-bucket-public-read.s3.ap-southeast-1.amazonaws.com/seed/avatar-%02d.jpg"
+
+type Options struct {
+	Users    int
+	Friends  int // average friends per user, the degrees follow a power law around it
+	Posts    int // average posts per user
+	Comments int // most comments on a post, written by the author and their friends
+	Seed     int64
+	Prefix   string // emails are <prefix><n>@example.com, n from 1 to Users
+	Password string // every user gets this password
+}
+
+type Stats struct {
+	Users       int
+	Friendships int
+	Posts       int
+	Comments    int
+}
+
+// Email is the address of the nth seeded user, so the load driver can log them in.
+func Email(prefix string, n int) string {
+	return fmt.Sprintf("%s%d@example.com", prefix, n)
+}
+
+type Seeder struct {
+	dbPool *pgxpool.Pool
+	config configs.Config
+}
+
+func New(dbPool *pgxpool.Pool, config configs.Config) *Seeder {
+	return &Seeder{
+		dbPool: dbPool,
+		config: config,
+	}
+}
+
+type user struct {
+	id       int
+	name     string
+	email    string
+	imageURL *string
+	friends  []int // indexes into the users
+}
+
+type post struct {
+	author   int
+	html     string
+	tags     []string
+	comments []entity.CommentPerPost
+	// commenters are the indexes of the users who wrote comments
+	commenters []int
+	at         time.Time
+}
+
+// Run writes the dataset in one transaction, nothing is left behind when it fails. The emails
+// must be free, seed into an empty database or pick another prefix.
+func (s *Seeder) Run(ctx context.Context, opts Options) (Stats, error) {
+	if opts.Users < 2 {
+		return Stats{}, fmt.Errorf("need at least 2 users, got %d", opts.Users)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), s.config.BcryptSalt)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	users := generateUsers(rng, opts)
+	edges := befriend(rng, users, opts.Friends)
+
+	now := time.Now()
+	posts := generatePosts(rng, users, opts, now)
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	userIDs, err := reserveIDs(ctx, tx, `pg_get_serial_sequence('users', 'id')`, len(users))
+	if err != nil {
+		return Stats{}, err
+	}
+	for i := range users {
+		users[i].id = int(userIDs[i])
+	}
+
+	userRows := make([][]interface{}, len(users))
+	for i, u := range users {
+		joined := now.Add(-time.Duration(len(users)-i) * time.Minute)
+		userRows[i] = []interface{}{u.id, u.name, u.email, joined, joined, string(hash), u.imageURL, joined}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"users"},
+		[]string{"id", "name", "email", "email_linked_at", "email_verified_at", "password", "image_url", "created_at"},
+		pgx.CopyFromRows(userRows)); err != nil {
+		return Stats{}, fmt.Errorf("failed insert users: %w", err)
+	}
+
+	// both directions of every friendship and counters matching them, the same rows Friend.AddFriend writes
+	counterRows := make([][]interface{}, len(users))
+	for i, u := range users {
+		counterRows[i] = []interface{}{u.id, len(u.friends)}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"friends_counter"}, []string{"user_id", "friend_count"},
+		pgx.CopyFromRows(counterRows)); err != nil {
+		return Stats{}, fmt.Errorf("failed insert friends_counter: %w", err)
+	}
+
+	friendRows := make([][]interface{}, 0, 2*edges)
+	for _, u := range users {
+		for _, f := range u.friends {
+			friendRows = append(friendRows, []interface{}{u.id, users[f].id})
+		}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"friends"}, []string{"user_id", "friend_id"},
+		pgx.CopyFromRows(friendRows)); err != nil {
+		return Stats{}, fmt.Errorf("failed insert friends: %w", err)
+	}
+
+	comments := 0
+	for _, p := range posts {
+		comments += len(p.comments)
+	}
+	commentIDs, err := reserveIDs(ctx, tx, `'comment_id_seq'`, comments)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	postRows := make([][]interface{}, len(posts))
+	for i, p := range posts {
+		for j := range p.comments {
+			// the comments were generated with their author, their ids need the database
+			p.comments[j].Id, commentIDs = commentIDs[0], commentIDs[1:]
+			p.comments[j].Creator.UserId = users[p.commenters[j]].id
+		}
+		commentJSON, err := json.Marshal(p.comments)
+		if err != nil {
+			return Stats{}, err
+		}
+		postRows[i] = []interface{}{users[p.author].id, p.html, p.tags, commentJSON, p.at}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"posts"}, []string{"user_id", "post_in_html", "tags", "comments", "created_at"},
+		pgx.CopyFromRows(postRows)); err != nil {
+		return Stats{}, fmt.Errorf("failed insert posts: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		Users:       len(users),
+		Friendships: edges,
+		Posts:       len(posts),
+		Comments:    comments,
+	}, nil
+}
+
+// reserveIDs takes n ids from sequence up front, the rows written later refer to them.
+func reserveIDs(ctx context.Context, tx pgx.Tx, sequence string, n int) ([]int64, error) {
+	rows, err := tx.Query(ctx, `SELECT nextval(`+sequence+`) FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+func generateUsers(rng *rand.Rand, opts Options) []user {
+	users := make([]user, opts.Users)
+	for i := range users {
+		users[i].name = firstNames[rng.Intn(len(firstNames))] + " " + lastNames[rng.Intn(len(lastNames))]
+		users[i].email = Email(opts.Prefix, i+1)
+
+		// most users have picked a profile picture
+		if rng.Intn(10) < 7 {
+			url := fmt.Sprintf(avatarURL, rng.Intn(50))
+			users[i].imageURL = &url
+		}
+	}
+	return users
+}
+
+// befriend builds the friendship graph by preferential attachment: every user befriends about
+// half the average among those before them, picked in proportion to the friends they already
+// have, which leaves a few users with very many friends and most with a handful.
+func befriend(rng *rand.Rand, users []user, average int) int {
+	perUser := average / 2
+	if perUser < 1 {
+		perUser = 1
+	}
+
+	edges := 0
+	// every user appears here once per friend, a uniform pick is a pick weighted by friend count
+	var ends []int
+	for i := 1; i < len(users); i++ {
+		want := perUser
+		if want > i {
+			want = i
+		}
+
+		picked := make(map[int]bool, want)
+		for len(picked) < want {
+			var j int
+			if len(ends) == 0 || rng.Intn(10) == 0 {
+				// now and then anyone, so newcomers can be found too
+				j = rng.Intn(i)
+			} else {
+				j = ends[rng.Intn(len(ends))]
+			}
+			if j == i || picked[j] {
+				continue
+			}
+			picked[j] = true
+
+			users[i].friends = append(users[i].friends, j)
+			users[j].friends = append(users[j].friends, i)
+			ends = append(ends, i, j)
+			edges++
+		}
+	}
+	return edges
+}
+
+func generatePosts(rng *rand.Rand, users []user, opts Options, now time.Time) []post {
+	var posts []post
+	for i, u := range users {
+		count := 0
+		if opts.Posts > 0 {
+			count = rng.Intn(2*opts.Posts + 1)
+		}
+
+		for n := 0; n < count; n++ {
+			p := post{
+				author: i,
+				html:   sentence(rng),
+				tags:   pickTags(rng),
+				at:     now.Add(-time.Duration(rng.Int63n(int64(90 * 24 * time.Hour)))),
+			}
+
+			if opts.Comments > 0 {
+				// the author and their friends are the ones allowed to comment
+				commenters := append([]int{i}, u.friends...)
+				for c := rng.Intn(opts.Comments + 1); c > 0; c-- {
+					byIndex := commenters[rng.Intn(len(commenters))]
+					by := users[byIndex]
+					p.commenters = append(p.commenters, byIndex)
+					p.comments = append(p.comments, entity.CommentPerPost{
+						Comment: sentence(rng),
+						Creator: entity.Creator{
+							Name:        by.name,
+							ImageUrl:    by.imageURL,
+							FriendCount: len(by.friends),
+						},
+						CreatedAt: p.at.Add(time.Duration(rng.Int63n(int64(now.Sub(p.at)) + 1))),
+					})
+				}
+			}
+			if p.comments == nil {
+				p.comments = []entity.CommentPerPost{}
+			}
+			posts = append(posts, p)
+		}
+	}
+	return posts
+}
+
+func sentence(rng *rand.Rand) string {
+	words := make([]string, 4+rng.Intn(12))
+	for i := range words {
+		words[i] = vocabulary[rng.Intn(len(vocabulary))]
+	}
+	return "<p>" + strings.Join(words, " ") + "</p>"
+}
+
+func pickTags(rng *rand.Rand) []string {
+	tags := make([]string, 0, 3)
+	for _, i := range rng.Perm(len(tagPool))[:1+rng.Intn(3)] {
+		tags = append(tags, tagPool[i])
+	}
+	return tags
+}
+
+var (
+	firstNames = []string{"Budi", "Siti", "Agus", "Dewi", "Rina", "Andi", "Putri", "Eko", "Wulan", "Fajar",
+		"Ayu", "Rizky", "Nanda", "Yusuf", "Intan", "Bayu", "Sari", "Hendra", "Lestari", "Dimas"}
+	lastNames = []string{"Santoso", "Nurhaliza", "Wijaya", "Saputra", "Kusuma", "Pratama", "Hidayat", "Lestari",
+		"Setiawan", "Permata", "Gunawan", "Rahmawati", "Siregar", "Nasution", "Halim"}
+	vocabulary = []string{"hari", "ini", "makan", "nasi", "goreng", "di", "warung", "dekat", "kantor", "hujan",
+		"deras", "macet", "lagi", "weekend", "ke", "pantai", "bareng", "teman", "kopi", "pagi", "senja",
+		"kerja", "lembur", "liburan", "akhirnya", "selesai", "mantap", "seru", "banget", "kangen", "rumah"}
+	tagPool = []string{"food", "travel", "work", "weekend", "coffee", "jakarta", "bandung", "bali", "music",
+		"football", "movie", "photo", "family", "rain", "traffic"}
+)
@@ -0,0 +1,100 @@
+package seed
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+
+	"segokuning/db/dbtest"
+	"segokuning/db/migrations"
+)
+
+func TestMain(m *testing.M) { os.Exit(dbtest.Main(m)) }
+
+func TestBefriendIsDeterministic(t *testing.T) {
+	graph := func(seed int64) [][]int {
+		users := generateUsers(rand.New(rand.NewSource(seed)), Options{Users: 500, Prefix: "user"})
+		befriend(rand.New(rand.NewSource(seed)), users, 10)
+		friends := make([][]int, len(users))
+		for i, u := range users {
+			friends[i] = u.friends
+		}
+		return friends
+	}
+
+	first := graph(1)
+	if !reflect.DeepEqual(first, graph(1)) {
+		t.Fatal("the same seed built two different graphs")
+	}
+	if reflect.DeepEqual(first, graph(2)) {
+		t.Fatal("two seeds built the same graph")
+	}
+
+	most, total := 0, 0
+	for i, friends := range first {
+		seen := map[int]bool{}
+		for _, f := range friends {
+			if f == i || seen[f] {
+				t.Fatalf("user %d has friend %d twice or is their own friend", i, f)
+			}
+			seen[f] = true
+		}
+		total += len(friends)
+		if len(friends) > most {
+			most = len(friends)
+		}
+	}
+	if average := total / len(first); most < 4*average {
+		t.Errorf("the best connected user has %d friends, the average is %d, want a long tail", most, average)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dbPool, config := dbtest.DB(t)
+	ctx := context.Background()
+	opts := Options{Users: 300, Friends: 10, Posts: 3, Comments: 4, Seed: 1, Prefix: "user", Password: "password"}
+
+	stats, err := New(dbPool, config).Run(ctx, opts)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if stats.Users != opts.Users || stats.Friendships == 0 || stats.Posts == 0 || stats.Comments == 0 {
+		t.Fatalf("Run() = %+v", stats)
+	}
+
+	migrator, err := migrations.New(dbPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := migrator.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("%s: %d rows", v.Check.Name, v.Rows)
+	}
+
+	var orphans int
+	err = dbPool.QueryRow(ctx, `SELECT count(*) FROM posts p, jsonb_array_elements(p.comments) c
+		WHERE c->>'id' IS NULL OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = (c->'creator'->>'userId')::bigint)`).Scan(&orphans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orphans != 0 {
+		t.Errorf("%d comments have no id or an unknown creator", orphans)
+	}
+
+	// a second run with the same emails fails as a whole
+	if _, err := New(dbPool, config).Run(ctx, opts); err == nil {
+		t.Fatal("seeding the same emails twice succeeded")
+	}
+	var users int
+	if err := dbPool.QueryRow(ctx, `SELECT count(*) FROM users`).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != opts.Users {
+		t.Fatalf("%d users after the failed run, want %d", users, opts.Users)
+	}
+}
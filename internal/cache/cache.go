@@ -0,0 +1,32 @@
+// Package cache keeps values that are expensive to query for a short while, in process or in redis.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"segokuning/configs"
+)
+
+// Cache stores values under keys for a ttl. A miss is not an error, callers fall back to the
+// database when Get fails.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// New returns the cache CACHE_DRIVER names, nil for none.
+func New(config configs.Config) (Cache, error) {
+	switch config.CacheDriver {
+	case "lru":
+		return NewLRU(config.CacheSize), nil
+	case "redis":
+		return NewRedis(config), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", config.CacheDriver)
+	}
+}
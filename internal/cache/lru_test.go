@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+
+	l.Set(ctx, "feed:1", []byte("a"), time.Minute)
+	l.Set(ctx, "feed:2", []byte("b"), time.Minute)
+	// reading feed:1 makes feed:2 the least recently used
+	if _, ok, _ := l.Get(ctx, "feed:1"); !ok {
+		t.Fatal("feed:1 missing before the cache is full")
+	}
+	l.Set(ctx, "feed:3", []byte("c"), time.Minute)
+
+	for key, want := range map[string]bool{"feed:1": true, "feed:2": false, "feed:3": true} {
+		if _, ok, _ := l.Get(ctx, key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+	if l.order.Len() != 2 || len(l.entries) != 2 {
+		t.Errorf("%d entries in order and %d in the map, want 2", l.order.Len(), len(l.entries))
+	}
+
+	// setting a key again replaces its value without evicting anything
+	l.Set(ctx, "feed:3", []byte("d"), time.Minute)
+	if value, _, _ := l.Get(ctx, "feed:3"); string(value) != "d" {
+		t.Errorf("feed:3 = %q, want d", value)
+	}
+	if _, ok, _ := l.Get(ctx, "feed:1"); !ok {
+		t.Error("feed:1 evicted by replacing feed:3")
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(10)
+
+	l.Set(ctx, "creator:1", []byte("a"), 20*time.Millisecond)
+	l.Set(ctx, "creator:2", []byte("b"), time.Minute)
+	if _, ok, _ := l.Get(ctx, "creator:1"); !ok {
+		t.Fatal("creator:1 missing within its ttl")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok, _ := l.Get(ctx, "creator:1"); ok {
+		t.Error("creator:1 served past its ttl")
+	}
+	if _, ok := l.entries["creator:1"]; ok {
+		t.Error("expired creator:1 kept after a miss")
+	}
+	if _, ok, _ := l.Get(ctx, "creator:2"); !ok {
+		t.Error("creator:2 expired with creator:1")
+	}
+
+	// setting an expired key again starts a new ttl
+	l.Set(ctx, "creator:1", []byte("c"), time.Minute)
+	if value, ok, _ := l.Get(ctx, "creator:1"); !ok || string(value) != "c" {
+		t.Errorf("creator:1 = %q cached %v, want c", value, ok)
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(10)
+
+	for _, key := range []string{"feed:1", "feedcount:1", "friends:1"} {
+		l.Set(ctx, key, []byte(key), time.Minute)
+	}
+	// keys that aren't cached are skipped
+	if err := l.Delete(ctx, "feed:1", "feedcount:1", "feed:9"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]bool{"feed:1": false, "feedcount:1": false, "friends:1": true} {
+		if _, ok, _ := l.Get(ctx, key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+	if l.order.Len() != 1 || len(l.entries) != 1 {
+		t.Errorf("%d entries in order and %d in the map, want 1", l.order.Len(), len(l.entries))
+	}
+}
@@ -0,0 +1,50 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"segokuning/db/functions"
+)
+
+// Deactivated erases accounts deactivated past their retention window every Interval until its
+// context is cancelled, Batch accounts per transaction.
+type Deactivated struct {
+	Accounts *functions.Account
+	Interval time.Duration
+	Batch    int
+}
+
+func (d *Deactivated) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Deactivated) purge(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := d.Accounts.PurgeDeactivated(ctx, d.Batch)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed purge deactivated accounts", "error", err)
+			}
+			return
+		}
+		if n > 0 {
+			slog.Info("purged deactivated accounts", "count", n)
+		}
+		if n < d.Batch {
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Package cleanup runs background work that follows account deletion and deactivation.
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"segokuning/db/functions"
+)
+
+// ObjectDeleter removes a storage object by key, utils.ImageUploader implements it.
+type ObjectDeleter interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// Storage drains the storage_deletions queue every Interval until its context is cancelled.
+type Storage struct {
+	Queue    *functions.StorageDeletion
+	Storage  ObjectDeleter
+	Interval time.Duration
+	Batch    int
+}
+
+func (s *Storage) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Storage) drain(ctx context.Context) {
+	items, err := s.Queue.Due(ctx, s.Batch)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed list storage deletions", "error", err)
+		}
+		return
+	}
+
+	for _, item := range items {
+		if err := s.Storage.Delete(ctx, item.ObjectKey); err != nil {
+			slog.Warn("failed delete storage object", "key", item.ObjectKey, "attempts", item.Attempts+1, "error", err)
+			if err := s.Queue.MarkFailed(ctx, item.Id, err); err != nil {
+				slog.Error("failed record storage deletion failure", "key", item.ObjectKey, "error", err)
+			}
+			continue
+		}
+
+		if err := s.Queue.MarkDeleted(ctx, item.Id); err != nil {
+			slog.Error("failed mark storage object deleted", "key", item.ObjectKey, "error", err)
+		}
+	}
+}
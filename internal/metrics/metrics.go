@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "segokuning"
+
+// http metrics, route is the fiber route template so cardinality stays bounded
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// upload outcomes
+const (
+	UploadSuccess     = "success"
+	UploadInvalidSize = "invalid_size"
+	UploadInvalidType = "invalid_type"
+	UploadError       = "error"
+)
+
+var (
+	Uploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Number of image uploads by outcome.",
+	}, []string{"outcome"})
+
+	UploadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded images by outcome.",
+		// 10KB up to 2MB is accepted, keep buckets around that range
+		Buckets: []float64{5_000, 10_000, 50_000, 100_000, 250_000, 500_000, 1_000_000, 2_000_000, 5_000_000},
+	}, []string{"outcome"})
+)
+
+// business counters
+var (
+	Registrations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Number of registered users.",
+	})
+
+	Posts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Number of created posts.",
+	})
+
+	Comments = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_created_total",
+		Help:      "Number of created comments.",
+	})
+
+	Friendships = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "friendships_total",
+		Help:      "Number of friendship changes by action (added, removed).",
+	}, []string{"action"})
+)
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"segokuning/internal/logging"
+)
+
+// LogSender writes messages to the request log, for local development only.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("notification",
+		"channel", msg.Channel,
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
+
+// FileSender appends messages as JSON lines to a file, for local development and tests.
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (f *FileSender) Send(_ context.Context, msg Message) error {
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sentAt"`
+	}{msg, time.Now()})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"segokuning/configs"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+)
+
+const (
+	DriverLog     = "log"
+	DriverFile    = "file"
+	DriverWebhook = "webhook"
+)
+
+// Message is a notification to a single email address or phone number.
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender delivers messages. Drivers for real email/SMS providers implement it too.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the sender selected by NOTIFY_DRIVER.
+func New(cfg configs.Config) (Sender, error) {
+	switch cfg.NotifyDriver {
+	case DriverLog:
+		return LogSender{}, nil
+	case DriverFile:
+		return NewFileSender(cfg.NotifyFile), nil
+	case DriverWebhook:
+		return NewWebhookSender(cfg.NotifyWebhookURL), nil
+	default:
+		return nil, fmt.Errorf("unknown notify driver %q, use log, file or webhook", cfg.NotifyDriver)
+	}
+}
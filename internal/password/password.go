@@ -0,0 +1,39 @@
+// Package password holds the policy every new password is checked against.
+package password
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"strings"
+)
+
+const (
+	MinLength = 8
+	// MaxLength keeps passwords within what bcrypt hashes, longer input would be truncated.
+	MaxLength = 72
+)
+
+//go:embed common.txt
+var commonList []byte
+
+var common = load(commonList)
+
+func load(list []byte) map[string]struct{} {
+	set := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// IsCommon reports whether p appears on the breached/common password denylist.
+func IsCommon(p string) bool {
+	_, ok := common[strings.ToLower(p)]
+	return ok
+}
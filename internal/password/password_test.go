@@ -0,0 +1,56 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIsCommon(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"PassWord123", true},
+		{"123456", true},
+		{"qwerty", true},
+		{"correct horse battery staple", false},
+		{"", false},
+		// the header comment of the list isn't an entry
+		{"# Most common passwords from public breach corpora, one per line, compared case-insensitively.", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCommon(tt.password); got != tt.want {
+			t.Errorf("IsCommon(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	set := load([]byte("# comment\n\n  Hunter2  \nletmein\n"))
+	if len(set) != 2 {
+		t.Fatalf("load() = %v, want 2 entries", set)
+	}
+	for _, p := range []string{"hunter2", "letmein"} {
+		if _, ok := set[p]; !ok {
+			t.Errorf("load() is missing %q: %v", p, set)
+		}
+	}
+}
+
+func TestLengths(t *testing.T) {
+	if MinLength < 8 || MinLength > MaxLength {
+		t.Fatalf("MinLength = %d, MaxLength = %d", MinLength, MaxLength)
+	}
+
+	// MaxLength is all bcrypt hashes, one byte more and it refuses to
+	if _, err := bcrypt.GenerateFromPassword([]byte(strings.Repeat("a", MaxLength)), bcrypt.MinCost); err != nil {
+		t.Fatalf("hash of a MaxLength password: %v", err)
+	}
+	if _, err := bcrypt.GenerateFromPassword([]byte(strings.Repeat("a", MaxLength+1)), bcrypt.MinCost); err == nil {
+		t.Fatal("bcrypt hashed a password longer than MaxLength, MaxLength is out of date")
+	}
+}
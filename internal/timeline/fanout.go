@@ -0,0 +1,52 @@
+// Package timeline fans new posts out to the timelines of their authors' friends under
+// FEED_MODE=timeline.
+package timeline
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"segokuning/db/functions"
+)
+
+// Fanout drains the timeline_fanouts queue every Interval until its context is cancelled, Batch
+// posts per transaction.
+type Fanout struct {
+	Timelines *functions.Timeline
+	Interval  time.Duration
+	Batch     int
+}
+
+func (f *Fanout) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		f.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *Fanout) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := f.Timelines.FanOut(ctx, f.Batch)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed fan out posts", "error", err)
+			}
+			return
+		}
+		if n > 0 {
+			slog.Debug("fanned out posts", "count", n)
+		}
+		if n < f.Batch {
+			return
+		}
+	}
+}
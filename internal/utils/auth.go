@@ -8,15 +8,12 @@ import (
 )
 
 // GenerateAccessToken generates a JWT access token for the provided username.
-func GenerateAccessToken(username string, userID string) (string, error) {
-	config, err := configs.LoadConfig()
-	if err != nil {
-		return "", err
-	}
+// tokenVersion must match the user's current version for the token to be accepted, role is
+// what middleware.RequireRole checks, an empty one is a plain user.
+func GenerateAccessToken(config configs.Config, username string, userID string, role string, tokenVersion int) (string, error) {
 	var (
 		// Define a secret key for signing the JWT token.
 		// Ensure to keep this key secure and don't expose it.
-		// You may want to use an environment variable to store it.
 		secretKey = []byte(config.JWTSecret)
 	)
 	// Define the token expiration time.
@@ -26,6 +23,8 @@ func GenerateAccessToken(username string, userID string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
 		"user_id":  userID,
+		"role":     role,
+		"ver":      tokenVersion,
 		"exp":      expirationTime.Unix(),
 	})
 
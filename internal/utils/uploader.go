@@ -3,14 +3,22 @@ package utils
 import (
 	"context"
 	"io"
+	"net/url"
 	"segokuning/configs"
+	"segokuning/internal/tracing"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const bucket = "sprint-bucket-public-read"
+
 var credentialProvider = func(cfg configs.Config) aws.CredentialsProviderFunc {
 	return func(ctx context.Context) (aws.Credentials, error) {
 		return aws.Credentials{
@@ -20,35 +28,124 @@ var credentialProvider = func(cfg configs.Config) aws.CredentialsProviderFunc {
 	}
 }
 
-func newS3Uploader(cfg configs.Config) *manager.Uploader {
-	client := s3.New(s3.Options{
+func newS3Client(cfg configs.Config) *s3.Client {
+	return s3.New(s3.Options{
 		Region:      "ap-southeast-1",
 		Credentials: credentialProvider(cfg),
 	})
-
-	return manager.NewUploader(client)
 }
 
 type ImageUploader struct {
+	client   *s3.Client
 	uploader *manager.Uploader
 }
 
 func NewImageUploader(cfg configs.Config) *ImageUploader {
+	client := newS3Client(cfg)
+
 	return &ImageUploader{
-		uploader: newS3Uploader(cfg),
+		client:   client,
+		uploader: manager.NewUploader(client),
 	}
 }
 
 func (i *ImageUploader) Upload(ctx context.Context, file io.Reader, filename string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "storage.upload", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("storage.bucket", bucket),
+			attribute.String("storage.key", filename),
+		),
+	)
+	defer span.End()
+
 	result, err := i.uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String("sprint-bucket-public-read"),
+		Bucket: aws.String(bucket),
 		Key:    aws.String(filename),
 		Body:   file,
 		ACL:    types.ObjectCannedACLPublicRead,
 	})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return "", err
 	}
 
 	return result.Location, nil
 }
+
+// Ping checks that the bucket is reachable with the configured credentials.
+func (i *ImageUploader) Ping(ctx context.Context) error {
+	_, err := i.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	return err
+}
+
+// Download opens an uploaded object, the caller closes it.
+func (i *ImageUploader) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "storage.download", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("storage.bucket", bucket),
+			attribute.String("storage.key", key),
+		),
+	)
+	defer span.End()
+
+	result, err := i.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
+// Delete removes an uploaded object, deleting a missing key is not an error.
+func (i *ImageUploader) Delete(ctx context.Context, key string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "storage.delete", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("storage.bucket", bucket),
+			attribute.String("storage.key", key),
+		),
+	)
+	defer span.End()
+
+	_, err := i.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// ObjectKey returns the key of an object Upload returned the location of. URLs pointing
+// anywhere else, such as images users linked from other hosts, are reported as not ours.
+func ObjectKey(location string) (string, bool) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", false
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+	switch {
+	// virtual hosted style, bucket.s3.region.amazonaws.com/key
+	case strings.HasPrefix(u.Host, bucket+".s3."):
+	// path style, s3.region.amazonaws.com/bucket/key
+	case strings.HasPrefix(u.Host, "s3.") && strings.HasPrefix(path, bucket+"/"):
+		path = strings.TrimPrefix(path, bucket+"/")
+	default:
+		return "", false
+	}
+
+	if path == "" {
+		return "", false
+	}
+	return path, true
+}
@@ -1,7 +1,42 @@
 package main
 
-import webservices "segokuning/cmd/web-services"
+import (
+	"fmt"
+	"os"
 
+	"segokuning/cmd/load"
+	"segokuning/cmd/migrate"
+	"segokuning/cmd/role"
+	"segokuning/cmd/seed"
+	"segokuning/cmd/timeline"
+	webservices "segokuning/cmd/web-services"
+)
+
+// main runs the server by default, `segokuning migrate up|down|status|to N` manages the schema,
+// `segokuning seed` generates data, `segokuning load` replays requests against a server and
+// `segokuning role` grants moderator and admin roles and `segokuning timeline rebuild|check`
+// maintains the timelines of FEED_MODE=timeline.
 func main() {
-	webservices.Run()
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve":
+		webservices.Run()
+	case "migrate":
+		migrate.Run(os.Args[2:])
+	case "seed":
+		seed.Run(os.Args[2:])
+	case "load":
+		load.Run(os.Args[2:])
+	case "role":
+		role.Run(os.Args[2:])
+	case "timeline":
+		timeline.Run(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, use serve, migrate, seed, load, role or timeline\n", command)
+		os.Exit(2)
+	}
 }